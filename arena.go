@@ -0,0 +1,175 @@
+/*
+Copyright (c) 2012-2013 Fredrik Ehnbom
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice, this
+   list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE LIABLE FOR
+ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+(INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+(INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+package parser
+
+// How many Nodes, or Children entries, an arena allocates at once once
+// its trees are released. The chunks start small and double up to the
+// largest size, and are kept for the following parses.
+const (
+	minArenaChunk = 16
+	maxArenaChunk = 256
+)
+
+type (
+	// NodeArena allocates Nodes and their Children. Until its trees are
+	// released it allocates them one by one like Node.Cleanup does, as
+	// the trees are then kept after the next parse. Once a tree has
+	// been released it allocates in chunks instead, and the nodes of
+	// the trees released afterwards are reused by the following
+	// parses, so that building a tree takes few or no allocations.
+	// Nodes discarded while backtracking stay in the arena until the
+	// tree is released.
+	NodeArena struct {
+		// Whether the trees are released, which makes the arena
+		// allocate in chunks
+		pooled   bool
+		nodes    nodeChunks
+		children childChunks
+	}
+
+	// nodeChunks hands out Nodes from chunks of them
+	nodeChunks struct {
+		// The chunk being handed out, its length what has been
+		// handed out of it
+		cur []Node
+		// The chunks handed out before it, and the released ones
+		used, free [][]Node
+	}
+
+	// childChunks hands out Children from chunks of them
+	childChunks struct {
+		cur        []*Node
+		used, free [][]*Node
+	}
+)
+
+// chunkSize returns the size of the chunk to allocate after one of
+// capacity "prev" for "n" entries
+func chunkSize(prev, n int) int {
+	size := 2 * prev
+	if size < minArenaChunk {
+		size = minArenaChunk
+	} else if size > maxArenaChunk {
+		size = maxArenaChunk
+	}
+	if size < n {
+		size = n
+	}
+	return size
+}
+
+// alloc returns a zeroed Node
+func (c *nodeChunks) alloc() *Node {
+	if len(c.cur) == cap(c.cur) {
+		if c.cur != nil {
+			c.used = append(c.used, c.cur)
+		}
+		if k := len(c.free); k > 0 {
+			c.cur, c.free = c.free[k-1][:0], c.free[:k-1]
+		} else {
+			c.cur = make([]Node, 0, chunkSize(cap(c.cur), 1))
+		}
+	}
+	c.cur = c.cur[:len(c.cur)+1]
+	n := &c.cur[len(c.cur)-1]
+	*n = Node{}
+	return n
+}
+
+// alloc returns "n" nil Children
+func (c *childChunks) alloc(n int) []*Node {
+	if len(c.cur)+n > cap(c.cur) {
+		if c.cur != nil {
+			c.used = append(c.used, c.cur)
+		}
+		if k := len(c.free); k > 0 && cap(c.free[k-1]) >= n {
+			c.cur, c.free = c.free[k-1][:0], c.free[:k-1]
+		} else {
+			c.cur = make([]*Node, 0, chunkSize(cap(c.cur), n))
+		}
+	}
+	l := len(c.cur)
+	c.cur = c.cur[:l+n]
+	s := c.cur[l : l+n : l+n]
+	for i := range s {
+		s[i] = nil
+	}
+	return s
+}
+
+// release makes all the chunks free for reuse
+func (c *nodeChunks) release() {
+	if c.cur != nil {
+		c.used = append(c.used, c.cur)
+	}
+	c.free = append(c.free, c.used...)
+	c.cur, c.used = nil, c.used[:0]
+}
+
+func (c *childChunks) release() {
+	if c.cur != nil {
+		c.used = append(c.used, c.cur)
+	}
+	c.free = append(c.free, c.used...)
+	c.cur, c.used = nil, c.used[:0]
+}
+
+// New returns a Node allocated in the arena, set to "n"
+func (a *NodeArena) New(n Node) *Node {
+	if !a.pooled {
+		node := new(Node)
+		*node = n
+		return node
+	}
+	node := a.nodes.alloc()
+	*node = n
+	return node
+}
+
+// Cleanup is Node.Cleanup allocating the returned Node in the arena
+func (a *NodeArena) Cleanup(n *Node, pos, end int) *Node {
+	return n.cleanup(a, pos, end)
+}
+
+// Release makes the arena reuse all the nodes it has allocated, which
+// mustn't be used afterwards, and allocate in chunks from then on
+func (a *NodeArena) Release() {
+	a.pooled = true
+	a.nodes.release()
+	a.children.release()
+}
+
+// Drop makes the arena forget the nodes it has allocated, which stay
+// valid for as long as they are used. Unless they were all released
+// already, the arena allocates one by one again until the next
+// Release, as its trees are evidently kept.
+func (a *NodeArena) Drop() {
+	if a.nodes.cur == nil && a.children.cur == nil {
+		return
+	}
+	a.pooled = false
+	a.nodes.cur, a.nodes.used = nil, nil
+	a.children.cur, a.children.used = nil, nil
+}
@@ -24,6 +24,7 @@ package parser
 
 import (
 	"fmt"
+	"github.com/limetext/text"
 )
 
 type (
@@ -39,26 +40,87 @@ type (
 		Column() int
 		Description() string
 		Error() string
+		// Offset returns the byte offset of the error in the data, or
+		// -1 if it isn't known
+		Offset() int
 	}
 
 	BasicError struct {
 		line        int
 		column      int
 		description string
+		offset      int
 	}
+	// Token is a match of one of the definitions in a grammar's
+	// lexical section, with the trivia such as whitespace and comments
+	// preceding it attached.
+	Token struct {
+		Kind   string
+		Range  text.Region
+		Trivia []Token
+	}
+
+	// Reader is the data a parser reads. Offsets into it, such as
+	// the Range of a Node, count bytes.
+	//
+	// Lines and columns start at 1. A line ends after a '\n', so a
+	// "\r\n" ends a line too. LineCol counts a column per rune, an
+	// invalid UTF-8 byte being one rune, while LineColUTF16 counts
+	// the UTF-16 code units that editors and the Language Server
+	// Protocol use, which is two for runes outside the Basic
+	// Multilingual Plane. Offsets out of the data are clamped to it,
+	// and the part of a rune before an offset within it counts as
+	// invalid bytes.
+	//
+	// Offset and OffsetUTF16 convert back, a column past the end of
+	// its line giving the offset of the line's end and a line past
+	// the end of the data the offset of its end. A UTF-16 column
+	// within a surrogate pair gives the offset of its rune.
 	Reader interface {
 		Len() int
 		Pos() int
 		Read() rune
 		UnRead()
 		LineCol(offset int) (line, col int)
+		LineColUTF16(offset int) (line, col int)
+		Offset(line, col int) int
+		OffsetUTF16(line, col int) int
+		// RuneOffset returns how many runes come before "offset"
+		RuneOffset(offset int) int
+		// ByteOffset returns the offset of the rune "runeOffset" runes
+		// in, or the end of the data if there aren't that many
+		ByteOffset(runeOffset int) int
 		Substring(start, end int) string
 		Seek(offset int)
 	}
+
+	// ByteReader is a Reader over a []byte that hands out parts of
+	// it without copying, such as BytesReader
+	ByteReader interface {
+		Reader
+		Bytes(start, end int) []byte
+	}
+
+	// Committer is a Reader that can let go of the data before an
+	// offset, such as one reading a stream. Parsers generated for
+	// grammars with cuts call Commit once a cut leaves them no
+	// choice, repetition, option or predicate to go back to. They
+	// won't read before the offset after that, but still seek there
+	// when failing, and the nodes built so far refer to the data.
+	Committer interface {
+		Reader
+		Commit(offset int)
+	}
 )
 
 func NewError(line, column int, description string) Error {
-	return &BasicError{line, column, description}
+	return &BasicError{line, column, description, -1}
+}
+
+// NewErrorAt returns an Error at the byte offset "offset" as well as
+// its line and column
+func NewErrorAt(offset, line, column int, description string) Error {
+	return &BasicError{line, column, description, offset}
 }
 func (be *BasicError) Error() string {
 	return fmt.Sprintf("%d,%d: %s", be.line, be.column, be.description)
@@ -66,3 +128,4 @@ func (be *BasicError) Error() string {
 func (be *BasicError) Line() int           { return be.line }
 func (be *BasicError) Column() int         { return be.column }
 func (be *BasicError) Description() string { return be.description }
+func (be *BasicError) Offset() int         { return be.offset }
@@ -41,6 +41,10 @@ type CGenerator struct {
 	Imports         []string
 	havefunctions   bool
 	currentName     string
+	// Whether the definition being generated has a cut inside a
+	// choice, repetition or predicate, in which case its cut variable
+	// tells them that the input stopped matching after the cut
+	cut bool
 }
 
 func (g *CGenerator) SetCustomActions(actions []CustomAction) {
@@ -82,13 +86,18 @@ func (g *CGenerator) MakeParserFunction(node *Node) error {
 	exp := node.Children[len(node.Children)-1]
 	defName := helper(g, id)
 	g.currentName = defName
+	g.cut = hasScopedCut(exp, false)
 	data := helper(g, exp)
 
 	g.realOutput += "static int p_" + defName + "(" + g.s.Name + "*);\n"
 
 	if !g.havefunctions {
 		g.havefunctions = true
-		g.output += "static int " + g.s.Name + "_parse2(" + g.s.Name + "* __restrict__ p) {\n\treturn p_" + defName + "(p);\n}\n"
+		start := g.s.Start
+		if start == "" {
+			start = defName
+		}
+		g.output += "static int " + g.s.Name + "_parse2(" + g.s.Name + "* __restrict__ p) {\n\treturn p_" + start + "(p);\n}\n"
 	}
 
 	indenter := CodeFormatter{}
@@ -137,6 +146,9 @@ func (g *CGenerator) MakeParserFunction(node *Node) error {
 			if data[len(data)-1] != '\n' {
 				end = "\n" + end
 			}
+			if g.cut {
+				indenter.Add("int cut = FALSE;\n")
+			}
 			indenter.Add("int accept = FALSE;\n" + data + end)
 		} else {
 			indenter.Add("return " + data + ";\n")
@@ -257,28 +269,51 @@ func (g *CGenerator) CheckNext(a string) string {
 
 func (g *CGenerator) AssertNot(a string) string {
 	return `const char* __restrict__ s = p->parserData.pos;
-` + g.Call(a) + `
+` + g.Call(a) + g.uncut() + `
 p->parserData.pos = s;
 accept = !accept;`
 }
 
 func (g *CGenerator) AssertAnd(a string) string {
 	return `const char* __restrict__ s = p->parserData.pos;
-` + g.Call(a) + `
+` + g.Call(a) + g.uncut() + `
 p->parserData.pos = s;`
 }
 
+func (g *CGenerator) Capture(name, a string) string {
+	panic(&UnsupportedError{Feature: "captures"})
+}
+
+func (g *CGenerator) BackReference(name string) string {
+	panic(&UnsupportedError{Feature: "back-references"})
+}
+
+func (g *CGenerator) SemanticAnd(code string) string {
+	panic(&UnsupportedError{Feature: "semantic predicates"})
+}
+
+func (g *CGenerator) SemanticNot(code string) string {
+	panic(&UnsupportedError{Feature: "semantic predicates"})
+}
+
+func (g *CGenerator) Precedence(operand string, levels []PrecedenceLevel) string {
+	panic(&UnsupportedError{Feature: "operator precedence"})
+}
+
 func (g *CGenerator) ZeroOrMore(a string) string {
 	var cf CodeFormatter
 	cf.Add("{\n")
 	cf.Inc()
+	if g.cut {
+		cf.Add("const char* __restrict__ save = p->parserData.pos;\n")
+	}
 	cf.Add("accept = TRUE;")
 	cf.Add("\nwhile (accept) {\n")
 	cf.Inc()
 	cf.Add(g.Call(a))
 	cf.Dec()
 	cf.Add("\n}\n")
-	cf.Add("accept = TRUE;\n")
+	cf.Add(g.endRepetition())
 	cf.Dec()
 	cf.Add("}")
 	return cf.String()
@@ -290,7 +325,7 @@ func (g *CGenerator) OneOrMore(a string) string {
 	cf.Inc()
 	cf.Add(`const char* __restrict__ save = p->parserData.pos;
 ` + g.Call(a) + `
-if (!accept) {
+if (!accept) {` + strings.Replace(g.uncut(), "\n", "\n\t", -1) + `
 	p->parserData.pos = save;
 } else {
 	while (accept) {
@@ -299,9 +334,7 @@ if (!accept) {
 	cf.Inc()
 	cf.Add(g.Call(a) + "\n")
 	cf.Dec()
-	cf.Add(`}
-accept = TRUE;
-`)
+	cf.Add("}\n" + g.endRepetition())
 	cf.Dec()
 	cf.Add("}\n")
 	cf.Dec()
@@ -310,17 +343,59 @@ accept = TRUE;
 }
 
 func (g *CGenerator) Maybe(a string) string {
+	if g.cut {
+		// Failing after a cut fails the option as well
+		return g.Call(a) + "\naccept = !cut;\ncut = FALSE;"
+	}
 	return g.Call(a) + "\naccept = TRUE;"
 }
 
+// uncut returns the code resetting the cut variable after an
+// expression of a predicate, where failing after a cut just fails the
+// expression
+func (g *CGenerator) uncut() string {
+	if g.cut {
+		return "\ncut = FALSE;"
+	}
+	return ""
+}
+
+// endRepetition returns the code ending a repetition starting at
+// "save" once an attempt to repeat fails, failing it as a whole if the
+// attempt failed after a cut
+func (g *CGenerator) endRepetition() string {
+	if g.cut {
+		return `if (cut) {
+	cut = FALSE;
+	p->parserData.pos = save;
+} else {
+	accept = TRUE;
+}
+`
+	}
+	return "accept = TRUE;\n"
+}
+
 type cNeedAllGroup struct {
 	cf    CodeFormatter
-	g     Generator
+	g     *CGenerator
 	stack list.List
 	label string
+	cut   bool
 }
 
 func (b *cNeedAllGroup) Add(value, name string) {
+	if b.cut && b.g.cut {
+		// Tell the enclosing choice, repetition or predicate
+		b.cf.Add(b.g.Call(value) + `
+if (!accept) {
+	cut = TRUE;
+} else {
+`)
+		b.cf.Inc()
+		b.stack.PushBack(name)
+		return
+	}
 	b.cf.Add(b.g.Call(value) + `
 if (accept) {
 `)
@@ -328,16 +403,30 @@ if (accept) {
 	b.stack.PushBack(name)
 }
 
+func (b *cNeedAllGroup) Cut() {
+	b.cut = true
+}
+
 type cNeedOneGroup struct {
 	cf CodeFormatter
-	g  Generator
+	g  *CGenerator
 }
 
 func (b *cNeedOneGroup) Add(value, name string) {
-	b.cf.Add(b.g.Call(value) + "\nif (!accept) {\n")
+	if b.g.cut {
+		// Only try the next alternative if this one didn't fail
+		// after a cut
+		b.cf.Add(b.g.Call(value) + "\nif (!accept && !cut) {\n")
+	} else {
+		b.cf.Add(b.g.Call(value) + "\nif (!accept) {\n")
+	}
 	b.cf.Inc()
 }
 
+func (b *cNeedOneGroup) Cut() {
+	panic("Shouldn't reach this")
+}
+
 func (g *CGenerator) BeginGroup(requireAll bool) Group {
 	if requireAll {
 		r := cNeedAllGroup{g: g}
@@ -379,7 +468,7 @@ func (g *CGenerator) EndGroup(gr Group) string {
 			t.cf.Dec()
 			t.cf.Add("}\n")
 		}
-		t.cf.Add("if (!accept) {\n\tp->parserData.pos = save;\n}\n")
+		t.cf.Add("if (!accept) {" + strings.Replace(g.uncut(), "\n", "\n\t", -1) + "\n\tp->parserData.pos = save;\n}\n")
 		t.cf.Dec()
 		t.cf.Add("}")
 		return t.cf.String()
@@ -403,6 +492,9 @@ func (g *CGenerator) Call(value string) string {
 
 func (g *CGenerator) Begin(s GeneratorSettings) error {
 	g.s = s
+	if len(s.Tokens) > 0 {
+		panic(&UnsupportedError{Feature: "lexical sections"})
+	}
 	// imports := ""
 	// impList := g.Imports
 	// if g.AddDebugLogging {
@@ -0,0 +1,164 @@
+/*
+Copyright (c) 2012-2013 Fredrik Ehnbom
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice, this
+   list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE LIABLE FOR
+ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+(INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+(INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/limetext/text"
+	"html"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"text/tabwriter"
+)
+
+type (
+	// CoverageProfile counts how often the alternatives, sequence
+	// elements and repetitions of a grammar matched. Parsers generated
+	// with coverage enabled keep one in their package's Coverage variable.
+	CoverageProfile struct {
+		// The source of the grammar
+		Grammar string
+		Points  []CoveragePoint
+	}
+
+	// CoveragePoint is a counted part of the grammar
+	CoveragePoint struct {
+		// The definition the point is in
+		Definition string
+		// Where in the Grammar the point is
+		Range        text.Region
+		Line, Column int
+		// Number of times the point matched
+		Count int64
+	}
+)
+
+// Hit records a match of the point at index "i". Safe to call
+// concurrently.
+func (c *CoverageProfile) Hit(i int) {
+	atomic.AddInt64(&c.Points[i].Count, 1)
+}
+
+// Reset sets all the counts back to zero
+func (c *CoverageProfile) Reset() {
+	for i := range c.Points {
+		atomic.StoreInt64(&c.Points[i].Count, 0)
+	}
+}
+
+// Missed returns the points that never matched
+func (c *CoverageProfile) Missed() (ret []CoveragePoint) {
+	for _, p := range c.Points {
+		if atomic.LoadInt64(&p.Count) == 0 {
+			ret = append(ret, p)
+		}
+	}
+	return
+}
+
+// sorted returns the points in the order they appear in the
+// grammar, outer points before the ones they contain
+func (c *CoverageProfile) sorted() []CoveragePoint {
+	points := make([]CoveragePoint, len(c.Points))
+	copy(points, c.Points)
+	sort.SliceStable(points, func(i, j int) bool {
+		if points[i].Range.A != points[j].Range.A {
+			return points[i].Range.A < points[j].Range.A
+		}
+		return points[i].Range.B > points[j].Range.B
+	})
+	return points
+}
+
+// String returns a text report listing the count of each point in
+// the order they appear in the grammar.
+func (c *CoverageProfile) String() string {
+	buf := bytes.NewBuffer(nil)
+	fmt.Fprintf(buf, "%d of %d grammar points hit\n", len(c.Points)-len(c.Missed()), len(c.Points))
+	w := tabwriter.NewWriter(buf, 0, 8, 1, ' ', 0)
+	for _, p := range c.sorted() {
+		count := fmt.Sprint(atomic.LoadInt64(&p.Count))
+		if count == "0" {
+			count = "never"
+		}
+		src := strings.Join(strings.Fields(c.Grammar[p.Range.A:p.Range.B]), " ")
+		if len(src) > 60 {
+			src = src[:57] + "..."
+		}
+		fmt.Fprintf(w, "%d:%d\t%s\t%s\t%s\n", p.Line, p.Column, count, p.Definition, src)
+	}
+	w.Flush()
+	return buf.String()
+}
+
+// HTML returns a self-contained HTML page showing the grammar with
+// the points that matched highlighted in green and those that never
+// did in red. Hovering a point shows its count.
+func (c *CoverageProfile) HTML() string {
+	points := c.sorted()
+	buf := bytes.NewBufferString(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Grammar coverage</title>
+<style>
+span.hit { background: rgba(0, 160, 0, 0.15); }
+span.missed { background: rgba(220, 0, 0, 0.3); }
+</style>
+</head>
+<body>
+`)
+	fmt.Fprintf(buf, "<p>%d of %d grammar points hit</p>\n<pre>", len(c.Points)-len(c.Missed()), len(c.Points))
+	var (
+		pos   int
+		stack []int
+	)
+	for _, p := range points {
+		for len(stack) > 0 && stack[len(stack)-1] <= p.Range.A {
+			buf.WriteString(html.EscapeString(c.Grammar[pos:stack[len(stack)-1]]) + "</span>")
+			pos, stack = stack[len(stack)-1], stack[:len(stack)-1]
+		}
+		start := maxInt(pos, p.Range.A)
+		buf.WriteString(html.EscapeString(c.Grammar[pos:start]))
+		class, count := "hit", atomic.LoadInt64(&p.Count)
+		if count == 0 {
+			class = "missed"
+		}
+		fmt.Fprintf(buf, `<span class="%s" title="%s %d:%d, %d matches">`, class, html.EscapeString(p.Definition), p.Line, p.Column, count)
+		end := maxInt(start, p.Range.B)
+		if len(stack) > 0 && end > stack[len(stack)-1] {
+			end = stack[len(stack)-1]
+		}
+		pos, stack = start, append(stack, end)
+	}
+	for len(stack) > 0 {
+		buf.WriteString(html.EscapeString(c.Grammar[pos:stack[len(stack)-1]]) + "</span>")
+		pos, stack = stack[len(stack)-1], stack[:len(stack)-1]
+	}
+	buf.WriteString(html.EscapeString(c.Grammar[pos:]) + "</pre>\n</body>\n</html>\n")
+	return buf.String()
+}
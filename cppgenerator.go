@@ -57,13 +57,18 @@ func (g *CPPGenerator) MakeParserFunction(node *Node) error {
 	exp := node.Children[len(node.Children)-1]
 	defName := helper(g, id)
 	g.currentName = defName
+	g.cut = hasScopedCut(exp, false)
 	data := helper(g, exp)
 
 	g.realOutput += "static bool p_" + defName + "(" + g.s.Name + "*);\n"
 
 	if !g.havefunctions {
 		g.havefunctions = true
-		g.output += "bool " + g.s.Name + "::realParse() {\n\treturn p_" + defName + "(this);\n}\n"
+		start := g.s.Start
+		if start == "" {
+			start = defName
+		}
+		g.output += "bool " + g.s.Name + "::realParse() {\n\treturn p_" + start + "(this);\n}\n"
 	}
 
 	indenter := CodeFormatter{}
@@ -112,6 +117,9 @@ func (g *CPPGenerator) MakeParserFunction(node *Node) error {
 			if data[len(data)-1] != '\n' {
 				end = "\n" + end
 			}
+			if g.cut {
+				indenter.Add("bool cut = false;\n")
+			}
 			indenter.Add("bool accept = false;\nconst register char * __restrict__ &_pos = p->parserData.pos;\n" + data + end)
 		} else {
 			indenter.Add("return " + data + ";\n")
@@ -125,6 +133,9 @@ func (g *CPPGenerator) MakeParserFunction(node *Node) error {
 
 func (g *CPPGenerator) Begin(s GeneratorSettings) error {
 	g.s = s
+	if len(s.Tokens) > 0 {
+		panic(&UnsupportedError{Feature: "lexical sections"})
+	}
 	// imports := ""
 	// impList := g.Imports
 	// if g.AddDebugLogging {
@@ -1,19 +1,40 @@
 package expression
 
 import (
+	"fmt"
+	"strings"
 	"testing"
 )
 
 func TestParser2(t *testing.T) {
 	tests := [][]string{{"(MyMask & (Test >> 3)) << 0x2", `0-29: "EXPRESSION"
-	0-29: "ShiftLeft"
-		1-20: "Mask"
+	1-29: "Op"
+		1-20: "Op"
 			1-7: "Identifier" - Data: "MyMask"
-			11-20: "ShiftRight"
+			8-9: "Operator" - Data: "&"
+			11-20: "Op"
 				11-15: "Identifier" - Data: "Test"
+				16-18: "Operator" - Data: ">>"
 				19-20: "Constant" - Data: "3"
+		23-25: "Operator" - Data: "<<"
 		26-29: "Constant" - Data: "0x2"
 	29-29: "EndOfFile" - Data: ""
+`},
+		{"A | B & C << 1 | D", `0-18: "EXPRESSION"
+	0-18: "Op"
+		0-14: "Op"
+			0-1: "Identifier" - Data: "A"
+			2-3: "Operator" - Data: "|"
+			4-14: "Op"
+				4-5: "Identifier" - Data: "B"
+				6-7: "Operator" - Data: "&"
+				8-14: "Op"
+					8-9: "Identifier" - Data: "C"
+					10-12: "Operator" - Data: "<<"
+					13-14: "Constant" - Data: "1"
+		15-16: "Operator" - Data: "|"
+		17-18: "Identifier" - Data: "D"
+	18-18: "EndOfFile" - Data: ""
 `},
 	}
 	var p EXPRESSION
@@ -31,3 +52,36 @@ func TestParser2(t *testing.T) {
 		}
 	}
 }
+
+func TestTokens(t *testing.T) {
+	var p EXPRESSION
+	if !p.Parse(" (A)\t<< 0x2\n") {
+		t.Fatalf("Didn't parse correctly: %s\n", p.Error())
+	}
+	var tokens []string
+	for _, tok := range p.Tokens {
+		s := tok.Kind + " " + p.Data(tok.Range.A, tok.Range.B)
+		for _, tr := range tok.Trivia {
+			s += fmt.Sprintf(" %s%q", tr.Kind, p.Data(tr.Range.A, tr.Range.B))
+		}
+		tokens = append(tokens, s)
+	}
+	exp := []string{
+		`Symbol ( Spacing" "`,
+		`Identifier A`,
+		`Symbol )`,
+		`Symbol << Spacing"\t"`,
+		`Constant 0x2 Spacing" "`,
+	}
+	if strings.Join(tokens, "\n") != strings.Join(exp, "\n") {
+		t.Errorf("Unexpected tokens:\n%s", strings.Join(tokens, "\n"))
+	}
+	if len(p.Trailing) != 1 || p.Trailing[0].Range.A != 11 {
+		t.Errorf("Unexpected trailing trivia: %v", p.Trailing)
+	}
+	for _, in := range []string{"A $ B", "A B", "(A"} {
+		if p.Parse(in) && p.RootNode().Range.End() == p.ParserData.Len() {
+			t.Errorf("Expected %q not to parse", in)
+		}
+	}
+}
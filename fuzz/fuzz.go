@@ -0,0 +1,408 @@
+/*
+Copyright (c) 2012-2013 Fredrik Ehnbom
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice, this
+   list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE LIABLE FOR
+ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+(INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+(INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+// Package fuzz generates random input that a grammar accepts, for
+// fuzzing the consumers of the formats the grammars describe.
+package fuzz
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/quarnster/parser"
+	"math"
+	"math/rand"
+)
+
+const infinite = math.MaxInt32
+
+type (
+	// Config controls the samples a Generator produces
+	Config struct {
+		// Seed of the random number generator. The same seed, grammar
+		// and Config produce the same samples.
+		Seed int64
+		// How deep definitions may nest before the generator starts
+		// taking the shortest way out of the grammar. 16 by default.
+		MaxDepth int
+		// Length in bytes samples are kept below. 4096 by default.
+		MaxSize int
+		// Maximum number of times a "*" or "+" repeats, and of
+		// operators in a %prec definition. 4 by default.
+		MaxRepeat int
+		// How many samples to try before giving up on finding one
+		// the grammar accepts. 100 by default.
+		MaxAttempts int
+		// Relative weights of the alternatives of the named
+		// definitions, all being equally likely by default
+		Weights map[string][]float64
+	}
+
+	// Generator produces random samples the grammar it was created
+	// for accepts. Predicates aren't taken into account while
+	// generating, instead samples the grammar doesn't accept are
+	// rejected and generated anew.
+	Generator struct {
+		cfg     Config
+		rnd     *rand.Rand
+		in      *parser.Interpreter
+		defs    map[string]*parser.Node
+		tokens  []string
+		trivia  []string
+		lexical map[string]bool
+		// The minimum nesting depth needed to produce something for
+		// the expression, which is what the shortest way out of the
+		// grammar is based on
+		height map[*parser.Node]int
+
+		buf      bytes.Buffer
+		lexing   bool
+		captures []map[string]string
+	}
+)
+
+// New returns a Generator for the grammar tree "rootNode" as produced
+// by peg.Peg. It checks the samples with an Interpreter, so it fails
+// on the grammars NewInterpreter rejects, such as those with semantic
+// predicates.
+func New(rootNode *parser.Node, cfg Config) (*Generator, error) {
+	if cfg.MaxDepth <= 0 {
+		cfg.MaxDepth = 16
+	}
+	if cfg.MaxSize <= 0 {
+		cfg.MaxSize = 4096
+	}
+	if cfg.MaxRepeat <= 0 {
+		cfg.MaxRepeat = 4
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 100
+	}
+	in, err := parser.NewInterpreter(rootNode, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	g := &Generator{
+		cfg:     cfg,
+		rnd:     rand.New(rand.NewSource(cfg.Seed)),
+		in:      in,
+		defs:    make(map[string]*parser.Node),
+		lexical: make(map[string]bool),
+		height:  make(map[*parser.Node]int),
+	}
+	for _, node := range rootNode.Children {
+		switch node.Name {
+		case "Definition":
+			g.defs[node.Children[0].Data()] = node.Children[len(node.Children)-1]
+		case "Lexical":
+			for _, child := range node.Children {
+				if child.Name == "Trivia" {
+					child = child.Children[0]
+					g.trivia = append(g.trivia, child.Children[0].Data())
+				} else {
+					g.tokens = append(g.tokens, child.Children[0].Data())
+				}
+				g.lexical[child.Children[0].Data()] = true
+				g.defs[child.Children[0].Data()] = child.Children[len(child.Children)-1]
+			}
+		}
+	}
+	for name, w := range cfg.Weights {
+		exp := g.defs[name]
+		if exp == nil {
+			return nil, fmt.Errorf("weights for unknown definition %q", name)
+		}
+		if exp.Name == "Expression" && len(w) != len(exp.Children) {
+			return nil, fmt.Errorf("%s has %d alternatives but %d weights", name, len(exp.Children), len(w))
+		}
+	}
+
+	// Iterate until no definition's height changes any longer
+	for _, exp := range g.defs {
+		g.height[exp] = infinite
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, exp := range g.defs {
+			before := g.height[exp]
+			if g.measure(exp) != before {
+				changed = true
+			}
+		}
+	}
+	for name, exp := range g.defs {
+		if g.height[exp] >= infinite {
+			return nil, fmt.Errorf("%s can't produce finite input", name)
+		}
+	}
+	return g, nil
+}
+
+// measure updates and returns the height of "node"
+func (g *Generator) measure(node *parser.Node) (h int) {
+	defer func() {
+		if h > infinite {
+			h = infinite
+		}
+		g.height[node] = h
+	}()
+	switch node.Name {
+	case "Expression":
+		h = infinite
+		for _, child := range node.Children {
+			if c := g.measure(child); c < h {
+				h = c
+			}
+		}
+		return
+	case "Sequence":
+		for _, child := range node.Children {
+			if c := g.measure(child); c > h {
+				h = c
+			}
+		}
+		return
+	case "Prefix":
+		h = g.measure(node.Children[len(node.Children)-1])
+		if front := node.Children[0]; front.Name == "NOT" || front.Name == "AND" {
+			// Nothing is generated for syntactic predicates
+			h = 0
+		}
+		return
+	case "Suffix":
+		h = g.measure(node.Children[0])
+		if len(node.Children) > 1 && node.Children[1].Name != "PLUS" {
+			h = 0
+		}
+		return
+	case "Primary":
+		if front := node.Children[0]; front.Name == "Identifier" {
+			return g.height[g.defs[front.Data()]] + 1
+		}
+		return g.measure(node.Children[0])
+	case "Precedence":
+		return g.height[g.defs[node.Children[0].Data()]] + 1
+	}
+	return 1
+}
+
+// Generate returns a random sample the grammar accepts, or an error
+// if none was found within Config.MaxAttempts tries
+func (g *Generator) Generate() (string, error) {
+	for i := 0; i < g.cfg.MaxAttempts; i++ {
+		g.buf.Reset()
+		g.captures = nil
+		g.lexing = false
+		g.call(g.in.Start(), 0)
+		if g.buf.Len() > g.cfg.MaxSize {
+			continue
+		}
+		sample := g.buf.String()
+		if g.in.Parse(sample) && g.in.ParserData.Pos() == len(sample) {
+			return sample, nil
+		}
+	}
+	return "", fmt.Errorf("no sample accepted by the grammar in %d attempts", g.cfg.MaxAttempts)
+}
+
+// short returns whether generation should take the shortest way out
+// of the grammar at the nesting depth "depth"
+func (g *Generator) short(depth int) bool {
+	return depth > g.cfg.MaxDepth || g.buf.Len() > g.cfg.MaxSize
+}
+
+// call generates input for the definition "name"
+func (g *Generator) call(name string, depth int) {
+	token := len(g.tokens) > 0 && !g.lexing && g.lexical[name]
+	lexing := g.lexing
+	g.lexing = g.lexical[name]
+	g.captures = append(g.captures, make(map[string]string))
+	exp := g.defs[name]
+	if exp.Name == "Precedence" {
+		g.climb(exp, depth)
+	} else {
+		g.pick(exp, depth, g.cfg.Weights[name])
+	}
+	g.captures = g.captures[:len(g.captures)-1]
+	g.lexing = lexing
+	if token {
+		g.separate(depth)
+	}
+}
+
+// separate adds trivia after a token so that it isn't merged with
+// the one following it
+func (g *Generator) separate(depth int) {
+	if len(g.trivia) == 0 {
+		return
+	}
+	lexing := g.lexing
+	g.lexing = true
+	g.call(g.trivia[g.rnd.Intn(len(g.trivia))], depth+1)
+	g.lexing = lexing
+}
+
+// pick generates input for "node", choosing among its alternatives
+// according to "weights" if it is a choice
+func (g *Generator) pick(node *parser.Node, depth int, weights []float64) {
+	if node.Name != "Expression" {
+		g.gen(node, depth)
+		return
+	} else if len(node.Children) == 1 {
+		g.gen(node.Children[0], depth)
+		return
+	}
+	if g.short(depth) {
+		best := node.Children[0]
+		for _, child := range node.Children[1:] {
+			if g.height[child] < g.height[best] {
+				best = child
+			}
+		}
+		g.gen(best, depth)
+		return
+	}
+	total := 0.0
+	for i := range node.Children {
+		total += weight(weights, i)
+	}
+	r := g.rnd.Float64() * total
+	for i, child := range node.Children {
+		if r -= weight(weights, i); r < 0 || i == len(node.Children)-1 {
+			g.gen(child, depth)
+			return
+		}
+	}
+}
+
+func weight(weights []float64, i int) float64 {
+	if weights == nil {
+		return 1
+	}
+	return weights[i]
+}
+
+// repeats returns how many times to repeat something, at least "min"
+func (g *Generator) repeats(min, depth int) int {
+	if g.short(depth) {
+		return min
+	}
+	return min + g.rnd.Intn(g.cfg.MaxRepeat-min+1)
+}
+
+// gen generates input for the expression "node"
+func (g *Generator) gen(node *parser.Node, depth int) {
+	switch node.Name {
+	case "Expression":
+		g.pick(node, depth, nil)
+	case "Sequence":
+		for _, child := range node.Children {
+			g.gen(child, depth)
+		}
+	case "Prefix":
+		switch front := node.Children[0]; front.Name {
+		case "NOT", "AND":
+			// Left to the rejection sampling
+		case "Label":
+			start := g.buf.Len()
+			g.gen(node.Children[len(node.Children)-1], depth)
+			g.captures[len(g.captures)-1][front.Children[0].Data()] = g.buf.String()[start:]
+		default:
+			g.gen(node.Children[len(node.Children)-1], depth)
+		}
+	case "Suffix":
+		n := 1
+		if len(node.Children) > 1 {
+			switch node.Children[1].Name {
+			case "PLUS":
+				n = g.repeats(1, depth)
+			case "STAR":
+				n = g.repeats(0, depth)
+			case "QUESTION":
+				n = g.repeats(0, depth)
+				if n > 1 {
+					n = 1
+				}
+			}
+		}
+		for i := 0; i < n; i++ {
+			g.gen(node.Children[0], depth)
+		}
+	case "Primary":
+		if front := node.Children[0]; front.Name == "Identifier" {
+			g.call(front.Data(), depth+1)
+		} else {
+			g.gen(front, depth)
+		}
+	case "Literal":
+		lit := node.Data()
+		g.buf.WriteString(string(parser.Unescape(lit[1 : len(lit)-1])))
+		g.endToken(depth)
+	case "Class":
+		var ranges [][]rune
+		for _, child := range node.Children {
+			lo := parser.Unescape(child.Children[0].Data())[0]
+			hi := lo
+			if len(child.Children) == 2 {
+				hi = parser.Unescape(child.Children[1].Data())[0]
+			}
+			if hi >= lo {
+				ranges = append(ranges, []rune{lo, hi})
+			}
+		}
+		if len(ranges) > 0 {
+			r := ranges[g.rnd.Intn(len(ranges))]
+			g.buf.WriteRune(r[0] + rune(g.rnd.Intn(int(r[1]-r[0]+1))))
+		}
+	case "DOT":
+		if len(g.tokens) > 0 && !g.lexing {
+			g.call(g.tokens[g.rnd.Intn(len(g.tokens))], depth+1)
+		} else {
+			g.buf.WriteRune(' ' + rune(g.rnd.Intn('~'-' '+1)))
+		}
+	case "BackReference":
+		g.buf.WriteString(g.captures[len(g.captures)-1][node.Children[0].Data()])
+	}
+}
+
+// endToken separates a literal matched as a token from the next one
+func (g *Generator) endToken(depth int) {
+	if len(g.tokens) > 0 && !g.lexing {
+		g.separate(depth)
+	}
+}
+
+// climb generates operands of the Precedence "exp" separated by
+// random operators
+func (g *Generator) climb(exp *parser.Node, depth int) {
+	var ops []*parser.Node
+	for _, level := range exp.Children[1:] {
+		ops = append(ops, level.Children[1:]...)
+	}
+	operand := exp.Children[0].Data()
+	g.call(operand, depth+1)
+	for n := g.repeats(0, depth); n > 0; n-- {
+		g.gen(ops[g.rnd.Intn(len(ops))], depth)
+		g.call(operand, depth+1)
+	}
+}
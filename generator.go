@@ -25,20 +25,18 @@ SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
 package parser
 
 import (
-	"container/list"
+	"fmt"
 	"strings"
 )
 
-var (
-	convMap    = make(map[string]*Node)
-	visitedMap = make(map[string]bool)
-	blocks     list.List
-)
-
 const (
 	DebugLevelNone DebugLevel = iota
+	// Trace the definitions that matched as they exit
 	DebugLevelNodeCreation
+	// Trace every definition entered and exited
 	DebugLevelEnterExit
+	// Also trace the terminals that didn't match and the sequences
+	// backtracking
 	DebugLevelAccept
 )
 
@@ -51,20 +49,89 @@ type (
 	DebugLevel int
 
 	GeneratorSettings struct {
-		// Whether to generate a parser which outputs debug information
+		// How much of its progress the generated parser reports to its
+		// Tracer, which is a TextTracer unless set to another one
 		DebugLevel DebugLevel
 		Header     string
 		Debug      bool
+		// Format the tree is dumped in when Debug is set. "html" and
+		// "dot" write it to a file named after the test input, anything
+		// else logs it as text.
+		DumpFormat string
 		Bench      bool
-		Testname   string
-		Name       string
-		FileName   string
-		WriteFile  func(name, data string) error
-		Heatmap    bool
+		// Input of the generated test. For the Go generator a glob,
+		// relative to the generated parser, of inputs each having the
+		// expected tree in a file of the same name with an .out
+		// extension. Other generators take a single file.
+		Testname string
+		Name     string
+		// Package of the generated parser, the lower cased Name by default
+		Package string
+		// Definition parsing starts at, the first one by default
+		Start     string
+		FileName  string
+		WriteFile func(name, data string) error
+		// Whether the generated parser records where it spends its
+		// time to a Profiler, which the generated test writes as a
+		// pprof profile
+		Profile bool
+		// Name of the grammar's file, which the profile refers to
+		GrammarFile string
+		// Directory, relative to the generated parser, of inputs the
+		// generated test makes sure parse to completion
+		Samples string
+		// Whether to count how often the parts of the grammar match.
+		// See CoverageProfile.
+		Coverage bool
+		// Source of the grammar. Filled in by GenerateParser.
+		Grammar string
+		// Type of the user supplied State member that semantic
+		// predicates can access. Left out of the parser when empty.
+		State string
+		// Definitions of the grammar's lexical section. Filled in by
+		// GenerateParser, Tokens being the kinds of the token stream
+		// and Trivia what is skipped and attached to the next token.
+		Tokens []string
+		Trivia []string
+		// How the nodes of the definitions named are shaped as the
+		// tree is built
+		Shapes map[string]Shape
+		// Whether the grammar has cuts. Filled in by GenerateParser.
+		Cuts bool
+	}
+
+	// Shape changes the nodes a definition creates as the tree is
+	// built, sparing passes over the tree afterwards. Lift wins over
+	// Drop, and Drop over Collapse.
+	Shape struct {
+		// Leave the node out, putting its children in its place
+		Lift bool
+		// Leave the node out when it has exactly one child, putting
+		// the child in its place. Nodes without children are kept, as
+		// leaving them out would lose the text they matched
+		Collapse bool
+		// Leave the node and its children out
+		Drop bool
+		// Name to give the node in place of the definition's
+		Rename string
+	}
+
+	// PrecedenceLevel is a set of binary operators sharing the same
+	// precedence and associativity
+	PrecedenceLevel struct {
+		RightAssoc bool
+		// The operator literals, quotes included
+		Operators []string
 	}
 
 	Group interface {
 		Add(value, name string)
+		// Commit to the values added so far. Failing to match a
+		// value added after the cut fails the innermost enclosing
+		// choice, repetition or predicate instead of trying its other
+		// alternatives. Once nothing is left to go back to the Go
+		// parsers tell their Reader, if it's a Committer.
+		Cut()
 	}
 
 	Value string
@@ -109,6 +176,28 @@ type (
 		// Make sure that "a" follows, without consuming input
 		AssertAnd(a string) string
 
+		// Remember the input matched by "a" as "name" for the
+		// remainder of the current definition invocation
+		Capture(name, a string) string
+
+		// Accept and consume input if the text last captured as
+		// "name" follows. Backtracks if it doesn't, or if nothing has
+		// been captured as "name" yet.
+		BackReference(name string) string
+
+		// Make sure that the user supplied predicate "code" holds,
+		// without consuming input
+		SemanticAnd(code string) string
+
+		// Make sure that the user supplied predicate "code" does not
+		// hold, without consuming input
+		SemanticNot(code string) string
+
+		// Parse "operand"s separated by the binary operators in
+		// "levels", lowest precedence first, nesting a node named
+		// after the current definition for each operation.
+		Precedence(operand string, levels []PrecedenceLevel) string
+
 		// Zero or More occurances of "a" follows
 		ZeroOrMore(a string) string
 
@@ -131,12 +220,31 @@ type (
 		// Called when generation is done
 		Finish() error
 	}
+	// Instrumenter is implemented by Generators that can count how
+	// often the parts of the grammar match
+	Instrumenter interface {
+		// Count the matches of the code "a" generated for the
+		// grammar node "node"
+		Instrument(node *Node, a string) string
+	}
 	CustomAction struct {
 		Name   string
 		Action func(Generator, string) string
 	}
+
+	// UnsupportedError is what a Generator panics with when the grammar
+	// uses a construct it can't express. GenerateParser recovers it and
+	// returns it as a regular error.
+	UnsupportedError struct {
+		Generator string
+		Feature   string
+	}
 )
 
+func (e *UnsupportedError) Error() string {
+	return e.Generator + " doesn't support " + e.Feature
+}
+
 func (i *CodeFormatter) Level() string {
 	return i.level
 }
@@ -168,6 +276,88 @@ func (i *CodeFormatter) String() string {
 	return i.data
 }
 
+// isCut returns whether the Prefix "node" is a cut operator
+func isCut(node *Node) bool {
+	return len(node.Children) == 1 && node.Children[0].Name == "CUT"
+}
+
+// hasCut returns whether "node" has a cut anywhere
+func hasCut(node *Node) bool {
+	if node.Name == "Prefix" && isCut(node) {
+		return true
+	}
+	for _, child := range node.Children {
+		if hasCut(child) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasUnscopedCut returns whether "node" has a cut outside of any
+// choice, repetition, option or predicate
+func hasUnscopedCut(node *Node) bool {
+	switch node.Name {
+	case "Expression", "Suffix":
+		if len(node.Children) > 1 {
+			return false
+		}
+	case "Prefix":
+		if isCut(node) {
+			return true
+		}
+		for _, front := range node.Children[:len(node.Children)-1] {
+			if front.Name == "NOT" || front.Name == "AND" {
+				return false
+			}
+		}
+	}
+	for _, child := range node.Children {
+		if hasUnscopedCut(child) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasScopedCut returns whether "node" has a cut that a choice,
+// repetition or predicate has to stop at, "scoped" telling whether
+// "node" itself is inside one. A cut anywhere else just fails the
+// definition, which would fail anyway.
+func hasScopedCut(node *Node, scoped bool) bool {
+	switch node.Name {
+	case "Expression":
+		scoped = scoped || len(node.Children) > 1
+	case "Suffix":
+		scoped = scoped || len(node.Children) > 1
+	case "Prefix":
+		for _, front := range node.Children[:len(node.Children)-1] {
+			scoped = scoped || front.Name == "NOT" || front.Name == "AND"
+		}
+	case "Sequence":
+		for _, child := range node.Children {
+			if scoped && isCut(child) {
+				return true
+			}
+		}
+	}
+	for _, child := range node.Children {
+		if hasScopedCut(child, scoped) {
+			return true
+		}
+	}
+	return false
+}
+
+// instrument wraps the code "a" generated for "node" so that its
+// matches are counted, if the Generator is an Instrumenter
+func instrument(gen Generator, node *Node, a string) string {
+	if in, ok := gen.(Instrumenter); ok {
+		return in.Instrument(node, a)
+	}
+	return a
+}
+
 func helper(gen Generator, node *Node) (retstring string) {
 	switch node.Name {
 	case "Class":
@@ -200,48 +390,74 @@ func helper(gen Generator, node *Node) (retstring string) {
 		return node.Data()
 	case "Literal":
 		return gen.CheckNext(node.Data())
+	case "BackReference":
+		return gen.BackReference(node.Children[0].Data())
 	case "Expression":
 		if len(node.Children) == 1 {
 			return helper(gen, node.Children[0])
 		} else {
 			g := gen.BeginGroup(false)
 			for _, child := range node.Children {
-				g.Add(helper(gen, child), child.Name)
+				g.Add(instrument(gen, child, helper(gen, child)), child.Name)
 			}
 			return gen.EndGroup(g)
 		}
 		return
 	case "Sequence":
-		if len(node.Children) == 1 {
+		if len(node.Children) == 1 && !isCut(node.Children[0]) {
 			return helper(gen, node.Children[0])
 		} else {
 			g := gen.BeginGroup(true)
 			for _, child := range node.Children {
-				g.Add(helper(gen, child), child.Name)
+				if isCut(child) {
+					g.Cut()
+				} else {
+					g.Add(instrument(gen, child, helper(gen, child)), child.Name)
+				}
 			}
 			return gen.EndGroup(g)
 		}
 		return
 	case "Prefix":
-		front := node.Children[0]
-		if len(node.Children) == 1 {
-			return helper(gen, front)
-		} else {
-			exp := helper(gen, node.Children[len(node.Children)-1])
-			switch front.Name {
+		exp := helper(gen, node.Children[len(node.Children)-1])
+		for i := len(node.Children) - 2; i >= 0; i-- {
+			switch front := node.Children[i]; front.Name {
+			case "Label":
+				exp = gen.Capture(front.Children[0].Data(), exp)
 			case "NOT":
-				return gen.AssertNot(exp)
+				exp = gen.AssertNot(exp)
 			case "AND":
-				return gen.AssertAnd(exp)
+				exp = gen.AssertAnd(exp)
+			default:
+				panic("Shouldn't reach this: " + front.Name)
+			}
+		}
+		return exp
+	case "Precedence":
+		var levels []PrecedenceLevel
+		for _, child := range node.Children[1:] {
+			level := PrecedenceLevel{RightAssoc: child.Children[0].Data() == "right"}
+			for _, op := range child.Children[1:] {
+				level.Operators = append(level.Operators, op.Data())
 			}
+			levels = append(levels, level)
 		}
-		panic("Shouldn't reach this: " + front.Name)
+		return gen.Precedence(gen.MakeParserCall(helper(gen, node.Children[0])), levels)
+	case "Predicate":
+		code := strings.TrimSpace(node.Children[len(node.Children)-1].Data())
+		switch node.Children[0].Name {
+		case "AND":
+			return gen.SemanticAnd(code)
+		case "NOT":
+			return gen.SemanticNot(code)
+		}
+		panic("Shouldn't reach this: " + node.Children[0].Name)
 	case "Suffix":
 		if len(node.Children) == 1 {
 			return helper(gen, node.Children[0])
 		} else {
 			back := node.Children[len(node.Children)-1]
-			exp := helper(gen, node.Children[0])
+			exp := instrument(gen, node.Children[0], helper(gen, node.Children[0]))
 			switch back.Name {
 			case "PLUS":
 				return gen.OneOrMore(exp)
@@ -271,15 +487,70 @@ func helper(gen Generator, node *Node) (retstring string) {
 	return
 }
 
-func GenerateParser(rootNode *Node, gen Generator, s GeneratorSettings) error {
+func GenerateParser(rootNode *Node, gen Generator, s GeneratorSettings) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			ue, ok := r.(*UnsupportedError)
+			if !ok {
+				panic(r)
+			}
+			if ue.Generator == "" {
+				ue.Generator = fmt.Sprintf("%T", gen)
+			}
+			err = ue
+		}
+	}()
+	var defs []*Node
+	s.Tokens, s.Trivia, s.Cuts = nil, nil, false
+	s.Grammar = rootNode.P.Data(0, rootNode.Range.End())
+	for _, node := range rootNode.Children {
+		switch node.Name {
+		case "Header":
+			switch key, value := node.Children[0].Data(), node.Children[1].Data(); key {
+			case "start":
+				s.Start = value
+			case "package":
+				s.Package = value
+			case "type":
+				s.Name = value
+			default:
+				return fmt.Errorf("unknown header @%s", key)
+			}
+		case "Definition":
+			defs = append(defs, node)
+		case "Lexical":
+			for _, child := range node.Children {
+				if child.Name == "Trivia" {
+					child = child.Children[0]
+					s.Trivia = append(s.Trivia, child.Children[0].Data())
+				} else {
+					s.Tokens = append(s.Tokens, child.Children[0].Data())
+				}
+				defs = append(defs, child)
+			}
+		}
+	}
+	if s.Package == "" {
+		s.Package = strings.ToLower(s.Name)
+	}
+	if s.Start != "" {
+		found := false
+		for _, node := range defs {
+			found = found || node.Children[0].Data() == s.Start
+		}
+		if !found {
+			return fmt.Errorf("unknown start definition %q", s.Start)
+		}
+	}
+	for _, node := range defs {
+		s.Cuts = s.Cuts || hasCut(node)
+	}
 	if err := gen.Begin(s); err != nil {
 		return err
 	}
-	for _, node := range rootNode.Children {
-		if node.Name == "Definition" {
-			if err := gen.MakeParserFunction(node); err != nil {
-				return err
-			}
+	for _, node := range defs {
+		if err := gen.MakeParserFunction(node); err != nil {
+			return err
 		}
 	}
 	return gen.Finish()
@@ -29,6 +29,8 @@ import (
 	"container/list"
 	"fmt"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -46,7 +48,23 @@ type GoGenerator struct {
 	debug, bench          bool
 	inlineCount           int
 	calledP               bool
-	RootNode              *Node
+	realParseAt           int
+	startName             string
+	// Whether the definition being generated has a cut inside a
+	// choice, repetition or predicate, in which case its cut variable
+	// tells them that the input stopped matching after the cut
+	cut      bool
+	captures map[string]int
+	// How many captures have been generated, telling whether a group
+	// has to restore them when it backtracks
+	captured int
+	err      error
+	lexical  map[string]bool
+	lexing   bool
+	rules    []string
+	coverage []CoveragePoint
+	profile  []ProfileFunction
+	RootNode *Node
 }
 
 func (g *GoGenerator) SetCustomActions(actions []CustomAction) {
@@ -58,25 +76,50 @@ func (g *GoGenerator) AddNode(data, defName string) string {
 start := p.ParserData.Pos()
 ` + g.Call(data) + `
 end := p.ParserData.Pos()
-if accept {
 `
-	if g.calledP || true {
-		ret += `	node := p.Root.Cleanup(start, end)
+	shape := g.s.Shapes[defName]
+	if shape.Rename != "" {
+		defName = shape.Rename
+	}
+	node := `	node := p.arena.Cleanup(&p.Root, start, end)
 	node.Name = "` + defName + `"
 	node.P = p
 	node.Range = node.Range.Clip(p.IgnoreRange)
 	p.Root.Append(node)
+	if p.limiter != nil {
+		p.limiter.Node(end)
+	}`
+	switch {
+	case shape.Lift:
+		// The children stay where they are
+		ret += `if !accept {
+	p.Root.Discard(start)
+}`
+	case shape.Drop:
+		ret += `p.Root.Discard(start)`
+	case shape.Collapse:
+		// A single child stays where it is
+		ret += `if !accept {
+	p.Root.Discard(start)
+} else if len(p.Root.ChildrenIn(start, end)) != 1 {
+` + node + `
+}`
+	case g.calledP || true:
+		ret += `if accept {
+` + node + `
 } else {
-	p.Root.Discard(start)`
-	} else {
-		ret += `	node := &Node{Range:text.Region{start,end}}
+	p.Root.Discard(start)
+}`
+	default:
+		ret += `if accept {
+	node := &Node{Range:text.Region{start,end}}
 	node.Name = "` + defName + `"
 	node.P = p
 	node.Range = node.Range.Clip(p.IgnoreRange)
-	p.Root.Append(node)`
+	p.Root.Append(node)
+}`
 	}
 	ret += `
-}
 if p.IgnoreRange.A >= end || p.IgnoreRange.B <= start {
 	p.IgnoreRange = text.Region{}
 }
@@ -84,12 +127,16 @@ if p.IgnoreRange.A >= end || p.IgnoreRange.B <= start {
 	return ret
 }
 
+// Ignore returns the code matching "data" without creating a node,
+// which IgnoreRange clips the nodes ending in it to. Ignored input
+// following the range without touching it starts a new range, as the
+// nodes in between would otherwise be covered by it and not clipped.
 func (g *GoGenerator) Ignore(data string) string {
 	return `accept = true
 start := p.ParserData.Pos()
 ` + g.Call(data) + `
 if accept && start != p.ParserData.Pos() {
-	if start < p.IgnoreRange.A || p.IgnoreRange.A == 0 {
+	if start < p.IgnoreRange.A || p.IgnoreRange.A == 0 || start > p.IgnoreRange.B {
 		p.IgnoreRange.A = start
 	}
 	p.IgnoreRange.B = p.ParserData.Pos()
@@ -98,40 +145,50 @@ if accept && start != p.ParserData.Pos() {
 }
 func (g *GoGenerator) MakeParserFunction(node *Node) error {
 	g.calledP = false
+	g.captures = nil
 	id := node.Children[0]
 	exp := node.Children[len(node.Children)-1]
+	g.cut = hasScopedCut(exp, false)
 	defName := helper(g, id)
 	g.currentName = defName
+	g.lexing = g.lexical[defName]
+	if !g.lexing {
+		g.rules = append(g.rules, defName)
+	}
 	data := helper(g, exp)
+	if g.err != nil {
+		return g.err
+	}
 
 	if !g.havefunctions {
 		g.havefunctions = true
-		g.output += "func (p *" + g.s.Name + ") realParse() bool {\n\treturn p." + defName + "()\n}\n"
+		g.realParseAt = len(g.output)
+		g.startName = g.s.Start
+		if g.startName == "" {
+			g.startName = defName
+		}
 	}
 
 	indenter := CodeFormatter{}
 	indenter.Add("func (p *" + g.s.Name + ") " + defName + "() bool {\n")
 	indenter.Inc()
 	indenter.Add("// " + strings.Replace(strings.TrimSpace(node.Data()), "\n", "\n// ", -1) + "\n")
-	if g.s.Heatmap {
-		indenter.Add(`
-key := fmt.Sprintf("` + defName + `")
-hs := time.Now()
-ov := p.Heatmap["` + defName + `"]
-defer func() {
-	dur := time.Since(hs)
-	v := p.Heatmap[key]
-	v.Calls++
-	v.Time += dur
-	p.Heatmap[key] = v
-	v = p.Heatmap["` + defName + `"]
-	v.Calls++
-	v.Time = ov.Time + dur
-	p.Heatmap["` + defName + `"] = v
-}()
-`)
+	if len(g.captures) > 0 {
+		// Starting out unmatched, which back-references fail on
+		indenter.Add(fmt.Sprintf("captures := [%d]text.Region{%s}\n", len(g.captures), strings.TrimSuffix(strings.Repeat("{A: -1}, ", len(g.captures)), ", ")))
 	}
-
+	if g.cut {
+		indenter.Add("cut := false\n")
+	}
+	if g.commits() && hasUnscopedCut(exp) {
+		// What a cut outside of any choice, repetition, option or
+		// predicate leaves to go back to
+		indenter.Add("depth := p.backtrack\n")
+	}
+	indenter.Add(`if p.limiter != nil {
+	p.limiter.Enter(p.ParserData.Pos())
+}
+`)
 	defaultAction := true
 	for i := range g.CustomActions {
 		if defName == g.CustomActions[i].Name {
@@ -140,66 +197,50 @@ defer func() {
 			break
 		}
 	}
-	if defaultAction {
+	if defaultAction && exp.Name != "Precedence" && !g.lexing {
+		// Precedence definitions create their own nodes, and the
+		// tokenizer creates those of the lexical section
 		data = g.AddNode(data, defName)
 	}
-	if g.s.DebugLevel > DebugLevelNone {
-		if strings.HasPrefix(data, "accept") || data[0] == '{' {
-			data = "accept := false\n" + data
-		} else {
-			data = "accept := " + data
-		}
-		indenter.Add(`var (
-	pos = p.ParserData.Pos()
-	l   = p.ParserData.Len()
-)
-`)
-		if g.s.DebugLevel >= DebugLevelEnterExit {
-			indenter.Add(`
-log.Println(fm.Level() + "` + defName + ` entered")
-fm.Inc()
+	if strings.HasPrefix(data, "accept") || data[0] == '{' {
+		data = "accept := false\n" + data
+	} else {
+		data = "accept := " + data
+	}
+	if !strings.HasSuffix(data, "\n") {
+		data += "\n"
+	}
+	if g.s.DebugLevel > DebugLevelNone || g.s.Profile {
+		indenter.Add("pos := p.ParserData.Pos()\n")
+	}
+	if g.s.Profile {
+		g.profile = append(g.profile, ProfileFunction{Name: defName, Line: g.line(id.Range.A)})
+		indenter.Add(fmt.Sprintf("frame := p.Profile.Enter(%d, pos)\n", len(g.profile)-1))
+	}
+	if g.s.DebugLevel >= DebugLevelEnterExit {
+		indenter.Add(`p.Tracer.Trace(Event{Kind: EventEnter, Name: "` + defName + `", Start: pos})
 `)
-		}
-		indenter.Add(data)
-		if g.s.DebugLevel >= DebugLevelEnterExit {
-			indenter.Add(`
-fm.Dec()
-if !accept && p.ParserData.Pos() != pos {
+	}
+	indenter.Add(data)
+	exit := `p.Tracer.Trace(Event{Kind: EventExit, Name: "` + defName + `", Start: pos, End: p.ParserData.Pos(), Accept: accept})`
+	if g.s.DebugLevel >= DebugLevelEnterExit {
+		indenter.Add(`if !accept && p.ParserData.Pos() != pos {
 	log.Fatalln("` + defName + `", accept, ", ", pos, ", ", p.ParserData.Pos())
 }
-`)
-		}
-		if g.s.DebugLevel > DebugLevelNone {
-			indenter.Add(`
-p2 := p.ParserData.Pos()
-data := ""
-if p2 < p.ParserData.Len() {
-	data = p.ParserData.Substring(pos,p2)
+` + exit + "\n")
+	} else if g.s.DebugLevel > DebugLevelNone {
+		indenter.Add("if accept {\n\t" + exit + "\n}\n")
+	}
+	if g.s.Profile {
+		indenter.Add("p.Profile.Exit(frame)\n")
+	}
+	// Not deferred, as that slows down the parsers without limits.
+	// A panic gives up on the whole parse anyway.
+	indenter.Add(`if p.limiter != nil {
+	p.limiter.Exit()
 }
-`)
-			if g.s.DebugLevel < DebugLevelEnterExit {
-				indenter.Inc("if accept {\n")
-			}
-			indenter.Add(`log.Println(fm.Level()+"` + defName + ` returned: ", accept, ", ", pos, ", ", p.ParserData.Pos(), ", ", l, string(data))` + "\n")
-			if g.s.DebugLevel < DebugLevelEnterExit {
-				indenter.Dec("}")
-			}
-
-			indenter.Add(`
 return accept
 `)
-		}
-	} else {
-		if strings.HasPrefix(data, "accept") || data[0] == '{' {
-			end := "return accept\n"
-			if data[len(data)-1] != '\n' {
-				end = "\n" + end
-			}
-			indenter.Add("accept := false\n" + data + end)
-		} else {
-			indenter.Add("return " + data + "\n")
-		}
-	}
 	indenter.Dec()
 	indenter.Add("}\n\n")
 	g.output += g.currentFunctions
@@ -236,24 +277,73 @@ func (g *GoGenerator) MakeParserCall(value string) string {
 	// 	g.inlineCount--
 	// }
 
+	if g.isToken(value) {
+		return `accept = p.matchToken("` + value + `", "")`
+	}
 	return "p." + value
 }
 
-func (g *GoGenerator) CheckInRange(a, b string) string {
-	var (
-		extra2 string
-	)
-	if g.s.DebugLevel >= DebugLevelAccept {
-		extra2 = `
-		log.Printf(fm.Level()+"accept = false; character %c not range", c)`
+// isToken returns whether "name" is a token kind that the definition
+// being generated consumes from the token stream
+func (g *GoGenerator) isToken(name string) bool {
+	if g.lexing {
+		return false
+	}
+	for _, t := range g.s.Tokens {
+		if t == name {
+			return true
+		}
+	}
+	return false
+}
+
+// traceAccept wraps the code "a" checking for the terminal "what" so
+// that the Tracer is told when it doesn't match, if the DebugLevel
+// asks for it
+func (g *GoGenerator) traceAccept(what, a string) string {
+	if g.s.DebugLevel < DebugLevelAccept {
+		return a
+	}
+	return `{
+	tp := p.ParserData.Pos()
+	` + strings.Replace(a, "\n", "\n\t", -1) + `
+	if !accept {
+		p.Tracer.Trace(Event{Kind: EventMismatch, Name: ` + strconv.Quote(what) + `, Start: tp})
+	}
+}`
+}
+
+// traceBacktrack returns the code telling the Tracer that the sequence
+// starting at "save" is going back there, if the DebugLevel asks for
+// it
+func (g *GoGenerator) traceBacktrack() string {
+	if g.s.DebugLevel < DebugLevelAccept {
+		return ""
+	}
+	return `if pos := p.ParserData.Pos(); pos != save {
+	p.Tracer.Trace(Event{Kind: EventBacktrack, Name: "` + g.currentName + `", Start: save, End: pos})
+}
+`
+}
+
+// syntacticClass records an error if the character class "class"
+// is used outside the lexical section of a grammar having one, where
+// the input is made up of tokens rather than characters
+func (g *GoGenerator) syntacticClass(class string) {
+	if len(g.s.Tokens) > 0 && !g.lexing && g.err == nil {
+		g.err = fmt.Errorf("%s: character class %s outside the lexical section", g.currentName, class)
 	}
-	return `c := p.ParserData.Read()
-if c >= '` + a + `' && c <= '` + b + `' {
+}
+
+func (g *GoGenerator) CheckInRange(a, b string) string {
+	g.syntacticClass("[" + a + "-" + b + "]")
+	return g.traceAccept("["+a+"-"+b+"]", `c := p.ParserData.Read()
+if c >= '`+a+`' && c <= '`+b+`' {
 	accept = true
 } else {
 	p.ParserData.UnRead()
-	accept = false` + extra2 + `
-}`
+	accept = false
+}`)
 }
 
 func (g *GoGenerator) CheckInSet(a string) string {
@@ -275,48 +365,47 @@ func (g *GoGenerator) CheckInSet(a string) string {
 
 		tests += "c == '" + c2 + "'"
 	}
-	return `{
+	g.syntacticClass("[" + a + "]")
+	return g.traceAccept("["+a+"]", `{
 	accept = false
 	c := p.ParserData.Read()
-	if ` + tests + ` {
+	if `+tests+` {
 		accept = true
 	} else {
 		p.ParserData.UnRead()
 	}
-}`
+}`)
 }
 
 func (g *GoGenerator) CheckAnyChar() string {
-	return `if p.ParserData.Pos() >= p.ParserData.Len() {
+	if len(g.s.Tokens) > 0 && !g.lexing {
+		return `accept = p.matchToken("", "")`
+	}
+	return g.traceAccept(".", `if p.ParserData.Pos() >= p.ParserData.Len() {
 	accept = false
 } else {
 	p.ParserData.Read()
 	accept = true
-}`
+}`)
 }
 
 func (g *GoGenerator) CheckNext(a string) string {
-	var (
-		extra1, extra2 string
-	)
-	if g.s.DebugLevel >= DebugLevelAccept {
-		extra1 = `
-	log.Println(fm.Level()+"accept = false; out of range")`
+	if len(g.s.Tokens) > 0 && !g.lexing {
+		if a[0] == '\'' {
+			a = "string(" + a + ")"
+		}
+		return `accept = p.matchToken("", ` + a + `)`
 	}
-
 	if a[0] == '\'' {
-		return `if p.ParserData.Read() != ` + a + ` {
+		return g.traceAccept(a, `if p.ParserData.Read() != `+a+` {
 	p.ParserData.UnRead()
-	accept = false` + extra1 + `
+	accept = false
 } else {
 	accept = true
-}`
+}`)
 	}
+	what := a
 	a = a[1 : len(a)-1]
-	if g.s.DebugLevel >= DebugLevelAccept {
-		extra2 = fmt.Sprintf(`
-	log.Printf(fm.Level()+"accept = false; expected %s, have %%s", p.ParserData.Substring(s,e))`, a)
-	}
 	tests := ""
 	pos := 0
 	for i := 0; i < len(a); i, pos = i+1, pos+1 {
@@ -336,42 +425,237 @@ func (g *GoGenerator) CheckNext(a string) string {
 		}
 		tests += fmt.Sprintf("p.ParserData.Read() != '%s'", c2)
 	}
-	return fmt.Sprintf(`{
+	return g.traceAccept(what, fmt.Sprintf(`{
 	accept = true
 	s := p.ParserData.Pos()
 	if %s {
 		p.ParserData.Seek(s)
-		accept = false%s
+		accept = false
 	}
-}`, tests, extra2)
+}`, tests))
 }
 
 func (g *GoGenerator) AssertNot(a string) string {
-	return `s := p.ParserData.Pos()
-` + g.Call(a) + `
+	return g.lookahead(`s := p.ParserData.Pos()
+` + g.Call(a) + g.uncut() + `
 p.ParserData.Seek(s)
 p.Root.Discard(s)
-accept = !accept`
+accept = !accept`)
 }
 
 func (g *GoGenerator) AssertAnd(a string) string {
-	return `s := p.ParserData.Pos()
-` + g.Call(a) + `
+	return g.lookahead(`s := p.ParserData.Pos()
+` + g.Call(a) + g.uncut() + `
 p.ParserData.Seek(s)
-p.Root.Discard(s)`
+p.Root.Discard(s)`)
+}
+
+func (g *GoGenerator) Capture(name, a string) string {
+	if g.captures == nil {
+		g.captures = make(map[string]int)
+	}
+	idx, ok := g.captures[name]
+	if !ok {
+		idx = len(g.captures)
+		g.captures[name] = idx
+	}
+	g.captured++
+	return fmt.Sprintf(`{
+	s := p.ParserData.Pos()
+	%s
+	if accept {
+		captures[%d] = text.Region{A: s, B: p.ParserData.Pos()}
+	}
+}`, strings.Replace(g.Call(a), "\n", "\n\t", -1), idx)
+}
+
+func (g *GoGenerator) BackReference(name string) string {
+	idx, ok := g.captures[name]
+	if !ok {
+		if g.err == nil {
+			g.err = fmt.Errorf("%s: back-reference to unknown capture %q", g.currentName, name)
+		}
+		return "accept = false"
+	}
+	return fmt.Sprintf(`{
+	accept = false
+	if r := captures[%d]; r.A >= 0 {
+		s := p.ParserData.Pos()
+		ref := p.ParserData.Substring(r.A, r.B)
+		if e := s + len(ref); p.ParserData.Substring(s, e) == ref {
+			p.ParserData.Seek(e)
+			accept = true
+		}
+	}
+}`, idx)
+}
+
+// line returns the line of the grammar "offset" is on
+func (g *GoGenerator) line(offset int) int {
+	if offset > len(g.s.Grammar) {
+		return 0
+	}
+	return strings.Count(g.s.Grammar[:offset], "\n") + 1
+}
+
+func (g *GoGenerator) Instrument(node *Node, a string) string {
+	if !g.s.Coverage {
+		return a
+	}
+	r := node.Range
+	r.B = r.A + len(strings.TrimRight(g.s.Grammar[r.A:r.B], " \t\r\n"))
+	if node.Name == "Primary" && g.s.Grammar[r.A] == '(' {
+		// The closing parenthesis is ignored, leaving it out of the node
+		if i := strings.IndexByte(g.s.Grammar[r.B:], ')'); i >= 0 {
+			r.B += i + 1
+		}
+	}
+	line, col := 1, 1
+	for _, c := range g.s.Grammar[:r.A] {
+		col++
+		if c == '\n' {
+			line++
+			col = 1
+		}
+	}
+	g.coverage = append(g.coverage, CoveragePoint{Definition: g.currentName, Range: r, Line: line, Column: col})
+	return fmt.Sprintf(`{
+	%s
+	if accept {
+		Coverage.Hit(%d)
+	}
+}`, strings.Replace(g.Call(a), "\n", "\n\t", -1), len(g.coverage)-1)
+}
+
+func (g *GoGenerator) SemanticAnd(code string) string {
+	return "accept = (" + code + ")"
+}
+
+func (g *GoGenerator) SemanticNot(code string) string {
+	return "accept = !(" + code + ")"
+}
+
+func (g *GoGenerator) Precedence(operand string, levels []PrecedenceLevel) string {
+	type operator struct {
+		lit         string
+		level, next int
+	}
+	// Longest operators are tried first so that e.g. "<<" isn't
+	// mistaken for "<"
+	var ops []operator
+	for i, l := range levels {
+		next := i + 1
+		if l.RightAssoc {
+			next = i
+		}
+		for _, lit := range l.Operators {
+			j := len(ops)
+			ops = append(ops, operator{lit, i, next})
+			for ; j > 0 && len(ops[j-1].lit) < len(lit); j-- {
+				ops[j], ops[j-1] = ops[j-1], ops[j]
+			}
+		}
+	}
+
+	name := g.currentName + "Climb"
+	// Operations are shaped like the nodes of other definitions, but
+	// always have more than one child so Collapse doesn't apply
+	shape := g.s.Shapes[g.currentName]
+	nodeName := g.currentName
+	if shape.Rename != "" {
+		nodeName = shape.Rename
+	}
+	node := `node := p.arena.Cleanup(&p.Root, start, end)
+node.Name = "` + nodeName + `"
+node.P = p
+// Span from the first operand to the last, leaving out surrounding spacing
+node.Range = text.Region{A: node.Children[0].Range.A, B: node.Children[len(node.Children)-1].Range.B}
+p.Root.Append(node)
+if p.limiter != nil {
+	p.limiter.Node(end)
+}
+`
+	if shape.Lift {
+		// The operands and operators stay where they are
+		node = ""
+	}
+	var cf CodeFormatter
+	cf.Add("func (p *" + g.s.Name + ") " + name + "(min int) bool {\n")
+	cf.Inc()
+	cf.Add(`accept := false
+start := p.ParserData.Pos()
+` + g.Call(operand) + `
+if !accept {
+	return false
+}
+for {
+`)
+	cf.Inc()
+	cf.Add("save := p.ParserData.Pos()\nlevel, next := -1, 0\n")
+	for i, op := range ops {
+		cf.Add(g.CheckNext(op.lit) + "\n")
+		cf.Add(fmt.Sprintf("if accept {\n\tlevel, next = %d, %d\n}", op.level, op.next))
+		if i < len(ops)-1 {
+			cf.Add(" else {\n")
+			cf.Inc()
+		}
+	}
+	for i := 0; i < len(ops)-1; i++ {
+		cf.Dec()
+		cf.Add("\n}")
+	}
+	cf.Add(`
+if level < min {
+	p.ParserData.Seek(save)
+	return true
+}
+p.Root.Append(p.arena.New(Node{Name: "Operator", P: p, Range: text.Region{A: save, B: p.ParserData.Pos()}.Clip(p.IgnoreRange)}))
+if p.limiter != nil {
+	p.limiter.Node(p.ParserData.Pos())
+}
+if !p.` + name + `(next) {
+	p.ParserData.Seek(save)
+	p.Root.Discard(save)
+	return true
+}
+end := p.ParserData.Pos()
+` + node + `if p.IgnoreRange.A >= end || p.IgnoreRange.B <= start {
+	p.IgnoreRange = text.Region{}
+}
+`)
+	cf.Dec()
+	cf.Add("}\n")
+	cf.Dec()
+	cf.Add("}\n\n")
+	g.currentFunctions += cf.String()
+	call := "accept = p." + name + "(0)"
+	if g.commits() {
+		// Climbing goes back when an operator binds too loosely
+		call = "{\n\tp.backtrack++\n\t" + call + "\n\tp.backtrack--\n}"
+	}
+	if shape.Drop && !shape.Lift {
+		return "{\n\tstart := p.ParserData.Pos()\n\t" + strings.Replace(call, "\n", "\n\t", -1) + "\n\tp.Root.Discard(start)\n}"
+	}
+	return call
 }
 
 func (g *GoGenerator) ZeroOrMore(a string) string {
 	var cf CodeFormatter
 	cf.Add("{\n")
 	cf.Inc()
+	if g.cut {
+		cf.Add("save := p.ParserData.Pos()\n")
+	}
+	if g.commits() {
+		cf.Add("depth := p.backtrack\n")
+	}
 	cf.Add("accept = true")
 	cf.Add("\nfor accept {\n")
 	cf.Inc()
-	cf.Add(g.Call(a))
+	cf.Add(g.reopen() + g.Call(a))
 	cf.Dec()
 	cf.Add("\n}\n")
-	cf.Add("accept = true\n")
+	cf.Add(g.endRepetition())
 	cf.Dec()
 	cf.Add("}")
 	return cf.String()
@@ -381,20 +665,21 @@ func (g *GoGenerator) OneOrMore(a string) string {
 	var cf CodeFormatter
 	cf.Add("{\n")
 	cf.Inc()
+	if g.commits() {
+		cf.Add("depth := p.backtrack\n")
+	}
 	cf.Add(`save := p.ParserData.Pos()
 ` + g.Call(a) + `
-if !accept {
+if !accept {` + strings.Replace(g.uncut(), "\n", "\n\t", -1) + `
 	p.ParserData.Seek(save)
 } else {
 	for accept {
 `)
 	cf.Inc()
 	cf.Inc()
-	cf.Add(g.Call(a) + "\n")
+	cf.Add(g.reopen() + g.Call(a) + "\n")
 	cf.Dec()
-	cf.Add(`}
-accept = true
-`)
+	cf.Add("}\n" + g.endRepetition())
 	cf.Dec()
 	cf.Add("}\n")
 	cf.Dec()
@@ -403,17 +688,95 @@ accept = true
 }
 
 func (g *GoGenerator) Maybe(a string) string {
-	return g.Call(a) + "\naccept = true"
+	ret := g.Call(a) + "\naccept = true"
+	if g.cut {
+		// Failing after a cut fails the option as well
+		ret = g.Call(a) + "\naccept = !cut\ncut = false"
+	}
+	if g.commits() {
+		return "{\n\tdepth := p.backtrack\n\tp.backtrack++\n\t" + strings.Replace(ret, "\n", "\n\t", -1) + "\n\tp.backtrack = depth\n}"
+	}
+	return ret
+}
+
+// commits returns whether the definition being generated counts the
+// choices, repetitions, options and predicates that might go back in
+// p.backtrack, for its cuts to tell when nothing might. The tokenizer
+// goes back regardless, so lexical definitions don't.
+func (g *GoGenerator) commits() bool {
+	return g.s.Cuts && !g.lexing
+}
+
+// reopen returns the code counting an attempt to repeat as something
+// that might go back, once more if a cut in the previous one didn't
+func (g *GoGenerator) reopen() string {
+	if g.commits() {
+		return "p.backtrack = depth + 1\n"
+	}
+	return ""
+}
+
+// lookahead returns the predicate "a" generated by AssertAnd or
+// AssertNot, which always goes back even if a cut in it is reached
+func (g *GoGenerator) lookahead(a string) string {
+	if g.commits() {
+		return "{\n\tdepth := p.backtrack + 1\n\tp.backtrack = depth\n\t" + strings.Replace(a, "\n", "\n\t", -1) + "\n\tp.backtrack = depth - 1\n}"
+	}
+	return a
+}
+
+// uncut returns the code resetting the cut variable after an
+// expression of a predicate, where failing after a cut just fails the
+// expression
+func (g *GoGenerator) uncut() string {
+	if g.cut {
+		return "\ncut = false"
+	}
+	return ""
+}
+
+// endRepetition returns the code ending a repetition starting at
+// "save" once an attempt to repeat fails, failing it as a whole if the
+// attempt failed after a cut
+func (g *GoGenerator) endRepetition() string {
+	restore := ""
+	if g.commits() {
+		restore = "p.backtrack = depth\n"
+	}
+	if g.cut {
+		return restore + `if cut {
+	cut = false
+	p.ParserData.Seek(save)
+} else {
+	accept = true
+}
+`
+	}
+	return restore + "accept = true\n"
 }
 
 type needAllGroup struct {
 	cf    CodeFormatter
-	g     Generator
+	g     *GoGenerator
 	stack list.List
 	label string
+	cut   bool
+	// The number of captures generated before the group
+	captured int
 }
 
 func (b *needAllGroup) Add(value, name string) {
+	if b.cut && b.g.cut {
+		// Tell the enclosing choice, repetition or predicate
+		b.cf.Add(b.g.Call(value) + `
+if !accept {
+	cut = true
+} else {
+`)
+		b.cf.Inc()
+		b.stack.PushBack(name)
+		return
+	}
 	b.cf.Add(b.g.Call(value) + `
 if accept {
 `)
@@ -421,22 +784,40 @@ if accept {
 	b.stack.PushBack(name)
 }
 
+func (b *needAllGroup) Cut() {
+	b.cut = true
+	if b.g.commits() {
+		// The innermost choice, repetition or option can't go back
+		// anymore, and if nothing else can the parser commits
+		b.cf.Add("p.backtrack = depth\nif depth == 0 {\n\tp.commit()\n}\n")
+	}
+}
+
 type needOneGroup struct {
 	cf CodeFormatter
-	g  Generator
+	g  *GoGenerator
 }
 
 func (b *needOneGroup) Add(value, name string) {
-	b.cf.Add(b.g.Call(value) + "\nif !accept {\n")
+	if b.g.cut {
+		// Only try the next alternative if this one didn't fail
+		// after a cut
+		b.cf.Add(b.g.Call(value) + "\nif !accept && !cut {\n")
+	} else {
+		b.cf.Add(b.g.Call(value) + "\nif !accept {\n")
+	}
 	b.cf.Inc()
 }
 
+func (b *needOneGroup) Cut() {
+	panic("Shouldn't reach this")
+}
+
 func (g *GoGenerator) BeginGroup(requireAll bool) Group {
 	if requireAll {
-		r := needAllGroup{g: g}
-		r.cf.Add(`{
-	save := p.ParserData.Pos()
-`)
+		// The group starts with saving the position, and the
+		// captures if it turns out to make any, in EndGroup
+		r := needAllGroup{g: g, captured: g.captured}
 		r.cf.Inc()
 		return &r
 	}
@@ -444,6 +825,9 @@ func (g *GoGenerator) BeginGroup(requireAll bool) Group {
 	r.cf.Add(`{
 	save := p.ParserData.Pos()
 `)
+	if g.commits() {
+		r.cf.Add("\tdepth := p.backtrack\n\tp.backtrack++\n")
+	}
 	r.cf.Inc()
 	return &r
 }
@@ -461,20 +845,28 @@ func (g *GoGenerator) EndGroup(gr Group) string {
 			t.cf.Dec()
 			t.cf.Add("}\n")
 		}
+		restore, save := "", "save := p.ParserData.Pos()"
+		if g.captured > t.captured {
+			// Forget what the group captured when backtracking
+			restore, save = "captures = saved\n", "save, saved := p.ParserData.Pos(), captures"
+		}
 		t.cf.Add("if !accept {\n")
 		t.cf.Inc()
-		t.cf.Add(g.UpdateError("TODO") + "\np.ParserData.Seek(save)\n")
+		t.cf.Add(g.UpdateError("TODO") + "\n" + g.traceBacktrack() + restore + "p.ParserData.Seek(save)\n")
 		t.cf.Dec()
 		t.cf.Add("}\n")
 		t.cf.Dec()
 		t.cf.Add("}")
-		return t.cf.String()
+		return "{\n\t" + save + "\n\t" + t.cf.String()
 	case *needOneGroup:
 		for len(t.cf.Level()) > 1 {
 			t.cf.Dec()
 			t.cf.Add("}\n")
 		}
-		t.cf.Add("if !accept {\n\tp.ParserData.Seek(save)\n}\n")
+		t.cf.Add("if !accept {" + strings.Replace(g.uncut(), "\n", "\n\t", -1) + "\n\tp.ParserData.Seek(save)\n}\n")
+		if g.commits() {
+			t.cf.Add("p.backtrack = depth\n")
+		}
 		t.cf.Dec()
 		t.cf.Add("}")
 		return t.cf.String()
@@ -506,16 +898,34 @@ func (g *GoGenerator) Begin(s GeneratorSettings) error {
 	imports := `
 
 import (
+	"context"
 	"github.com/limetext/text"
 	. "github.com/quarnster/parser"
 `
 	impList := g.Imports
 	members := g.ParserVariables
-	if g.s.Heatmap {
-		members = append(members, "Heatmap map[string]Heat")
-		impList = append(impList, "fmt", "time", "sort")
+	if g.s.State != "" {
+		members = append(members, "State       "+g.s.State)
+	}
+	g.lexical = make(map[string]bool)
+	g.coverage = nil
+	for _, n := range append(g.s.Tokens, g.s.Trivia...) {
+		g.lexical[n] = true
+	}
+	if len(g.s.Tokens) > 0 {
+		members = append(members, "Tokens      []Token", "Trailing    []Token", "tokenAt     map[int]int")
+	}
+	g.profile = nil
+	if g.s.Profile {
+		members = append(members, "Profile     *Profiler")
 	}
 	if g.s.DebugLevel > DebugLevelNone {
+		members = append(members, "Tracer      Tracer")
+	}
+	if g.s.Cuts {
+		members = append(members, "backtrack   int")
+	}
+	if g.s.DebugLevel >= DebugLevelEnterExit {
 		impList = append(impList, "log")
 	}
 	if len(impList) > 0 {
@@ -526,61 +936,50 @@ import (
 	g.output = g.s.Header + "\n"
 	members = append(members, "ParserData  Reader", "IgnoreRange text.Region",
 		"Root        Node",
-		"LastError   int")
-	g.output += fmt.Sprintln("package " + strings.ToLower(g.s.Name) + imports + "\ntype " + g.s.Name + " struct {\n\t" + strings.Join(members, "\n\t") + "\n}\n")
-
-	if g.s.DebugLevel > DebugLevelNone {
-		g.output += "var fm CodeFormatter\n\n"
-	}
-	if g.s.Heatmap {
-		g.output += `type Heat struct {
-	Name string
-	Calls int
-	Time time.Duration
-}
-
-type TotHeat struct {
-	Heat []Heat
-}
+		"LastError   int",
+		"Limits      Limits",
+		"limiter     *Limiter",
+		"arena       NodeArena")
+	g.output += fmt.Sprintln("package " + g.s.Package + imports + "\ntype " + g.s.Name + " struct {\n\t" + strings.Join(members, "\n\t") + "\n}\n")
 
-func (t *TotHeat) Len() int {
-	return len(t.Heat)
-}
-
-func (t *TotHeat) Less(i, j int) bool {
-	return t.Heat[i].Time >= t.Heat[j].Time
+	g.output += `func (p *` + g.s.Name + `) RootNode() *Node {
+	return &p.Root
 }
 
-func (t *TotHeat) Swap(i, j int) {
-	t.Heat[i], t.Heat[j] = t.Heat[j], t.Heat[i]
+func (p *` + g.s.Name + `) SetData(data string) {
+	p.SetReader(NewReader(data))
 }
 
-func (t *TotHeat) Add(h Heat) {
-	t.Heat = append(t.Heat, h)
+// SetBytes is SetData for a []byte, which the parser reads without
+// copying. It must not change while the parser is in use, nor while
+// the slices DataBytes returns are.
+func (p *` + g.s.Name + `) SetBytes(data []byte) {
+	p.SetReader(NewBytesReader(data))
 }
 
-func (t *TotHeat) String() (ret string) {
-	sort.Sort(t)
-	for _, h := range t.Heat {
-		ret += fmt.Sprintf("%v\n", h)
-	}
-	return ret
-}
+// SetReader makes the parser start over with the data of "r"
+func (p *` + g.s.Name + `) SetReader(r Reader) {
+	p.ParserData = r
 `
+	if g.s.Profile {
+		g.output += "	if p.Profile == nil {\n		p.Profile = NewProfiler(grammarFile, profileFunctions)\n	}\n	p.Profile.Begin()\n"
 	}
-	g.output += `func (p *` + g.s.Name + `) RootNode() *Node {
-	return &p.Root
-}
-
-func (p *` + g.s.Name + `) SetData(data string) {
-	p.ParserData = NewReader(data)
-`
-	if g.s.Heatmap {
-		g.output += "	p.Heatmap = make(map[string]Heat)\n"
+	if g.s.DebugLevel > DebugLevelNone {
+		g.output += "	if p.Tracer == nil {\n		p.Tracer = &TextTracer{}\n	}\n"
 	}
 	g.output += `	p.Root = Node{Name: "` + g.s.Name + `", P: p}
 	p.IgnoreRange = text.Region{}
 	p.LastError = 0
+	p.limiter = NewLimiter(context.Background(), p.Limits, p.ParserData)
+	p.arena.Drop()
+}
+
+// Release hands the nodes of the tree parsed last back to the parser,
+// which reuses them when parsing again. Neither the tree nor any node
+// of it may be used afterwards.
+func (p *` + g.s.Name + `) Release() {
+	p.arena.Release()
+	p.Root = Node{Name: "` + g.s.Name + `", P: p}
 }
 
 func (p *` + g.s.Name + `) Parse(data string) bool {
@@ -590,11 +989,41 @@ func (p *` + g.s.Name + `) Parse(data string) bool {
 	return ret
 }
 
+// ParseContext parses data like Parse, but gives up when "ctx" is done
+// or the parse exceeds p.Limits, the Error then being a *LimitError
+func (p *` + g.s.Name + `) ParseContext(ctx context.Context, data string) bool {
+	p.SetData(data)
+	p.limiter = NewLimiter(ctx, p.Limits, p.ParserData)
+	ret := p.realParse()
+	p.Root.UpdateRange()
+	return ret
+}
+
+// ParseBytes is Parse for a []byte, which isn't copied. See SetBytes.
+func (p *` + g.s.Name + `) ParseBytes(data []byte) bool {
+	p.SetBytes(data)
+	ret := p.realParse()
+	p.Root.UpdateRange()
+	return ret
+}
+
 func (p *` + g.s.Name + `) Data(start, end int) string {
 	return p.ParserData.Substring(start, end)
 }
 
+// DataBytes returns the data between "start" and "end", without
+// copying it if the parser is reading a []byte
+func (p *` + g.s.Name + `) DataBytes(start, end int) []byte {
+	if r, ok := p.ParserData.(ByteReader); ok {
+		return r.Bytes(start, end)
+	}
+	return []byte(p.ParserData.Substring(start, end))
+}
+
 func (p *` + g.s.Name + `) Error() Error {
+	if err := p.limiter.Err(); err != nil {
+		return err
+	}
 	errstr := ""
 	line, column := p.ParserData.LineCol(p.LastError)
 
@@ -608,15 +1037,204 @@ func (p *` + g.s.Name + `) Error() Error {
 			errstr = "Unexpected " + string(r)
 		}
 	}
-	return NewError(line, column, errstr)
+	return NewErrorAt(p.LastError, line, column, errstr)
 }
 
 `
+	if len(g.s.Tokens) > 0 {
+		g.output += g.tokenizer()
+	}
 	return nil
 }
 
+// tokenizer returns the functions splitting the data into the token
+// stream that the syntactic definitions consume. The longest token
+// wins, the first one declared if there's a tie.
+func (g *GoGenerator) tokenizer() string {
+	var cf CodeFormatter
+	cf.Add(`// tokenize splits the data into p.Tokens, attaching the trivia
+// preceding each token to it and any trailing trivia to p.Trailing
+func (p *` + g.s.Name + `) tokenize() bool {
+	p.Tokens, p.Trailing = nil, nil
+	p.tokenAt = make(map[int]int)
+	var trivia []Token
+	for p.ParserData.Pos() < p.ParserData.Len() {
+		start := p.ParserData.Pos()
+`)
+	cf.Inc()
+	cf.Inc()
+	for _, t := range g.s.Trivia {
+		cf.Add(`if p.` + t + `() && p.ParserData.Pos() > start {
+	trivia = append(trivia, Token{Kind: "` + t + `", Range: text.Region{A: start, B: p.ParserData.Pos()}})
+	continue
+}
+p.ParserData.Seek(start)
+`)
+	}
+	cf.Add("kind, end := \"\", start\n")
+	for _, t := range g.s.Tokens {
+		cf.Add(`if p.` + t + `() && p.ParserData.Pos() > end {
+	kind, end = "` + t + `", p.ParserData.Pos()
+}
+p.ParserData.Seek(start)
+`)
+	}
+	cf.Dec()
+	cf.Dec()
+	cf.Add(`		if kind == "" {
+			if p.LastError < start {
+				p.LastError = start
+			}
+			return false
+		}
+		p.tokenAt[start] = len(p.Tokens)
+		p.Tokens = append(p.Tokens, Token{Kind: kind, Range: text.Region{A: start, B: end}, Trivia: trivia})
+		trivia = nil
+		p.ParserData.Seek(end)
+	}
+	p.Trailing = trivia
+	p.IgnoreRange = text.Region{}
+	p.LastError = 0
+	if len(p.Tokens) > 0 {
+		p.ParserData.Seek(p.Tokens[0].Range.A)
+	}
+	return true
+}
+
+// matchToken consumes the token at the current position if it is of
+// the given kind and has the given text, skipping the trivia following
+// it. An empty kind or text matches any.
+func (p *` + g.s.Name + `) matchToken(kind, data string) bool {
+	i, ok := p.tokenAt[p.ParserData.Pos()]
+	if !ok {
+		return false
+	}
+	t := p.Tokens[i]
+	if kind != "" && t.Kind != kind || data != "" && p.ParserData.Substring(t.Range.A, t.Range.B) != data {
+		return false
+	}
+	if kind != "" {
+		p.Root.Append(p.arena.New(Node{Name: kind, P: p, Range: t.Range}))
+		if p.limiter != nil {
+			p.limiter.Node(t.Range.B)
+		}
+	}
+	next := p.ParserData.Len()
+	if i+1 < len(p.Tokens) {
+		next = p.Tokens[i+1].Range.A
+	}
+	if next > t.Range.B {
+		p.IgnoreRange = text.Region{A: t.Range.B, B: next}
+	}
+	p.ParserData.Seek(next)
+	return true
+}
+
+`)
+	return cf.String()
+}
+
+// realParse returns the functions that kick off parsing at the start
+// definition or the one asked for, recovering from exceeding the
+// limits.
+func (g *GoGenerator) realParse() string {
+	cases := ""
+	for _, r := range g.rules {
+		cases += "\tcase \"" + r + "\":\n\t\trule = p." + r + "\n"
+	}
+	call := "rule()"
+	if len(g.s.Tokens) > 0 {
+		call = "p.tokenize() && " + call
+	}
+	ret := `func (p *` + g.s.Name + `) realParse() bool {
+	return p.parse(p.` + g.startName + `)
+}
+
+// ParseRule parses data starting at the definition "name", returning
+// false if there's no such definition
+func (p *` + g.s.Name + `) ParseRule(name, data string) bool {
+	var rule func() bool
+	switch name {
+` + cases + `	default:
+		return false
+	}
+	p.SetData(data)
+	ret := p.parse(rule)
+	p.Root.UpdateRange()
+	return ret
+}
+
+`
+	reset := ""
+	if g.s.Cuts {
+		reset = "\n\tp.backtrack = 0"
+		ret += `// commit tells a Committer reader that the parser won't go back
+// before the current position
+func (p *` + g.s.Name + `) commit() {
+	if c, ok := p.ParserData.(Committer); ok {
+		c.Commit(p.ParserData.Pos())
+	}
+}
+
+`
+	}
+	return ret + `func (p *` + g.s.Name + `) parse(rule func() bool) (accept bool) {` + reset + `
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(*LimitError); !ok {
+				panic(r)
+			}
+			accept = false
+		}
+	}()
+	return ` + call + `
+}
+`
+}
+
+// coverageProfile returns the declaration of the CoverageProfile
+// the instrumented parser counts the matches in
+func (g *GoGenerator) coverageProfile() string {
+	ret := fmt.Sprintf(`// Coverage counts how often the parts of the grammar matched
+var Coverage = &CoverageProfile{
+	Grammar: %q,
+	Points: []CoveragePoint{
+`, g.s.Grammar)
+	for _, p := range g.coverage {
+		ret += fmt.Sprintf("\t\t{Definition: %q, Range: text.Region{A: %d, B: %d}, Line: %d, Column: %d},\n", p.Definition, p.Range.A, p.Range.B, p.Line, p.Column)
+	}
+	return ret + "\t},\n}\n\n"
+}
+
+// profileFunctions returns the declarations of the grammar file and
+// definitions the parser's Profiler records
+func (g *GoGenerator) profileFunctions() string {
+	file := g.s.GrammarFile
+	if file == "" {
+		file = strings.ToLower(g.s.Name) + ".peg"
+	}
+	ret := fmt.Sprintf(`// The grammar and definitions the Profile refers to
+const grammarFile = %q
+
+var profileFunctions = []ProfileFunction{
+`, file)
+	for _, f := range g.profile {
+		ret += fmt.Sprintf("\t{Name: %q, Line: %d},\n", f.Name, f.Line)
+	}
+	return ret + "}\n\n"
+}
+
 func (g *GoGenerator) Finish() error {
 	ret := g.output
+	if g.havefunctions {
+		ret = ret[:g.realParseAt] + g.realParse() + ret[g.realParseAt:]
+	}
+	if g.s.Coverage {
+		ret += g.coverageProfile()
+	}
+	if g.s.Profile {
+		ret += g.profileFunctions()
+	}
 	if ret[len(ret)-2:] == "\n\n" {
 		ret = ret[:len(ret)-1]
 	}
@@ -630,110 +1248,417 @@ func (g *GoGenerator) Finish() error {
 	}
 
 	dumptree_s := ""
-	heatmap_s := ""
+	profile_s, useprofile_s := "", ""
 	if g.s.Debug {
-		dumptree_s = "t.Log(\"\\n\"+root.String())"
-	}
-	if g.s.Heatmap {
-		heatmap_s = `var wasted time.Duration
-			var th TotHeat
-			for k, v := range p.Heatmap {
-				if strings.Contains(k, "-") {
-					wasted += time.Duration(int64(v.Calls-1)*int64(v.Time) / int64(v.Calls))
-				} else {
-					v.Name = k
-					th.Add(v)
-				}
-			}
-			t.Logf("Wasted %s", wasted)
-			t.Log(&th)
-			`
+		switch g.s.DumpFormat {
+		case "html", "dot":
+			method := map[string]string{"html": "HTML", "dot": "Dot"}[g.s.DumpFormat]
+			dumptree_s = fmt.Sprintf("if err := ioutil.WriteFile(strings.TrimSuffix(fn, filepath.Ext(fn))+%q, []byte(root.%s()), 0644); err != nil {\n\t\t\tt.Error(err)\n\t\t}", "."+g.s.DumpFormat, method)
+		default:
+			dumptree_s = "t.Log(\"\\n\"+root.String())"
+		}
 	}
-	if g.s.Testname != "" {
-		test := `package ` + strings.ToLower(g.s.Name) + `
-import (
-	"archive/zip"
-	"io/ioutil"
-	"net/http"
-	"testing"
-	"strings"
-	"time"
-)
-
-var _ = time.Time{}
-const testname = "` + g.s.Testname + `"
-
-func loadData(path string) (retdata string, err error) {
-	var data []byte
-	if strings.HasPrefix(path, "http://") {
-		p2 := strings.Replace(strings.Replace(path, "http://", "http_", -1), "/", "_", -1)
-		if retdata, err = loadData(p2); err != nil {
-			if res, err := http.Get(path); err != nil {
-				return "", err
-			} else {
-				defer res.Body.Close()
-				if data, err = ioutil.ReadAll(res.Body); err != nil {
-					return "", err
-				} else if err = ioutil.WriteFile(p2, data, 0644); err != nil {
-					return "", err
-				} else {
-					return loadData(p2)
-				}
-			}
-		} else {
+	if g.s.Profile {
+		profile_s = `
+	profile := NewProfiler(grammarFile, profileFunctions)
+	defer func() {
+		f, err := os.Create("profile.pb.gz")
+		if err != nil {
+			t.Error(err)
 			return
 		}
-	} else if strings.HasSuffix(path, ".zip") {
-		if zf, err := zip.OpenReader(path); err != nil {
-			return "", err
+		defer f.Close()
+		if err := profile.WriteProfile(f); err != nil {
+			t.Error(err)
 		} else {
-			defer zf.Close()
-			f, err := zf.File[0].Open()
-			if err != nil {
-				return "", err
-			}
-			defer f.Close()
-			if data, err = ioutil.ReadAll(f); err != nil {
-				return "", err
-			}
+			t.Log("Wrote the profile of the grammar to profile.pb.gz, which go tool pprof shows")
 		}
-	} else {
-		data, err = ioutil.ReadFile(path)
+	}()`
+		useprofile_s = "\n\t\tp.Profile = profile"
 	}
-	return string(data), err
-}
+	if g.s.Testname != "" || g.s.Samples != "" {
+		// A set, as the tests turned on might share imports
+		imports := map[string]bool{`. "github.com/quarnster/parser"`: true, `"io/ioutil"`: true, `"path/filepath"`: true, `"testing"`: true}
+		use := func(imps ...string) {
+			for _, imp := range imps {
+				imports[imp] = true
+			}
+		}
+		parser_s, samples_s, coverage_s, seeds := "", "", "", ""
+		if g.s.Testname != "" {
+			use(`"context"`, `"errors"`, `"flag"`, `"strings"`, `"sync"`)
+			if g.s.Profile {
+				use(`"os"`)
+			}
+			parser_s = `
+const testname = "` + g.s.Testname + `"
 
+var update = flag.Bool("update", false, "Write the trees of the test inputs to their .out files instead of comparing with them")
+
+// TestParser parses the test inputs, comparing the trees with those
+// in the file of the same name but with an .out extension
 func TestParser(t *testing.T) {
-	var p ` + g.s.Name + `
-	if data, err := loadData(testname); err != nil {
+	files, err := filepath.Glob(testname)
+	if err != nil {
 		t.Fatal(err)
-	} else {
+	} else if len(files) == 0 {
+		t.Skipf("No test inputs match %s", testname)
+	}` + profile_s + `
+	for _, fn := range files {
+		data, err := ioutil.ReadFile(fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var p ` + g.s.Name + useprofile_s + `
 		root := p.RootNode()
-		if !p.Parse(data) {
-			` + dumptree_s + `
-			t.Fatalf("Didn't parse correctly: %s\n", p.Error())
-		} else {
+		if !p.Parse(string(data)) {
 			` + dumptree_s + `
-			` + heatmap_s + `
-			if root.Range.B != p.ParserData.Len() {
-				t.Fatalf("Parsing didn't finish: %v\n%s", root, p.Error())
+			t.Errorf("%s didn't parse correctly: %s\n", fn, p.Error())
+			continue
+		}
+		` + dumptree_s + `
+		if root.Range.B != p.ParserData.Len() {
+			t.Errorf("Parsing %s didn't finish: %v\n%s", fn, root, p.Error())
+			continue
+		}
+		var pb ` + g.s.Name + `
+		if pb.ParseBytes(data); pb.RootNode().String() != root.String() {
+			t.Errorf("Parsing %s as a []byte gave another tree:\n%s", fn, pb.RootNode())
+		}
+		// Parse again reusing the released nodes, then reusing them
+		// while the first tree is still in use
+		for i := 0; i < 2; i++ {
+			if i == 0 {
+				pb.Release()
+			}
+			if pb.Parse(string(data)); pb.RootNode().String() != root.String() {
+				t.Errorf("Parsing %s again gave another tree:\n%s", fn, pb.RootNode())
+			}
+		}
+		out := strings.TrimSuffix(fn, filepath.Ext(fn)) + ".out"
+		if *update {
+			if err := ioutil.WriteFile(out, []byte(root.String()), 0644); err != nil {
+				t.Error(err)
 			}
+		} else if exp, err := ioutil.ReadFile(out); err != nil {
+			t.Errorf("%s, run the test with -update to create it", err)
+		} else if string(exp) != root.String() {
+			t.Errorf("The tree of %s differs from %s:\n%s", fn, out, root)
+		}
+	}
+}
+
+// TestLimits makes sure the parser gives up on the test inputs with a
+// *LimitError when they exceed its limits or the context is done
+func TestLimits(t *testing.T) {
+	files, err := filepath.Glob(testname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, fn := range files {
+		data, err := ioutil.ReadFile(fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var p ` + g.s.Name + `
+		if p.ParseContext(canceled, string(data)) {
+			t.Errorf("Parsing %s with a canceled context didn't fail", fn)
+		} else if err, ok := p.Error().(*LimitError); !ok || !errors.Is(err, context.Canceled) {
+			t.Errorf("Parsing %s with a canceled context failed with %v", fn, p.Error())
+		}
+		for limit, limits := range map[string]Limits{"steps": {Steps: 1}, "depth": {Depth: 1}, "nodes": {Nodes: 1}} {
+			p.Limits = limits
+			// Small grammars might parse within the limits
+			if !p.ParseContext(context.Background(), string(data)) {
+				if err, ok := p.Error().(*LimitError); !ok || err.Limit != limit {
+					t.Errorf("Parsing %s within %+v failed with %v", fn, limits, p.Error())
+				}
+			}
+		}
+		p.Limits = Limits{}
+		if !p.Parse(string(data)) {
+			t.Errorf("%s didn't parse correctly without limits: %s", fn, p.Error())
+		}
+	}
+}
+
+// TestParallel parses each test input with several parsers at once,
+// which go test -race checks don't share any state
+func TestParallel(t *testing.T) {
+	files, err := filepath.Glob(testname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fn := range files {
+		data, err := ioutil.ReadFile(fn)
+		if err != nil {
+			t.Fatal(err)
 		}
+		var p ` + g.s.Name + `
+		p.Parse(string(data))
+		exp := p.RootNode().String()
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				var p ` + g.s.Name + `
+				p.Parse(string(data))
+				if root := p.RootNode().String(); root != exp {
+					t.Errorf("Parsing %s in parallel gave another tree:\n%s", fn, root)
+				}
+			}()
+		}
+		wg.Wait()
 	}
 }
 
 func BenchmarkParser(b *testing.B) {
+	files, err := filepath.Glob(testname)
+	if err != nil {
+		b.Fatal(err)
+	}
+	var inputs []string
+	for _, fn := range files {
+		data, err := ioutil.ReadFile(fn)
+		if err != nil {
+			b.Fatal(err)
+		}
+		inputs = append(inputs, string(data))
+	}
 	var p ` + g.s.Name + `
-	if data, err := loadData(testname); err != nil {
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, data := range inputs {
+			p.Parse(data)
+		}
+	}
+}
+
+// BenchmarkRelease is BenchmarkParser releasing every tree once parsed
+func BenchmarkRelease(b *testing.B) {
+	files, err := filepath.Glob(testname)
+	if err != nil {
 		b.Fatal(err)
-	} else {
-		for i := 0; i < b.N; i++ {
+	}
+	var inputs []string
+	for _, fn := range files {
+		data, err := ioutil.ReadFile(fn)
+		if err != nil {
+			b.Fatal(err)
+		}
+		inputs = append(inputs, string(data))
+	}
+	var p ` + g.s.Name + `
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, data := range inputs {
 			p.Parse(data)
+			p.Release()
 		}
 	}
 }
 
+// BenchmarkBytes parses the inputs read as a []byte, getting the data
+// of every node, either copying them into strings or not copying at all
+func BenchmarkBytes(b *testing.B) {
+	files, err := filepath.Glob(testname)
+	if err != nil {
+		b.Fatal(err)
+	}
+	var inputs [][]byte
+	for _, fn := range files {
+		data, err := ioutil.ReadFile(fn)
+		if err != nil {
+			b.Fatal(err)
+		}
+		inputs = append(inputs, data)
+	}
+	var (
+		p    ` + g.s.Name + `
+		size int
+		walk func(n *Node, bytes bool)
+	)
+	walk = func(n *Node, bytes bool) {
+		if bytes {
+			size += len(n.DataBytes())
+		} else {
+			size += len(n.Data())
+		}
+		for _, child := range n.Children {
+			walk(child, bytes)
+		}
+	}
+	b.Run("copied", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for _, data := range inputs {
+				p.Parse(string(data))
+				walk(p.RootNode(), false)
+			}
+		}
+	})
+	b.Run("zero-copy", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for _, data := range inputs {
+				p.ParseBytes(data)
+				walk(p.RootNode(), true)
+			}
+		}
+	})
+}
 `
+			seeds += `
+	files, _ := filepath.Glob(testname)`
+		}
+		if g.s.Coverage {
+			use(`"fmt"`, `"os"`)
+			coverage_s = `
+// TestMain writes the grammar coverage reports once the tests are done
+func TestMain(m *testing.M) {
+	ret := m.Run()
+	for name, report := range map[string]string{"coverage.txt": Coverage.String(), "coverage.html": Coverage.HTML()} {
+		if err := ioutil.WriteFile(name, []byte(report), 0644); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			ret = 1
+		}
+	}
+	os.Exit(ret)
+}
+`
+		}
+		if g.s.Samples != "" {
+			use(`"os"`)
+			samples_s = `
+// TestSamples makes sure that the grammar generated samples in
+// ` + g.s.Samples + ` parse to completion
+func TestSamples(t *testing.T) {
+	files, err := filepath.Glob(` + fmt.Sprintf("%q", g.s.Samples+"/*") + `)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fn := range files {
+		if fi, err := os.Stat(fn); err != nil {
+			t.Fatal(err)
+		} else if fi.IsDir() {
+			// Such as the fuzz corpus of go test in testdata/fuzz
+			continue
+		}
+		data, err := ioutil.ReadFile(fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var p ` + g.s.Name + `
+		if !p.Parse(string(data)) {
+			t.Errorf("%s didn't parse correctly: %s", fn, p.Error())
+		} else if p.ParserData.Pos() != p.ParserData.Len() {
+			t.Errorf("Parsing %s stopped at %d of %d: %s", fn, p.ParserData.Pos(), p.ParserData.Len(), p.Error())
+		}
+	}
+}
+`
+			if seeds == "" {
+				seeds = "\n\tvar files []string"
+			}
+			seeds += `
+	samples, _ := filepath.Glob(` + fmt.Sprintf("%q", g.s.Samples+"/*") + `)
+	files = append(files, samples...)`
+		}
+		seeds += `
+	for _, fn := range files {
+		if data, err := ioutil.ReadFile(fn); err == nil {
+			f.Add(string(data))
+		}
+	}`
+		fuzz_s := `
+// budgetReader is a Reader giving up with a budgetExceeded panic
+// after a number of operations, which catches parsers looping forever
+type budgetReader struct {
+	Reader
+	steps int
+}
+
+type budgetExceeded struct{}
+
+func (r *budgetReader) step() {
+	if r.steps--; r.steps < 0 {
+		panic(budgetExceeded{})
+	}
+}
+
+func (r *budgetReader) Pos() int {
+	r.step()
+	return r.Reader.Pos()
+}
+
+func (r *budgetReader) Read() rune {
+	r.step()
+	return r.Reader.Read()
+}
+
+func (r *budgetReader) Seek(offset int) {
+	r.step()
+	r.Reader.Seek(offset)
+}
+
+// checkTree reports nodes that aren't within their parent "n" or
+// that overlap or are out of order with their siblings
+func checkTree(t *testing.T, n *Node) {
+	prev := n.Range.A
+	for _, child := range n.Children {
+		if child.Range.A > child.Range.B {
+			t.Errorf("%s %v has a negative range", child.Name, child.Range)
+		}
+		if child.Range.A < n.Range.A || child.Range.B > n.Range.B {
+			t.Errorf("%s %v isn't within its parent %s %v", child.Name, child.Range, n.Name, n.Range)
+		}
+		if child.Range.A < prev {
+			t.Errorf("%s %v overlaps or comes before its previous sibling in %s", child.Name, child.Range, n.Name)
+		}
+		prev = child.Range.B
+		checkTree(t, child)
+	}
+}
+
+// FuzzParser makes sure that the parser neither panics nor loops
+// forever on any input, and that the trees it builds are well formed
+func FuzzParser(f *testing.F) {` + seeds + `
+	f.Fuzz(func(t *testing.T, data string) {
+		var p ` + g.s.Name + `
+		p.SetData(data)
+		p.ParserData = &budgetReader{Reader: p.ParserData, steps: 10000 * (len(data) + 1)}
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					if _, ok := r.(budgetExceeded); ok {
+						t.Fatalf("Parsing %q didn't finish within the step budget", data)
+					}
+					t.Fatalf("Parsing %q panicked: %v", data, r)
+				}
+			}()
+			p.realParse()
+		}()
+		p.Root.UpdateRange()
+		checkTree(t, &p.Root)
+	})
+}
+`
+		var impList []string
+		for imp := range imports {
+			impList = append(impList, imp)
+		}
+		sort.Strings(impList)
+		test := `package ` + g.s.Package + `
+
+import (
+	` + strings.Join(impList, "\n\t") + `
+)
+` + parser_s + samples_s + fuzz_s + coverage_s
 		if err := g.s.WriteFile(ln+"_test.go", test); err != nil {
 			return err
 		}
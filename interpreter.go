@@ -0,0 +1,733 @@
+/*
+Copyright (c) 2012-2013 Fredrik Ehnbom
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice, this
+   list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE LIABLE FOR
+ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+(INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+(INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"github.com/limetext/text"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type (
+	// Interpreter parses data with a grammar tree as produced by
+	// peg.Peg without generating a parser for it first. The trees it
+	// builds are the same as those of the parser GoGenerator generates
+	// for the grammar, so it can stand in for one where compiling a
+	// parser isn't an option.
+	Interpreter struct {
+		ParserData  Reader
+		IgnoreRange text.Region
+		Root        Node
+		LastError   int
+		Tokens      []Token
+		Trailing    []Token
+		// Tracer, if set, is told about the definitions entered and
+		// exited, the terminals that didn't match and the sequences
+		// backtracking
+		Tracer Tracer
+		// How the nodes of the definitions named are shaped as the
+		// tree is built, like GeneratorSettings.Shapes
+		Shapes map[string]Shape
+
+		name    string
+		current string
+		start   string
+		order   []string
+		defs    map[string]*Node
+		ignore  map[string]bool
+		lexical map[string]bool
+		tokens  []string
+		trivia  []string
+		tokenAt map[int]int
+		// Whether the definition being interpreted is a lexical one
+		lexing bool
+		// The captures of the definition invocations in progress, in
+		// the order they were made, and where those of the innermost
+		// invocation start
+		captures []capture
+		frame    int
+		// Whether the input stopped matching after a cut, which fails
+		// the innermost choice, repetition or predicate
+		cut bool
+	}
+
+	// capture is the text matched by a labeled expression
+	capture struct {
+		name   string
+		region text.Region
+	}
+)
+
+// NewInterpreter returns an Interpreter for the grammar "rootNode",
+// naming the root of the parsed trees "name" unless the grammar has
+// a @type header. The definitions in "ignore" don't create nodes,
+// just like those given to the Go generator's Ignore action. Grammars
+// with semantic predicates are rejected with an UnsupportedError, as
+// their code can only run in a generated parser.
+func NewInterpreter(rootNode *Node, name string, ignore []string) (*Interpreter, error) {
+	p := &Interpreter{
+		name:    name,
+		defs:    make(map[string]*Node),
+		ignore:  make(map[string]bool),
+		lexical: make(map[string]bool),
+	}
+	for _, n := range ignore {
+		p.ignore[n] = true
+	}
+	add := func(def *Node) {
+		name := def.Children[0].Data()
+		p.defs[name] = def.Children[len(def.Children)-1]
+		p.order = append(p.order, name)
+	}
+	for _, node := range rootNode.Children {
+		switch node.Name {
+		case "Header":
+			switch key, value := node.Children[0].Data(), node.Children[1].Data(); key {
+			case "start":
+				p.start = value
+			case "type":
+				p.name = value
+			case "package":
+			default:
+				return nil, fmt.Errorf("unknown header @%s", key)
+			}
+		case "Definition":
+			add(node)
+		case "Lexical":
+			for _, child := range node.Children {
+				if child.Name == "Trivia" {
+					child = child.Children[0]
+					p.trivia = append(p.trivia, child.Children[0].Data())
+				} else {
+					p.tokens = append(p.tokens, child.Children[0].Data())
+				}
+				p.lexical[child.Children[0].Data()] = true
+				add(child)
+			}
+		}
+	}
+	if len(p.order) == 0 {
+		return nil, fmt.Errorf("the grammar has no definitions")
+	}
+	if p.start == "" {
+		p.start = p.order[0]
+	} else if p.defs[p.start] == nil {
+		return nil, fmt.Errorf("unknown start definition %q", p.start)
+	}
+	for _, name := range p.order {
+		if err := p.check(name, p.defs[name]); err != nil {
+			return nil, err
+		}
+	}
+	// Such as repetitions of expressions that can match nothing, which
+	// would loop forever like in the generated parsers
+	for _, d := range Lint(rootNode) {
+		if d.Severity == SeverityError {
+			return nil, errors.New(d.String())
+		}
+	}
+	return p, nil
+}
+
+// check returns an error if the expression "node" of the definition
+// "def" uses something the Interpreter can't interpret
+func (p *Interpreter) check(def string, node *Node) error {
+	switch node.Name {
+	case "Predicate":
+		return &UnsupportedError{Generator: "Interpreter", Feature: "semantic predicates"}
+	case "Primary", "Precedence":
+		if id := node.Children[0]; id.Name == "Identifier" && p.defs[id.Data()] == nil {
+			return fmt.Errorf("%s: reference to unknown definition %q", def, id.Data())
+		}
+	case "BackReference":
+		if name := node.Children[0].Data(); !hasLabel(p.defs[def], name) {
+			return fmt.Errorf("%s: back-reference to unknown capture %q", def, name)
+		}
+	case "Class":
+		// Outside the lexical section the input is made up of tokens
+		if len(p.tokens) > 0 && !p.lexical[def] {
+			return fmt.Errorf("%s: character class %s outside the lexical section", def, strings.TrimSpace(node.Data()))
+		}
+	}
+	for _, child := range node.Children {
+		if err := p.check(def, child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hasLabel returns whether the expression "node" captures "name"
+func hasLabel(node *Node, name string) bool {
+	if node.Name == "Label" && node.Children[0].Data() == name {
+		return true
+	}
+	for _, child := range node.Children {
+		if hasLabel(child, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Start returns the name of the definition parsing starts at
+func (p *Interpreter) Start() string {
+	return p.start
+}
+
+// Rules returns the names of the definitions in the order they are
+// written
+func (p *Interpreter) Rules() []string {
+	return p.order
+}
+
+func (p *Interpreter) RootNode() *Node {
+	return &p.Root
+}
+
+func (p *Interpreter) SetData(data string) {
+	p.ParserData = NewReader(data)
+	p.Root = Node{Name: p.name, P: p}
+	p.IgnoreRange = text.Region{}
+	p.LastError = 0
+	p.captures = nil
+	p.frame = 0
+	p.cut = false
+}
+
+func (p *Interpreter) Reset() {
+	p.SetData(p.ParserData.Substring(0, p.ParserData.Len()))
+}
+
+func (p *Interpreter) Parse(data string) bool {
+	ret, _ := p.ParseRule(p.start, data)
+	return ret
+}
+
+// ParseRule parses data starting at the definition "name", returning
+// an error if there's no such definition
+func (p *Interpreter) ParseRule(name, data string) (bool, error) {
+	if p.defs[name] == nil {
+		return false, fmt.Errorf("unknown definition %q", name)
+	}
+	p.SetData(data)
+	ret := p.parse(name)
+	p.Root.UpdateRange()
+	return ret, nil
+}
+
+func (p *Interpreter) parse(name string) bool {
+	if len(p.tokens) > 0 && !p.tokenize() {
+		return false
+	}
+	return p.call(name)
+}
+
+func (p *Interpreter) Data(start, end int) string {
+	return p.ParserData.Substring(start, end)
+}
+
+func (p *Interpreter) Error() Error {
+	errstr := ""
+	line, column := p.ParserData.LineCol(p.LastError)
+
+	if p.LastError == p.ParserData.Len() {
+		errstr = "Unexpected EOF"
+	} else {
+		p.ParserData.Seek(p.LastError)
+		if r := p.ParserData.Read(); r == '\r' || r == '\n' {
+			errstr = "Unexpected new line"
+		} else {
+			errstr = "Unexpected " + string(r)
+		}
+	}
+	return NewErrorAt(p.LastError, line, column, errstr)
+}
+
+// call interprets the definition "name", tracing it if asked to
+func (p *Interpreter) call(name string) (accept bool) {
+	if p.Tracer == nil {
+		return p.invoke(name)
+	}
+	start := p.ParserData.Pos()
+	current := p.current
+	p.current = name
+	p.Tracer.Trace(Event{Kind: EventEnter, Name: name, Start: start})
+	defer func() {
+		p.current = current
+		p.Tracer.Trace(Event{Kind: EventExit, Name: name, Start: start, End: p.ParserData.Pos(), Accept: accept})
+	}()
+	return p.invoke(name)
+}
+
+// invoke interprets the definition "name", creating its node the way
+// the Go generator's AddNode and Ignore actions do
+func (p *Interpreter) invoke(name string) bool {
+	if len(p.tokens) > 0 && !p.lexing && p.lexical[name] {
+		return p.matchToken(name, "")
+	}
+	exp := p.defs[name]
+	lexing := p.lexing
+	p.lexing = p.lexical[name]
+	frame := p.frame
+	p.frame = len(p.captures)
+	defer func() {
+		p.lexing = lexing
+		p.captures = p.captures[:p.frame]
+		p.frame = frame
+		p.cut = false
+	}()
+
+	body := func() bool {
+		if exp.Name == "Precedence" {
+			return p.climb(name, exp, 0)
+		}
+		return p.eval(exp)
+	}
+	start := p.ParserData.Pos()
+	if p.ignore[name] {
+		accept := body()
+		if accept && start != p.ParserData.Pos() {
+			// Like in the generated parsers, ignored input apart from
+			// the range starts a new one
+			if start < p.IgnoreRange.A || p.IgnoreRange.A == 0 || start > p.IgnoreRange.B {
+				p.IgnoreRange.A = start
+			}
+			p.IgnoreRange.B = p.ParserData.Pos()
+		}
+		return accept
+	} else if p.lexing {
+		return body()
+	} else if exp.Name == "Precedence" {
+		// climb shapes the operations itself
+		accept := body()
+		if shape := p.Shapes[name]; shape.Drop && !shape.Lift {
+			p.Root.Discard(start)
+		}
+		return accept
+	}
+	accept := body()
+	end := p.ParserData.Pos()
+	shape := p.Shapes[name]
+	if shape.Rename != "" {
+		name = shape.Rename
+	}
+	switch {
+	case !accept || shape.Drop && !shape.Lift:
+		p.Root.Discard(start)
+	case shape.Lift:
+		// The children stay where they are
+	case shape.Collapse && len(p.Root.ChildrenIn(start, end)) == 1:
+		// As does a single child
+	default:
+		node := p.Root.Cleanup(start, end)
+		node.Name = name
+		node.P = p
+		node.Range = node.Range.Clip(p.IgnoreRange)
+		p.Root.Append(node)
+	}
+	if p.IgnoreRange.A >= end || p.IgnoreRange.B <= start {
+		p.IgnoreRange = text.Region{}
+	}
+	return accept
+}
+
+func (p *Interpreter) updateError() {
+	if p.LastError < p.ParserData.Pos() {
+		p.LastError = p.ParserData.Pos()
+	}
+}
+
+// eval interprets the expression "node", tracing it if it's a
+// terminal that doesn't match and asked to
+func (p *Interpreter) eval(node *Node) bool {
+	if p.Tracer != nil {
+		switch node.Name {
+		case "Literal", "Class", "DOT":
+			pos := p.ParserData.Pos()
+			accept := p.evaluate(node)
+			if !accept {
+				p.Tracer.Trace(Event{Kind: EventMismatch, Name: strings.TrimSpace(node.Data()), Start: pos})
+			}
+			return accept
+		}
+	}
+	return p.evaluate(node)
+}
+
+// evaluate interprets the expression "node", mirroring what the Go
+// generator generates for it
+func (p *Interpreter) evaluate(node *Node) bool {
+	switch node.Name {
+	case "Expression":
+		if len(node.Children) == 1 {
+			return p.eval(node.Children[0])
+		}
+		save := p.ParserData.Pos()
+		for _, child := range node.Children {
+			if p.eval(child) {
+				return true
+			} else if p.cut {
+				break
+			}
+		}
+		p.cut = false
+		p.ParserData.Seek(save)
+		return false
+	case "Sequence":
+		if len(node.Children) == 1 && !isCut(node.Children[0]) {
+			return p.eval(node.Children[0])
+		}
+		save, captured := p.ParserData.Pos(), len(p.captures)
+		cut := false
+		for _, child := range node.Children {
+			if isCut(child) {
+				cut = true
+			} else if !p.eval(child) {
+				p.updateError()
+				p.cut = p.cut || cut
+				if pos := p.ParserData.Pos(); p.Tracer != nil && pos != save {
+					p.Tracer.Trace(Event{Kind: EventBacktrack, Name: p.current, Start: save, End: pos})
+				}
+				p.ParserData.Seek(save)
+				p.captures = p.captures[:captured]
+				return false
+			}
+		}
+		return true
+	case "Prefix":
+		return p.prefix(node.Children)
+	case "Suffix":
+		if len(node.Children) == 1 {
+			return p.eval(node.Children[0])
+		}
+		exp := node.Children[0]
+		switch node.Children[len(node.Children)-1].Name {
+		case "PLUS":
+			save := p.ParserData.Pos()
+			if !p.eval(exp) {
+				p.cut = false
+				p.ParserData.Seek(save)
+				return false
+			}
+			return p.repeat(exp, save)
+		case "STAR":
+			return p.repeat(exp, p.ParserData.Pos())
+		case "QUESTION":
+			accept := p.eval(exp) || !p.cut
+			p.cut = false
+			return accept
+		}
+		return true
+	case "Primary":
+		if front := node.Children[0]; front.Name == "Identifier" {
+			return p.call(front.Data())
+		} else {
+			return p.eval(front)
+		}
+	case "Literal":
+		return p.checkNext(node.Data())
+	case "Class":
+		save := p.ParserData.Pos()
+		for _, child := range node.Children {
+			if child.Name != "Range" {
+				continue
+			}
+			lo := Unescape(child.Children[0].Data())
+			hi := lo
+			if len(child.Children) == 2 {
+				hi = Unescape(child.Children[1].Data())
+			}
+			c := p.ParserData.Read()
+			if c >= lo[0] && c <= hi[0] {
+				return true
+			}
+			p.ParserData.UnRead()
+		}
+		p.ParserData.Seek(save)
+		return false
+	case "DOT":
+		if len(p.tokens) > 0 && !p.lexing {
+			return p.matchToken("", "")
+		}
+		if p.ParserData.Pos() >= p.ParserData.Len() {
+			return false
+		}
+		p.ParserData.Read()
+		return true
+	case "BackReference":
+		// Like in the generated parsers, a capture that hasn't matched
+		// fails the back-reference
+		r, ok := p.capture(node.Children[0].Data())
+		if !ok {
+			return false
+		}
+		s := p.ParserData.Pos()
+		ref := p.ParserData.Substring(r.A, r.B)
+		if e := s + len(ref); e <= p.ParserData.Len() && p.ParserData.Substring(s, e) == ref {
+			p.ParserData.Seek(e)
+			return true
+		}
+		return false
+	case "Precedence":
+		panic("Shouldn't reach this")
+	}
+	panic("Shouldn't reach this: " + node.Name)
+}
+
+// repeat interprets "exp" for as long as it matches, failing the
+// repetition starting at "save" if it stops matching after a cut
+func (p *Interpreter) repeat(exp *Node, save int) bool {
+	for p.eval(exp) {
+	}
+	if p.cut {
+		p.cut = false
+		p.ParserData.Seek(save)
+		return false
+	}
+	return true
+}
+
+// prefix interprets the Prefix made up of "children", applying the
+// captures and syntactic predicates in front of the Suffix at the end
+func (p *Interpreter) prefix(children []*Node) bool {
+	if len(children) == 1 {
+		if isCut(&Node{Children: children}) {
+			return true
+		}
+		return p.eval(children[0])
+	}
+	s := p.ParserData.Pos()
+	switch front := children[0]; front.Name {
+	case "Label":
+		accept := p.prefix(children[1:])
+		if accept {
+			p.captures = append(p.captures, capture{front.Children[0].Data(), text.Region{A: s, B: p.ParserData.Pos()}})
+		}
+		return accept
+	case "NOT":
+		accept := p.prefix(children[1:])
+		p.cut = false
+		p.ParserData.Seek(s)
+		p.Root.Discard(s)
+		return !accept
+	case "AND":
+		accept := p.prefix(children[1:])
+		p.cut = false
+		p.ParserData.Seek(s)
+		p.Root.Discard(s)
+		return accept
+	}
+	panic("Shouldn't reach this: " + children[0].Name)
+}
+
+// capture returns what the innermost definition invocation last
+// captured as "name", and whether it has captured it at all
+func (p *Interpreter) capture(name string) (text.Region, bool) {
+	for i := len(p.captures) - 1; i >= p.frame; i-- {
+		if p.captures[i].name == name {
+			return p.captures[i].region, true
+		}
+	}
+	return text.Region{}, false
+}
+
+// checkNext matches the literal "lit", quotes included
+func (p *Interpreter) checkNext(lit string) bool {
+	if len(p.tokens) > 0 && !p.lexing {
+		return p.matchToken("", string(Unescape(lit[1:len(lit)-1])))
+	}
+	s := p.ParserData.Pos()
+	for _, r := range Unescape(lit[1 : len(lit)-1]) {
+		if p.ParserData.Read() != r {
+			p.ParserData.Seek(s)
+			return false
+		}
+	}
+	return true
+}
+
+// climb parses the operands of the Precedence "exp" of the definition
+// "name" separated by operators binding at least as tight as "min"
+func (p *Interpreter) climb(name string, exp *Node, min int) bool {
+	type operator struct {
+		lit         string
+		level, next int
+	}
+	var ops []operator
+	for i, l := range exp.Children[1:] {
+		next := i + 1
+		if l.Children[0].Data() == "right" {
+			next = i
+		}
+		for _, op := range l.Children[1:] {
+			ops = append(ops, operator{op.Data(), i, next})
+		}
+	}
+	sort.SliceStable(ops, func(i, j int) bool {
+		return len(ops[i].lit) > len(ops[j].lit)
+	})
+
+	start := p.ParserData.Pos()
+	if !p.call(exp.Children[0].Data()) {
+		return false
+	}
+	for {
+		save := p.ParserData.Pos()
+		level, next := -1, 0
+		for _, op := range ops {
+			if p.checkNext(op.lit) {
+				level, next = op.level, op.next
+				break
+			}
+		}
+		if level < min {
+			p.ParserData.Seek(save)
+			return true
+		}
+		p.Root.Append(&Node{Name: "Operator", P: p, Range: text.Region{A: save, B: p.ParserData.Pos()}.Clip(p.IgnoreRange)})
+		if !p.climb(name, exp, next) {
+			p.ParserData.Seek(save)
+			p.Root.Discard(save)
+			return true
+		}
+		end := p.ParserData.Pos()
+		// Operations always have more than one child, so only Lift and
+		// Rename apply to them
+		if shape := p.Shapes[name]; !shape.Lift {
+			node := p.Root.Cleanup(start, end)
+			node.Name = name
+			if shape.Rename != "" {
+				node.Name = shape.Rename
+			}
+			node.P = p
+			node.Range = text.Region{A: node.Children[0].Range.A, B: node.Children[len(node.Children)-1].Range.B}
+			p.Root.Append(node)
+		}
+		if p.IgnoreRange.A >= end || p.IgnoreRange.B <= start {
+			p.IgnoreRange = text.Region{}
+		}
+	}
+}
+
+// tokenize splits the data into p.Tokens like the generated parsers'
+// tokenize does
+func (p *Interpreter) tokenize() bool {
+	p.Tokens, p.Trailing = nil, nil
+	p.tokenAt = make(map[int]int)
+	var trivia []Token
+	p.lexing = true
+	defer func() { p.lexing = false }()
+outer:
+	for p.ParserData.Pos() < p.ParserData.Len() {
+		start := p.ParserData.Pos()
+		for _, t := range p.trivia {
+			if p.call(t) && p.ParserData.Pos() > start {
+				trivia = append(trivia, Token{Kind: t, Range: text.Region{A: start, B: p.ParserData.Pos()}})
+				continue outer
+			}
+			p.ParserData.Seek(start)
+		}
+		kind, end := "", start
+		for _, t := range p.tokens {
+			if p.call(t) && p.ParserData.Pos() > end {
+				kind, end = t, p.ParserData.Pos()
+			}
+			p.ParserData.Seek(start)
+		}
+		if kind == "" {
+			if p.LastError < start {
+				p.LastError = start
+			}
+			return false
+		}
+		p.tokenAt[start] = len(p.Tokens)
+		p.Tokens = append(p.Tokens, Token{Kind: kind, Range: text.Region{A: start, B: end}, Trivia: trivia})
+		trivia = nil
+		p.ParserData.Seek(end)
+	}
+	p.Trailing = trivia
+	p.IgnoreRange = text.Region{}
+	p.LastError = 0
+	if len(p.Tokens) > 0 {
+		p.ParserData.Seek(p.Tokens[0].Range.A)
+	}
+	return true
+}
+
+// matchToken consumes the token at the current position if it is of
+// the given kind and has the given text, skipping the trivia following
+// it. An empty kind or text matches any.
+func (p *Interpreter) matchToken(kind, data string) bool {
+	i, ok := p.tokenAt[p.ParserData.Pos()]
+	if !ok {
+		return false
+	}
+	t := p.Tokens[i]
+	if kind != "" && t.Kind != kind || data != "" && p.ParserData.Substring(t.Range.A, t.Range.B) != data {
+		return false
+	}
+	if kind != "" {
+		p.Root.Append(&Node{Name: kind, P: p, Range: t.Range})
+	}
+	next := p.ParserData.Len()
+	if i+1 < len(p.Tokens) {
+		next = p.Tokens[i+1].Range.A
+	}
+	if next > t.Range.B {
+		p.IgnoreRange = text.Region{A: t.Range.B, B: next}
+	}
+	p.ParserData.Seek(next)
+	return true
+}
+
+// Unescape returns the characters of the grammar literal or character
+// class text "s", its escape sequences resolved
+func Unescape(s string) (ret []rune) {
+	for len(s) > 0 {
+		if len(s) > 1 && s[0] == '\\' && strings.IndexByte(`'"[]`, s[1]) >= 0 {
+			ret, s = append(ret, rune(s[1])), s[2:]
+			continue
+		}
+		if len(s) > 1 && s[0] == '\\' && s[1] >= '0' && s[1] <= '7' {
+			n := 2
+			for n < len(s) && n < 4 && s[n] >= '0' && s[n] <= '7' {
+				n++
+			}
+			v, _ := strconv.ParseUint(s[1:n], 8, 32)
+			ret, s = append(ret, rune(v)), s[n:]
+			continue
+		}
+		r, _, tail, err := strconv.UnquoteChar(s, 0)
+		if err != nil {
+			r, tail = rune(s[0]), s[1:]
+		}
+		ret, s = append(ret, r), tail
+	}
+	return
+}
@@ -41,8 +41,13 @@ type JavaGenerator struct {
 	ParserVariables []string
 	Imports         []string
 	havefunctions   bool
-	currentName     string
-	saveCount       int
+	realParseAt     int
+	startName       string
+	// Whether the definition being generated has a cut inside a
+	// choice, repetition or predicate
+	cut         bool
+	currentName string
+	saveCount   int
 }
 
 func (g *JavaGenerator) SetCustomActions(actions []CustomAction) {
@@ -85,11 +90,16 @@ func (g *JavaGenerator) MakeParserFunction(node *Node) error {
 	defName := helper(g, id)
 	g.currentName = defName
 	g.saveCount = 0
+	g.cut = hasScopedCut(exp, false)
 	data := helper(g, exp)
 
 	if !g.havefunctions {
 		g.havefunctions = true
-		g.output += "private boolean realParse() {\n\treturn " + defName + "();\n}\n"
+		g.realParseAt = len(g.output)
+		g.startName = g.s.Start
+		if g.startName == "" {
+			g.startName = defName
+		}
 	}
 
 	indenter := CodeFormatter{}
@@ -114,6 +124,9 @@ func (g *JavaGenerator) MakeParserFunction(node *Node) error {
 		if data[len(data)-1] != '\n' {
 			end = "\n" + end
 		}
+		if g.cut {
+			indenter.Add("boolean cut = false;\n")
+		}
 		indenter.Add("boolean accept = false;\n" + data + end)
 	} else {
 		indenter.Add("return " + data + ";\n")
@@ -238,7 +251,7 @@ func (g *JavaGenerator) AssertNot(a string) string {
 	g.saveCount++
 
 	return `int ` + mysave + ` = parserData.pos;
-` + g.Call(a) + `
+` + g.Call(a) + g.uncut() + `
 parserData.pos = ` + mysave + `;
 accept = !accept;`
 }
@@ -248,21 +261,47 @@ func (g *JavaGenerator) AssertAnd(a string) string {
 	g.saveCount++
 
 	return `int ` + mysave + ` = parserData.pos;
-` + g.Call(a) + `
+` + g.Call(a) + g.uncut() + `
 parserData.pos = ` + mysave + `;`
 }
 
+func (g *JavaGenerator) Capture(name, a string) string {
+	panic(&UnsupportedError{Feature: "captures"})
+}
+
+func (g *JavaGenerator) BackReference(name string) string {
+	panic(&UnsupportedError{Feature: "back-references"})
+}
+
+func (g *JavaGenerator) SemanticAnd(code string) string {
+	panic(&UnsupportedError{Feature: "semantic predicates"})
+}
+
+func (g *JavaGenerator) SemanticNot(code string) string {
+	panic(&UnsupportedError{Feature: "semantic predicates"})
+}
+
+func (g *JavaGenerator) Precedence(operand string, levels []PrecedenceLevel) string {
+	panic(&UnsupportedError{Feature: "operator precedence"})
+}
+
 func (g *JavaGenerator) ZeroOrMore(a string) string {
 	var cf CodeFormatter
+	mysave := ""
 	cf.Add("{\n")
 	cf.Inc()
+	if g.cut {
+		mysave = fmt.Sprintf("save_%d", g.saveCount)
+		g.saveCount++
+		cf.Add("int " + mysave + " = parserData.pos;\n")
+	}
 	cf.Add("accept = true;")
 	cf.Add("\nwhile (accept) {\n")
 	cf.Inc()
 	cf.Add(g.Call(a))
 	cf.Dec()
 	cf.Add("\n}\n")
-	cf.Add("accept = true;\n")
+	cf.Add(g.endRepetition(mysave))
 	cf.Dec()
 	cf.Add("}")
 	return cf.String()
@@ -276,7 +315,7 @@ func (g *JavaGenerator) OneOrMore(a string) string {
 	cf.Inc()
 	cf.Add(`int ` + mysave + ` = parserData.pos;
 ` + g.Call(a) + `
-if (!accept) {
+if (!accept) {` + strings.Replace(g.uncut(), "\n", "\n\t", -1) + `
 	parserData.pos = ` + mysave + `;
 } else {
 	while (accept) {
@@ -285,9 +324,7 @@ if (!accept) {
 	cf.Inc()
 	cf.Add(g.Call(a) + "\n")
 	cf.Dec()
-	cf.Add(`}
-accept = true;
-`)
+	cf.Add("}\n" + g.endRepetition(mysave))
 	cf.Dec()
 	cf.Add("}\n")
 	cf.Dec()
@@ -296,18 +333,56 @@ accept = true;
 }
 
 func (g *JavaGenerator) Maybe(a string) string {
+	if g.cut {
+		return g.Call(a) + "\naccept = !cut;\ncut = false;"
+	}
 	return g.Call(a) + "\naccept = true;"
 }
 
+// uncut returns the code resetting the cut variable after an
+// expression of a predicate
+func (g *JavaGenerator) uncut() string {
+	if g.cut {
+		return "\ncut = false;"
+	}
+	return ""
+}
+
+// endRepetition returns the code ending a repetition starting at
+// "mysave", failing it if it stopped matching after a cut
+func (g *JavaGenerator) endRepetition(mysave string) string {
+	if g.cut {
+		return `if (cut) {
+	cut = false;
+	parserData.pos = ` + mysave + `;
+} else {
+	accept = true;
+}
+`
+	}
+	return "accept = true;\n"
+}
+
 type jNeedAllGroup struct {
 	cf     CodeFormatter
-	g      Generator
+	g      *JavaGenerator
 	stack  list.List
 	label  string
 	mysave string
+	cut    bool
 }
 
 func (b *jNeedAllGroup) Add(value, name string) {
+	if b.cut && b.g.cut {
+		b.cf.Add(b.g.Call(value) + `
+if (!accept) {
+	cut = true;
+} else {
+`)
+		b.cf.Inc()
+		b.stack.PushBack(name)
+		return
+	}
 	b.cf.Add(b.g.Call(value) + `
 if (accept) {
 `)
@@ -315,17 +390,30 @@ if (accept) {
 	b.stack.PushBack(name)
 }
 
+func (b *jNeedAllGroup) Cut() {
+	b.cut = true
+}
+
 type jNeedOneGroup struct {
 	cf     CodeFormatter
-	g      Generator
+	g      *JavaGenerator
 	mysave string
 }
 
 func (b *jNeedOneGroup) Add(value, name string) {
+	if b.g.cut {
+		b.cf.Add(b.g.Call(value) + "\nif (!accept && !cut) {\n")
+		b.cf.Inc()
+		return
+	}
 	b.cf.Add(b.g.Call(value) + "\nif (!accept) {\n")
 	b.cf.Inc()
 }
 
+func (b *jNeedOneGroup) Cut() {
+	panic("Shouldn't reach this")
+}
+
 func (g *JavaGenerator) BeginGroup(requireAll bool) Group {
 	mysave := fmt.Sprintf("save_%d", g.saveCount)
 	g.saveCount++
@@ -370,7 +458,7 @@ func (g *JavaGenerator) EndGroup(gr Group) string {
 			t.cf.Dec()
 			t.cf.Add("}\n")
 		}
-		t.cf.Add("if (!accept) {\n\tparserData.pos = " + t.mysave + ";\n}\n")
+		t.cf.Add("if (!accept) {" + strings.Replace(g.uncut(), "\n", "\n\t", -1) + "\n\tparserData.pos = " + t.mysave + ";\n}\n")
 		t.cf.Dec()
 		t.cf.Add("}")
 		return t.cf.String()
@@ -396,6 +484,9 @@ func (g *JavaGenerator) Call(value string) string {
 
 func (g *JavaGenerator) Begin(s GeneratorSettings) error {
 	g.s = s
+	if len(s.Tokens) > 0 {
+		panic(&UnsupportedError{Feature: "lexical sections"})
+	}
 	dumptree_s := ""
 	if g.s.Debug {
 		dumptree_s = "p.Root.print(p, \"\");"
@@ -599,7 +690,16 @@ class ` + g.s.Name + ` {
 	return nil
 }
 
+// realParse returns the method that kicks off parsing at the start
+// definition.
+func (g *JavaGenerator) realParse() string {
+	return "private boolean realParse() {\n\treturn " + g.startName + "();\n}\n"
+}
+
 func (g *JavaGenerator) Finish() error {
+	if g.havefunctions {
+		g.output = g.output[:g.realParseAt] + g.realParse() + g.output[g.realParseAt:]
+	}
 	ret := strings.Replace(g.realOutput+g.output+"\n}", "{{ParserName}}", g.s.Name, -1)
 	if ret[len(ret)-2:] == "\n\n" {
 		ret = ret[:len(ret)-1]
@@ -1,7 +1,10 @@
 package json
 
 import (
+	"fmt"
 	"testing"
+
+	"github.com/quarnster/parser"
 )
 
 /*
@@ -351,3 +354,59 @@ func TestParserComprehensive(t *testing.T) {
 		}
 	}
 }
+
+// committed is a Reader recording the offsets the parser commits to
+type committed struct {
+	parser.Reader
+	offsets []int
+}
+
+func (c *committed) Commit(offset int) {
+	c.offsets = append(c.offsets, offset)
+}
+
+func TestCut(t *testing.T) {
+	// Without the cut after ',' the repetition in Values would stop
+	// before it and leave it unparsed, as EndOfFile is optional
+	var p JSON
+	if p.Parse(`1, }`) {
+		t.Fatalf("Succeeded, but shouldn't have:\n%s", p.RootNode())
+	}
+	if exp, err := "1,4: Unexpected }", p.Error().Error(); err != exp {
+		t.Errorf("Expected %s, got %s", exp, err)
+	}
+
+	// The cuts after the commas between the values at the top leave
+	// nothing to go back to, unlike those within the array where
+	// Value could still try its other alternatives
+	p.SetData(`1, [2, 3], 4`)
+	c := &committed{Reader: p.ParserData}
+	p.ParserData = c
+	if !p.realParse() {
+		t.Fatalf("Didn't parse correctly: %s", p.Error())
+	}
+	if exp := []int{2, 10}; fmt.Sprint(c.offsets) != fmt.Sprint(exp) {
+		t.Errorf("Expected commits at %v, not %v", exp, c.offsets)
+	}
+}
+
+func TestParseRule(t *testing.T) {
+	var p JSON
+	if !p.ParseRule("Array", `[1, "a"]`) {
+		t.Fatalf("Didn't parse correctly: %s", p.Error())
+	}
+	exp := `0-8: "JSON"
+	0-8: "Array"
+		1-2: "Integer" - Data: "1"
+		5-6: "Text" - Data: "a"
+`
+	if p.RootNode().String() != exp {
+		t.Errorf("Expected:\n%s\nReceived:\n%s", exp, p.RootNode())
+	}
+	if p.ParseRule("Integer", `[1]`) {
+		t.Error("Integer shouldn't match an Array")
+	}
+	if p.ParseRule("NoSuchRule", `1`) {
+		t.Error("Shouldn't parse with an unknown definition")
+	}
+}
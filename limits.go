@@ -0,0 +1,148 @@
+/*
+Copyright (c) 2012-2013 Fredrik Ehnbom
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice, this
+   list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE LIABLE FOR
+ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+(INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+(INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+package parser
+
+import (
+	"context"
+	"fmt"
+)
+
+type (
+	// Limits bounds the work a parse may do, a zero meaning no limit
+	Limits struct {
+		// Number of definitions the parser may call
+		Steps int
+		// How deeply calls of definitions may nest
+		Depth int
+		// Number of nodes the parser may create, including the ones
+		// it discards when backtracking
+		Nodes int
+	}
+
+	// Limiter enforces Limits and the cancellation of a context on a
+	// parse. Generated parsers call Enter and Exit around each
+	// definition and Node for each node they create, and when
+	// something runs out the Limiter panics with a *LimitError which
+	// the parser recovers, failing the parse.
+	Limiter struct {
+		Limits
+		ctx                 context.Context
+		done                <-chan struct{}
+		data                Reader
+		steps, depth, nodes int
+		err                 *LimitError
+	}
+
+	// LimitError is the Error of a parse that exceeded its Limits or
+	// whose context was done
+	LimitError struct {
+		// The limit exceeded, "steps", "depth" or "nodes", or
+		// "context" when the context was done
+		Limit string
+		// The context's error when it was done
+		Err error
+		// Where in the data the parse gave up
+		Pos          int
+		line, column int
+		description  string
+	}
+)
+
+// How many steps a Limiter takes between checking if its context is
+// done, which isn't free
+const contextInterval = 1024
+
+// NewLimiter returns a Limiter of a parse of "data" enforcing
+// "limits" and the cancellation of "ctx", or nil if there's nothing to
+// enforce. "ctx" may be nil.
+func NewLimiter(ctx context.Context, limits Limits, data Reader) *Limiter {
+	var done <-chan struct{}
+	if ctx != nil {
+		done = ctx.Done()
+	}
+	if limits == (Limits{}) && done == nil {
+		return nil
+	}
+	return &Limiter{Limits: limits, ctx: ctx, done: done, data: data}
+}
+
+// Enter is called when a definition is entered at "pos"
+func (l *Limiter) Enter(pos int) {
+	l.steps++
+	l.depth++
+	if l.Steps > 0 && l.steps > l.Steps {
+		l.fail("steps", pos, nil, fmt.Sprintf("exceeded the limit of %d steps", l.Steps))
+	}
+	if l.Depth > 0 && l.depth > l.Depth {
+		l.fail("depth", pos, nil, fmt.Sprintf("exceeded the depth limit of %d", l.Depth))
+	}
+	if l.done != nil && l.steps%contextInterval == 1 {
+		select {
+		case <-l.done:
+			l.fail("context", pos, l.ctx.Err(), fmt.Sprintf("gave up: %s", l.ctx.Err()))
+		default:
+		}
+	}
+}
+
+// Exit is called when the definition last entered is exited
+func (l *Limiter) Exit() {
+	l.depth--
+}
+
+// Node is called when a node ending at "pos" is created
+func (l *Limiter) Node(pos int) {
+	if l.nodes++; l.Nodes > 0 && l.nodes > l.Nodes {
+		l.fail("nodes", pos, nil, fmt.Sprintf("exceeded the limit of %d nodes", l.Nodes))
+	}
+}
+
+// Err returns the error the parse gave up with, if it did
+func (l *Limiter) Err() *LimitError {
+	if l == nil {
+		return nil
+	}
+	return l.err
+}
+
+func (l *Limiter) fail(limit string, pos int, err error, description string) {
+	line, column := l.data.LineCol(pos)
+	l.err = &LimitError{Limit: limit, Err: err, Pos: pos, line: line, column: column, description: description}
+	panic(l.err)
+}
+
+func (e *LimitError) Line() int           { return e.line }
+func (e *LimitError) Column() int         { return e.column }
+func (e *LimitError) Description() string { return e.description }
+func (e *LimitError) Offset() int         { return e.Pos }
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%d,%d: %s", e.line, e.column, e.description)
+}
+
+// Unwrap returns the context's error, so errors.Is tells a canceled
+// parse from one that exceeded a deadline
+func (e *LimitError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,324 @@
+/*
+Copyright (c) 2012-2013 Fredrik Ehnbom
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice, this
+   list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE LIABLE FOR
+ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+(INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+(INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+package parser
+
+import (
+	"fmt"
+	"github.com/limetext/text"
+	"sort"
+	"strings"
+)
+
+type (
+	// Severity of a Diagnostic
+	Severity int
+
+	// Diagnostic is a problem Lint found in a grammar
+	Diagnostic struct {
+		Severity Severity
+		// Where in the grammar the problem is
+		Range        text.Region
+		Line, Column int
+		Message      string
+	}
+
+	// linter holds what Lint found out about a grammar
+	linter struct {
+		root     *Node
+		defs     map[string]*Node
+		nullable map[string]bool
+		diags    []Diagnostic
+	}
+)
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	if s == SeverityWarning {
+		return "warning"
+	}
+	return "error"
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%d:%d: %s: %s", d.Line, d.Column, d.Severity, d.Message)
+}
+
+// Lint checks the grammar "rootNode" as produced by peg.Peg for
+// problems that would make the generated parsers fail to compile or
+// misbehave, such as references to unknown definitions, left recursion
+// and repetitions of expressions that can match nothing. Unused
+// definitions are reported as warnings. The diagnostics are sorted by
+// their position in the grammar.
+func Lint(rootNode *Node) []Diagnostic {
+	l := linter{root: rootNode, defs: make(map[string]*Node), nullable: make(map[string]bool)}
+	var (
+		order  []*Node
+		start  string
+		tokens []string
+	)
+	add := func(def *Node) {
+		id := def.Children[0]
+		if _, ok := l.defs[id.Data()]; ok {
+			l.report(SeverityError, id, "%s is defined more than once", id.Data())
+			return
+		}
+		l.defs[id.Data()] = def.Children[len(def.Children)-1]
+		order = append(order, def)
+	}
+	for _, node := range rootNode.Children {
+		switch node.Name {
+		case "Header":
+			switch key := node.Children[0].Data(); key {
+			case "start":
+				start = node.Children[1].Data()
+			case "package", "type":
+			default:
+				l.report(SeverityError, node.Children[0], "unknown header @%s", key)
+			}
+		case "Definition":
+			add(node)
+		case "Lexical":
+			for _, child := range node.Children {
+				if child.Name == "Trivia" {
+					child = child.Children[0]
+				}
+				tokens = append(tokens, child.Children[0].Data())
+				add(child)
+			}
+		}
+	}
+	if len(order) == 0 {
+		return l.diags
+	}
+	if start == "" {
+		start = order[0].Children[0].Data()
+	} else if l.defs[start] == nil {
+		l.report(SeverityError, rootNode, "unknown start definition %q", start)
+	}
+
+	for _, def := range order {
+		l.references(def.Children[0].Data(), def.Children[len(def.Children)-1])
+	}
+	for changed := true; changed; {
+		changed = false
+		for name, exp := range l.defs {
+			if !l.nullable[name] && l.isNullable(exp) {
+				l.nullable[name], changed = true, true
+			}
+		}
+	}
+	for _, def := range order {
+		l.repetitions(def.Children[len(def.Children)-1])
+	}
+	l.leftRecursion(order)
+
+	reached := make(map[string]bool)
+	for _, name := range append([]string{start}, tokens...) {
+		l.reach(name, reached)
+	}
+	for _, def := range order {
+		if id := def.Children[0]; !reached[id.Data()] {
+			l.report(SeverityWarning, id, "%s is never used", id.Data())
+		}
+	}
+	sort.SliceStable(l.diags, func(i, j int) bool {
+		return l.diags[i].Range.A < l.diags[j].Range.A
+	})
+	return l.diags
+}
+
+// report adds a diagnostic for the grammar node "n"
+func (l *linter) report(s Severity, n *Node, format string, args ...interface{}) {
+	d := Diagnostic{Severity: s, Range: n.Range, Line: 1, Column: 1, Message: fmt.Sprintf(format, args...)}
+	for _, c := range n.P.Data(0, n.Range.A) {
+		d.Column++
+		if c == '\n' {
+			d.Line++
+			d.Column = 1
+		}
+	}
+	l.diags = append(l.diags, d)
+}
+
+// references reports the unknown definitions and captures referred
+// to in the expression "n" of the definition "def"
+func (l *linter) references(def string, n *Node) {
+	switch n.Name {
+	case "Primary", "Precedence":
+		if id := n.Children[0]; id.Name == "Identifier" && l.defs[id.Data()] == nil {
+			l.report(SeverityError, id, "%s refers to the undefined %s", def, id.Data())
+		}
+	case "BackReference":
+		if id := n.Children[0]; !hasLabel(l.defs[def], id.Data()) {
+			l.report(SeverityError, id, "%s refers back to the unknown capture %s", def, id.Data())
+		}
+	}
+	for _, child := range n.Children {
+		l.references(def, child)
+	}
+}
+
+// isNullable returns whether the expression "n" can succeed without
+// consuming any input
+func (l *linter) isNullable(n *Node) bool {
+	switch n.Name {
+	case "Expression":
+		for _, child := range n.Children {
+			if l.isNullable(child) {
+				return true
+			}
+		}
+		return false
+	case "Sequence":
+		for _, child := range n.Children {
+			if !l.isNullable(child) {
+				return false
+			}
+		}
+		return true
+	case "Prefix":
+		switch n.Children[0].Name {
+		case "AND", "NOT", "CUT", "Predicate":
+			return true
+		}
+		return l.isNullable(n.Children[len(n.Children)-1])
+	case "Suffix":
+		if len(n.Children) > 1 && n.Children[1].Name != "PLUS" {
+			return true
+		}
+		return l.isNullable(n.Children[0])
+	case "Primary":
+		if id := n.Children[0]; id.Name == "Identifier" {
+			return l.nullable[id.Data()]
+		}
+		return l.isNullable(n.Children[0])
+	case "Precedence":
+		return l.nullable[n.Children[0].Data()]
+	case "BackReference":
+		return true
+	}
+	return false
+}
+
+// repetitions reports the repetitions in "n" of expressions that can
+// match nothing, which the generated parsers loop forever on
+func (l *linter) repetitions(n *Node) {
+	if n.Name == "Suffix" && len(n.Children) > 1 && n.Children[1].Name != "QUESTION" && l.isNullable(n.Children[0]) {
+		// The Primary of a parenthesized expression ends before the ")"
+		expr := strings.TrimSpace(n.Data())
+		l.report(SeverityError, n, "%s can match nothing, so repeating it never ends", strings.TrimSpace(expr[:len(expr)-1]))
+	}
+	for _, child := range n.Children {
+		l.repetitions(child)
+	}
+}
+
+// leftCalls adds the definitions "n" might call without consuming
+// any input first to "calls"
+func (l *linter) leftCalls(n *Node, calls map[string]bool) {
+	switch n.Name {
+	case "Sequence":
+		for _, child := range n.Children {
+			l.leftCalls(child, calls)
+			if !l.isNullable(child) {
+				return
+			}
+		}
+		return
+	case "Primary":
+		if id := n.Children[0]; id.Name == "Identifier" {
+			calls[id.Data()] = true
+			return
+		}
+	case "Precedence":
+		calls[n.Children[0].Data()] = true
+		return
+	}
+	for _, child := range n.Children {
+		l.leftCalls(child, calls)
+	}
+}
+
+// leftRecursion reports the definitions that may call themselves
+// without consuming any input, which the generated parsers recurse
+// on until the stack overflows
+func (l *linter) leftRecursion(order []*Node) {
+	calls := make(map[string]map[string]bool)
+	for name, exp := range l.defs {
+		calls[name] = make(map[string]bool)
+		l.leftCalls(exp, calls[name])
+	}
+	for _, def := range order {
+		name := def.Children[0].Data()
+		if path := findPath(calls, name, name, map[string]bool{}); path != nil {
+			l.report(SeverityError, def.Children[0], "%s is left recursive: %s", name, strings.Join(append([]string{name}, path...), " -> "))
+		}
+	}
+}
+
+// findPath returns a path of calls from "from" to "to"
+func findPath(calls map[string]map[string]bool, from, to string, visited map[string]bool) []string {
+	var next []string
+	for n := range calls[from] {
+		next = append(next, n)
+	}
+	sort.Strings(next)
+	for _, n := range next {
+		if n == to {
+			return []string{n}
+		}
+		if !visited[n] {
+			visited[n] = true
+			if path := findPath(calls, n, to, visited); path != nil {
+				return append([]string{n}, path...)
+			}
+		}
+	}
+	return nil
+}
+
+// reach marks "name" and the definitions it refers to as reached
+func (l *linter) reach(name string, reached map[string]bool) {
+	if reached[name] || l.defs[name] == nil {
+		return
+	}
+	reached[name] = true
+	var walk func(n *Node)
+	walk = func(n *Node) {
+		if n.Name == "Primary" || n.Name == "Precedence" {
+			if id := n.Children[0]; id.Name == "Identifier" {
+				l.reach(id.Data(), reached)
+			}
+		}
+		for _, child := range n.Children {
+			walk(child)
+		}
+	}
+	walk(l.defs[name])
+}
@@ -0,0 +1,160 @@
+/*
+Copyright (c) 2012-2013 Fredrik Ehnbom
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice, this
+   list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE LIABLE FOR
+ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+(INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+(INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+package lsp
+
+import (
+	"github.com/limetext/text"
+	"github.com/quarnster/parser"
+	"github.com/quarnster/parser/peg"
+	"strings"
+)
+
+type (
+	// document is an open grammar and what's known about it
+	document struct {
+		uri, text string
+		reader    parser.Reader
+		// The Definition nodes by the name they define, in the order
+		// they are written, and nil if the grammar didn't parse
+		defs  map[string]*parser.Node
+		order []*parser.Node
+		// The identifiers naming definitions: their own names,
+		// references to them and the value of the @start header
+		names []*parser.Node
+		diags []diagnostic
+	}
+)
+
+func newDocument(uri, data string) *document {
+	d := &document{uri: uri, text: data, reader: parser.NewReader(data)}
+	var p peg.Peg
+	if !p.Parse(data) {
+		e := p.Error()
+		d.diags = append(d.diags, d.diagnostic(text.Region{A: e.Offset(), B: e.Offset()}, severityError, e.Description()))
+		return d
+	}
+	root := p.RootNode()
+	if root.Children[len(root.Children)-1].Name != "EndOfFile" {
+		e := p.Error()
+		d.diags = append(d.diags, d.diagnostic(text.Region{A: e.Offset(), B: e.Offset()}, severityError, "the grammar didn't finish parsing: "+e.Description()))
+	}
+	d.defs = make(map[string]*parser.Node)
+	d.walk(root)
+	for _, l := range parser.Lint(root) {
+		severity := severityError
+		if l.Severity == parser.SeverityWarning {
+			severity = severityWarning
+		}
+		d.diags = append(d.diags, d.diagnostic(l.Range, severity, l.Message))
+	}
+	return d
+}
+
+// walk collects the definitions and the identifiers naming them in "n"
+func (d *document) walk(n *parser.Node) {
+	switch n.Name {
+	case "Definition":
+		name := n.Children[0]
+		if d.defs[name.Data()] == nil {
+			d.defs[name.Data()] = n
+		}
+		d.order = append(d.order, n)
+		d.names = append(d.names, name)
+	case "Header":
+		if n.Children[0].Data() == "start" {
+			d.names = append(d.names, n.Children[1])
+		}
+		return
+	case "Primary", "Precedence":
+		if id := n.Children[0]; id.Name == "Identifier" {
+			d.names = append(d.names, id)
+		}
+	case "Label", "BackReference", "Predicate":
+		return
+	}
+	for _, child := range n.Children {
+		d.walk(child)
+	}
+}
+
+// nameAt returns the identifier naming a definition at "pos"
+func (d *document) nameAt(pos position) *parser.Node {
+	offset := d.offset(pos)
+	for _, n := range d.names {
+		if n.Range.Contains(offset) {
+			return n
+		}
+	}
+	return nil
+}
+
+// occurrences returns the identifiers naming the definition "name",
+// optionally including the name of the definition itself
+func (d *document) occurrences(name string, declaration bool) (ret []*parser.Node) {
+	for _, n := range d.names {
+		if n.Data() == name && (declaration || d.defs[name] == nil || d.defs[name].Children[0] != n) {
+			ret = append(ret, n)
+		}
+	}
+	return
+}
+
+// body returns the source of the definition "def", without the white
+// space and comments trailing it
+func (d *document) body(def *parser.Node) text.Region {
+	lines := strings.Split(d.text[def.Range.Begin():def.Range.End()], "\n")
+	for len(lines) > 1 {
+		if l := strings.TrimSpace(lines[len(lines)-1]); l != "" && l[0] != '#' {
+			break
+		}
+		lines = lines[:len(lines)-1]
+	}
+	body := strings.TrimRight(strings.Join(lines, "\n"), " \t\r\n")
+	return text.Region{A: def.Range.Begin(), B: def.Range.Begin() + len(body)}
+}
+
+func (d *document) diagnostic(r text.Region, severity int, msg string) diagnostic {
+	return diagnostic{Range: d.lspRange(r), Severity: severity, Source: "pegparser", Message: msg}
+}
+
+func (d *document) location(r text.Region) location {
+	return location{URI: d.uri, Range: d.lspRange(r)}
+}
+
+func (d *document) lspRange(r text.Region) lspRange {
+	return lspRange{d.position(r.Begin()), d.position(r.End())}
+}
+
+// position converts the byte offset "offset" into a position
+func (d *document) position(offset int) position {
+	line, character := d.reader.LineColUTF16(offset)
+	return position{line - 1, character - 1}
+}
+
+// offset converts the position "pos" into a byte offset, clamped to
+// the end of its line
+func (d *document) offset(pos position) int {
+	return d.reader.OffsetUTF16(pos.Line+1, pos.Character+1)
+}
@@ -0,0 +1,331 @@
+/*
+Copyright (c) 2012-2013 Fredrik Ehnbom
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice, this
+   list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE LIABLE FOR
+ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+(INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+(INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+// Package lsp implements a Language Server Protocol server for grammars.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/quarnster/parser"
+	"io"
+	"net/textproto"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type (
+	// Server is a language server for the grammars peg.Peg parses,
+	// speaking JSON-RPC with the client through a reader and a writer.
+	// It reports parse errors and lint checks as diagnostics, and lets
+	// the client go to the definition of, find the references to,
+	// hover over and rename definitions, and list them as symbols.
+	Server struct {
+		in       *bufio.Reader
+		out      io.Writer
+		docs     map[string]*document
+		shutdown bool
+	}
+
+	// handler handles the params of a request, returning its result
+	handler func(s *Server, params json.RawMessage) (interface{}, error)
+)
+
+// ErrNoShutdown is returned by Serve when the client asks the server to
+// exit without shutting it down first
+var ErrNoShutdown = errors.New("exit without shutdown")
+
+var (
+	handlers = map[string]handler{
+		"initialize":                  (*Server).initialize,
+		"shutdown":                    (*Server).shutdownRequest,
+		"textDocument/definition":     (*Server).definition,
+		"textDocument/references":     (*Server).references,
+		"textDocument/hover":          (*Server).hover,
+		"textDocument/documentSymbol": (*Server).documentSymbol,
+		"textDocument/rename":         (*Server).rename,
+	}
+	identifier = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z_0-9]*$`)
+)
+
+// NewServer returns a Server reading the messages of the client from
+// "in" and writing its own to "out"
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{in: bufio.NewReader(in), out: out, docs: make(map[string]*document)}
+}
+
+// Serve handles the messages of the client until it asks the server to
+// exit or closes the connection
+func (s *Server) Serve() error {
+	for {
+		msg, err := s.read()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if msg == nil {
+			s.reply(nil, nil, &rpcError{parseError, "invalid JSON"})
+			continue
+		}
+		if msg.Method == "exit" {
+			if !s.shutdown {
+				return ErrNoShutdown
+			}
+			return nil
+		}
+		if msg.ID == nil {
+			s.notification(msg)
+			continue
+		}
+		h, ok := handlers[msg.Method]
+		switch {
+		case s.shutdown:
+			s.reply(msg.ID, nil, &rpcError{invalidRequest, "the server is shut down"})
+		case !ok:
+			s.reply(msg.ID, nil, &rpcError{methodNotFound, "unknown method " + msg.Method})
+		default:
+			if res, err := h(s, msg.Params); err != nil {
+				s.reply(msg.ID, nil, err)
+			} else {
+				s.reply(msg.ID, res, nil)
+			}
+		}
+	}
+}
+
+func (s *Server) read() (*message, error) {
+	return readMessage(s.in)
+}
+
+// readMessage reads the next message from "in", returning nil if it
+// isn't valid JSON
+func readMessage(in *bufio.Reader) (*message, error) {
+	header, err := textproto.NewReader(in).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid Content-Length %q", header.Get("Content-Length"))
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(in, data); err != nil {
+		return nil, err
+	}
+	var msg message
+	if json.Unmarshal(data, &msg) != nil {
+		return nil, nil
+	}
+	return &msg, nil
+}
+
+func (s *Server) write(msg interface{}) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", len(data), data)
+	return err
+}
+
+// reply writes the response to the request "id"
+func (s *Server) reply(id *json.RawMessage, result interface{}, err error) {
+	if id == nil {
+		null := json.RawMessage("null")
+		id = &null
+	}
+	msg := message{JSONRPC: "2.0", ID: id}
+	if err != nil {
+		e, ok := err.(*rpcError)
+		if !ok {
+			e = &rpcError{internalError, err.Error()}
+		}
+		msg.Error = e
+	} else if msg.Result, err = json.Marshal(result); err != nil {
+		msg.Error = &rpcError{internalError, err.Error()}
+	}
+	s.write(msg)
+}
+
+func (e *rpcError) Error() string {
+	return e.Message
+}
+
+// notification handles the notification "msg", ignoring those it
+// doesn't know
+func (s *Server) notification(msg *message) {
+	switch msg.Method {
+	case "textDocument/didOpen":
+		var p didOpenParams
+		if json.Unmarshal(msg.Params, &p) == nil {
+			s.update(p.TextDocument.URI, p.TextDocument.Text)
+		}
+	case "textDocument/didChange":
+		var p didChangeParams
+		if json.Unmarshal(msg.Params, &p) == nil && len(p.ContentChanges) > 0 {
+			s.update(p.TextDocument.URI, p.ContentChanges[len(p.ContentChanges)-1].Text)
+		}
+	case "textDocument/didClose":
+		var p didCloseParams
+		if json.Unmarshal(msg.Params, &p) == nil {
+			delete(s.docs, p.TextDocument.URI)
+			s.publish(p.TextDocument.URI, nil)
+		}
+	}
+}
+
+// update analyses the new text of the document "uri" and publishes its
+// diagnostics
+func (s *Server) update(uri, text string) {
+	d := newDocument(uri, text)
+	s.docs[uri] = d
+	s.publish(uri, d.diags)
+}
+
+func (s *Server) publish(uri string, diags []diagnostic) {
+	if diags == nil {
+		diags = []diagnostic{}
+	}
+	s.write(struct {
+		JSONRPC string                   `json:"jsonrpc"`
+		Method  string                   `json:"method"`
+		Params  publishDiagnosticsParams `json:"params"`
+	}{"2.0", "textDocument/publishDiagnostics", publishDiagnosticsParams{uri, diags}})
+}
+
+// at decodes the params of a request at a position in a document,
+// returning the document and the identifier naming a definition there
+func (s *Server) at(params json.RawMessage, p interface{}, tdp *textDocumentPositionParams) (*document, *parser.Node, error) {
+	if err := json.Unmarshal(params, p); err != nil {
+		return nil, nil, &rpcError{invalidParams, err.Error()}
+	}
+	d := s.docs[tdp.TextDocument.URI]
+	if d == nil {
+		return nil, nil, &rpcError{invalidParams, "unknown document " + tdp.TextDocument.URI}
+	}
+	return d, d.nameAt(tdp.Position), nil
+}
+
+func (s *Server) initialize(params json.RawMessage) (interface{}, error) {
+	return map[string]interface{}{
+		"capabilities": map[string]interface{}{
+			// Sends the full text of the document on each change
+			"textDocumentSync":       1,
+			"definitionProvider":     true,
+			"referencesProvider":     true,
+			"hoverProvider":          true,
+			"documentSymbolProvider": true,
+			"renameProvider":         true,
+		},
+		"serverInfo": map[string]string{"name": "pegparser"},
+	}, nil
+}
+
+func (s *Server) shutdownRequest(params json.RawMessage) (interface{}, error) {
+	s.shutdown = true
+	return nil, nil
+}
+
+func (s *Server) definition(params json.RawMessage) (interface{}, error) {
+	var p textDocumentPositionParams
+	d, name, err := s.at(params, &p, &p)
+	if err != nil || name == nil || d.defs[name.Data()] == nil {
+		return nil, err
+	}
+	return d.location(d.defs[name.Data()].Children[0].Range), nil
+}
+
+func (s *Server) references(params json.RawMessage) (interface{}, error) {
+	var p referenceParams
+	d, name, err := s.at(params, &p, &p.textDocumentPositionParams)
+	if err != nil {
+		return nil, err
+	}
+	ret := []location{}
+	if name != nil {
+		for _, n := range d.occurrences(name.Data(), p.Context.IncludeDeclaration) {
+			ret = append(ret, d.location(n.Range))
+		}
+	}
+	return ret, nil
+}
+
+func (s *Server) hover(params json.RawMessage) (interface{}, error) {
+	var p textDocumentPositionParams
+	d, name, err := s.at(params, &p, &p)
+	if err != nil || name == nil || d.defs[name.Data()] == nil {
+		return nil, err
+	}
+	body := d.body(d.defs[name.Data()])
+	return hover{
+		Contents: markupContent{"markdown", "```\n" + d.text[body.Begin():body.End()] + "\n```"},
+		Range:    d.lspRange(name.Range),
+	}, nil
+}
+
+func (s *Server) documentSymbol(params json.RawMessage) (interface{}, error) {
+	var p documentSymbolParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, &rpcError{invalidParams, err.Error()}
+	}
+	d := s.docs[p.TextDocument.URI]
+	if d == nil {
+		return nil, &rpcError{invalidParams, "unknown document " + p.TextDocument.URI}
+	}
+	ret := []documentSymbol{}
+	for _, def := range d.order {
+		body := d.body(def)
+		ret = append(ret, documentSymbol{
+			Name:           def.Children[0].Data(),
+			Detail:         strings.TrimSpace(d.text[def.Children[1].Range.Begin():body.End()]),
+			Kind:           symbolFunction,
+			Range:          d.lspRange(body),
+			SelectionRange: d.lspRange(def.Children[0].Range),
+		})
+	}
+	return ret, nil
+}
+
+func (s *Server) rename(params json.RawMessage) (interface{}, error) {
+	var p renameParams
+	d, name, err := s.at(params, &p, &p.textDocumentPositionParams)
+	if err != nil {
+		return nil, err
+	} else if name == nil {
+		return nil, &rpcError{invalidParams, "there's no definition to rename here"}
+	} else if !identifier.MatchString(p.NewName) {
+		return nil, &rpcError{invalidParams, fmt.Sprintf("%q isn't an identifier", p.NewName)}
+	} else if p.NewName != name.Data() && d.defs[p.NewName] != nil {
+		return nil, &rpcError{invalidParams, p.NewName + " is already defined"}
+	}
+	var edits []textEdit
+	for _, n := range d.occurrences(name.Data(), true) {
+		edits = append(edits, textEdit{d.lspRange(n.Range), p.NewName})
+	}
+	return workspaceEdit{map[string][]textEdit{d.uri: edits}}, nil
+}
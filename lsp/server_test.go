@@ -0,0 +1,228 @@
+/*
+Copyright (c) 2012-2013 Fredrik Ehnbom
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice, this
+   list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE LIABLE FOR
+ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+(INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+(INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+)
+
+// client is a scripted language client talking to a Server in-process
+type client struct {
+	t    *testing.T
+	in   *bufio.Reader
+	out  io.Writer
+	id   int
+	done chan error
+}
+
+func newClient(t *testing.T) *client {
+	sr, cw := io.Pipe()
+	cr, sw := io.Pipe()
+	c := &client{t: t, in: bufio.NewReader(cr), out: cw, done: make(chan error, 1)}
+	go func() {
+		c.done <- NewServer(sr, sw).Serve()
+		sw.Close()
+	}()
+	return c
+}
+
+func (c *client) send(msg map[string]interface{}) {
+	msg["jsonrpc"] = "2.0"
+	data, err := json.Marshal(msg)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	fmt.Fprintf(c.out, "Content-Length: %d\r\n\r\n%s", len(data), data)
+}
+
+func (c *client) notify(method string, params interface{}) {
+	c.send(map[string]interface{}{"method": method, "params": params})
+}
+
+// call sends the request and decodes its result into "result",
+// returning the error the server responded with if any
+func (c *client) call(method string, params, result interface{}) *rpcError {
+	c.id++
+	c.send(map[string]interface{}{"id": c.id, "method": method, "params": params})
+	msg := c.read()
+	if msg.ID == nil || string(*msg.ID) != fmt.Sprint(c.id) {
+		c.t.Fatalf("Expected the response to %s, not %+v", method, msg)
+	}
+	if msg.Error == nil && result != nil {
+		if err := json.Unmarshal(msg.Result, result); err != nil {
+			c.t.Fatal(err)
+		}
+	}
+	return msg.Error
+}
+
+func (c *client) read() *message {
+	msg, err := readMessage(c.in)
+	if err != nil || msg == nil {
+		c.t.Fatal("Expected a message:", err)
+	}
+	return msg
+}
+
+// diagnostics returns the diagnostics the server publishes next
+func (c *client) diagnostics() (ret publishDiagnosticsParams) {
+	msg := c.read()
+	if msg.Method != "textDocument/publishDiagnostics" {
+		c.t.Fatalf("Expected diagnostics, not %+v", msg)
+	}
+	json.Unmarshal(msg.Params, &ret)
+	return
+}
+
+func at(line, character int) textDocumentPositionParams {
+	return textDocumentPositionParams{textDocumentIdentifier{"file:///g.peg"}, position{line, character}}
+}
+
+func span(line, begin, end int) lspRange {
+	return lspRange{position{line, begin}, position{line, end}}
+}
+
+const grammar = `@start Grammar
+# rules
+Grammar <- Item+ !.
+Item    <- Word / Number
+Word    <- "😀" Number / [a-z]+ Spacing
+Number  <- [0-9]+
+Unused  <- 'x'
+`
+
+func TestServer(t *testing.T) {
+	c := newClient(t)
+	var caps struct {
+		Capabilities map[string]interface{}
+	}
+	if err := c.call("initialize", map[string]interface{}{}, &caps); err != nil {
+		t.Fatal(err)
+	}
+	for _, cap := range []string{"definitionProvider", "referencesProvider", "hoverProvider", "documentSymbolProvider", "renameProvider"} {
+		if caps.Capabilities[cap] != true {
+			t.Errorf("Expected the capability %s", cap)
+		}
+	}
+	c.notify("initialized", map[string]interface{}{})
+
+	c.notify("textDocument/didOpen", map[string]interface{}{"textDocument": map[string]interface{}{"uri": "file:///g.peg", "languageId": "peg", "version": 1, "text": grammar}})
+	if d, exp := c.diagnostics(), (publishDiagnosticsParams{"file:///g.peg", []diagnostic{
+		{span(4, 32, 39), severityError, "pegparser", "Word refers to the undefined Spacing"},
+		{span(6, 0, 6), severityWarning, "pegparser", "Unused is never used"},
+	}}); !reflect.DeepEqual(d, exp) {
+		t.Errorf("Expected the diagnostics %+v, not %+v", exp, d)
+	}
+
+	var loc *location
+	if c.call("textDocument/definition", at(3, 12), &loc); loc == nil || *loc != (location{"file:///g.peg", span(4, 0, 4)}) {
+		t.Errorf("Expected the definition of Word, not %+v", loc)
+	}
+	// After a character outside of the basic multilingual plane
+	if c.call("textDocument/definition", at(4, 18), &loc); loc == nil || *loc != (location{"file:///g.peg", span(5, 0, 6)}) {
+		t.Errorf("Expected the definition of Number, not %+v", loc)
+	}
+	loc = nil
+	if c.call("textDocument/definition", at(1, 3), &loc); loc != nil {
+		t.Errorf("Expected no definition in a comment, not %+v", loc)
+	}
+
+	var locs []location
+	c.call("textDocument/references", referenceParams{textDocumentPositionParams: at(5, 2)}, &locs)
+	if exp := []location{{"file:///g.peg", span(3, 18, 24)}, {"file:///g.peg", span(4, 16, 22)}}; !reflect.DeepEqual(locs, exp) {
+		t.Errorf("Expected the references %+v, not %+v", exp, locs)
+	}
+	p := referenceParams{textDocumentPositionParams: at(0, 9)}
+	p.Context.IncludeDeclaration = true
+	c.call("textDocument/references", p, &locs)
+	if exp := []location{{"file:///g.peg", span(0, 7, 14)}, {"file:///g.peg", span(2, 0, 7)}}; !reflect.DeepEqual(locs, exp) {
+		t.Errorf("Expected the references %+v, not %+v", exp, locs)
+	}
+
+	var h hover
+	c.call("textDocument/hover", at(2, 12), &h)
+	if exp := (hover{markupContent{"markdown", "```\nItem    <- Word / Number\n```"}, span(2, 11, 15)}); h != exp {
+		t.Errorf("Expected the hover %+v, not %+v", exp, h)
+	}
+
+	var syms []documentSymbol
+	c.call("textDocument/documentSymbol", documentSymbolParams{textDocumentIdentifier{"file:///g.peg"}}, &syms)
+	var names []string
+	for _, s := range syms {
+		names = append(names, s.Name)
+	}
+	if exp := []string{"Grammar", "Item", "Word", "Number", "Unused"}; !reflect.DeepEqual(names, exp) {
+		t.Errorf("Expected the symbols %v, not %v", exp, names)
+	} else if exp := (documentSymbol{"Item", "Word / Number", symbolFunction, span(3, 0, 24), span(3, 0, 4)}); syms[1] != exp {
+		t.Errorf("Expected the symbol %+v, not %+v", exp, syms[1])
+	}
+
+	var edit workspaceEdit
+	c.call("textDocument/rename", renameParams{at(3, 20), "Num"}, &edit)
+	if exp := map[string][]textEdit{"file:///g.peg": {{span(3, 18, 24), "Num"}, {span(4, 16, 22), "Num"}, {span(5, 0, 6), "Num"}}}; !reflect.DeepEqual(edit.Changes, exp) {
+		t.Errorf("Expected the edits %+v, not %+v", exp, edit.Changes)
+	}
+	for _, name := range []string{"9x", "Word"} {
+		if err := c.call("textDocument/rename", renameParams{at(3, 20), name}, nil); err == nil || err.Code != invalidParams {
+			t.Errorf("Expected renaming to %s to fail, not %v", name, err)
+		}
+	}
+
+	c.notify("textDocument/didChange", map[string]interface{}{"textDocument": map[string]interface{}{"uri": "file:///g.peg", "version": 2}, "contentChanges": []interface{}{map[string]interface{}{"text": "A <- 'a\n"}}})
+	if d := c.diagnostics(); len(d.Diagnostics) != 1 || d.Diagnostics[0].Severity != severityError {
+		t.Errorf("Expected a parse error, not %+v", d)
+	}
+	if c.call("textDocument/definition", at(0, 0), &loc); loc != nil {
+		t.Errorf("Expected no definition in a grammar that doesn't parse, not %+v", loc)
+	}
+	c.notify("textDocument/didClose", map[string]interface{}{"textDocument": map[string]interface{}{"uri": "file:///g.peg"}})
+	if d := c.diagnostics(); len(d.Diagnostics) != 0 {
+		t.Errorf("Expected the diagnostics to be cleared, not %+v", d)
+	}
+
+	if err := c.call("textDocument/formatting", map[string]interface{}{}, nil); err == nil || err.Code != methodNotFound {
+		t.Errorf("Expected an unknown method, not %v", err)
+	}
+	if err := c.call("shutdown", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	c.notify("exit", nil)
+	if err := <-c.done; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestExitWithoutShutdown(t *testing.T) {
+	c := newClient(t)
+	c.notify("exit", nil)
+	if err := <-c.done; err != ErrNoShutdown {
+		t.Errorf("Expected %v, not %v", ErrNoShutdown, err)
+	}
+}
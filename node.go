@@ -38,6 +38,14 @@ type (
 		Data(start, end int) string
 	}
 
+	// ByteSource is a DataSource that can return the data as a []byte
+	// without converting it from a string, as the generated parsers
+	// can when parsing a []byte
+	ByteSource interface {
+		DataSource
+		DataBytes(start, end int) []byte
+	}
+
 	// Node is the base structure used to represent a directed acyclic graph
 	Node struct {
 		// The Range this node occupies, as referenced to the DataSource.
@@ -77,6 +85,16 @@ func (n *Node) Data() string {
 	return n.P.Data(n.Range.Begin(), n.Range.End())
 }
 
+// DataBytes returns the data for this Node's Range like Data, but
+// without copying it when the DataSource is a ByteSource reading a
+// []byte. The returned slice must not be modified.
+func (n *Node) DataBytes() []byte {
+	if b, ok := n.P.(ByteSource); ok {
+		return b.DataBytes(n.Range.Begin(), n.Range.End())
+	}
+	return []byte(n.Data())
+}
+
 // String-function to satisfy the fmt.Stringer interface.
 // Returns an indented string representation of this node
 // and its sub-tree.
@@ -114,19 +132,30 @@ func (n *Node) Discard(pos int) {
 // Child-nodes starting after "end" will be in
 // neither "n" nor the new returned Node.
 func (n *Node) Cleanup(pos, end int) *Node {
-	var popped Node
-	popped.Range = text.Region{pos, end}
-	back := len(n.Children)
-	popIdx := 0
-	popEnd := back
+	return n.cleanup(nil, pos, end)
+}
+
+// ChildrenIn returns the children Cleanup(pos, end) would move into
+// the new Node, without moving them
+func (n *Node) ChildrenIn(pos, end int) []*Node {
+	popIdx, popEnd := n.span(pos, end)
+	if popEnd == 0 {
+		return nil
+	}
+	return n.Children[popIdx:popEnd]
+}
+
+// span returns the indices of the first child within pos and end and
+// of the one past the last
+func (n *Node) span(pos, end int) (popIdx, popEnd int) {
+	popEnd = len(n.Children)
 	if end == 0 {
 		end = -1
 	}
 	if pos == 0 {
 		pos = -1
 	}
-
-	for i := back - 1; i >= 0; i-- {
+	for i := len(n.Children) - 1; i >= 0; i-- {
 		node := n.Children[i]
 		if node.Range.End() <= pos {
 			popIdx = i + 1
@@ -136,17 +165,36 @@ func (n *Node) Cleanup(pos, end int) *Node {
 			popEnd = i + 1
 		}
 	}
+	return
+}
 
+// cleanup is Cleanup allocating the new Node in the arena "a", if any
+// and it allocates in chunks
+func (n *Node) cleanup(a *NodeArena, pos, end int) *Node {
+	pooled := a != nil && a.pooled
+	var popped *Node
+	if pooled {
+		popped = a.nodes.alloc()
+	} else {
+		popped = &Node{}
+	}
+	popped.Range = text.Region{pos, end}
+	back := len(n.Children)
+	popIdx, popEnd := n.span(pos, end)
 	if popEnd != 0 {
-		popped.Children = n.Children[popIdx:popEnd]
-		c := make([]*Node, len(popped.Children))
-		copy(c, popped.Children)
+		var c []*Node
+		if pooled {
+			c = a.children.alloc(popEnd - popIdx)
+		} else {
+			c = make([]*Node, popEnd-popIdx)
+		}
+		copy(c, n.Children[popIdx:popEnd])
 		popped.Children = c
 	}
 	if popIdx != back {
 		n.Children = n.Children[:popIdx]
 	}
-	return &popped
+	return popped
 }
 
 // Clones this node-sub tree
@@ -25,6 +25,8 @@ SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
 package parser
 
 import (
+	"github.com/limetext/text"
+	"strings"
 	"testing"
 )
 
@@ -46,3 +48,111 @@ func TestNodeClone(t *testing.T) {
 		t.Error("Should be equal", a, b)
 	}
 }
+
+type strds string
+
+func (s strds) Data(start, end int) string {
+	return string(s[start:end])
+}
+
+type byteds []byte
+
+func (s byteds) Data(start, end int) string {
+	return string(s[start:end])
+}
+
+func (s byteds) DataBytes(start, end int) []byte {
+	return s[start:end]
+}
+
+func TestNodeDataBytes(t *testing.T) {
+	b := byteds("abc")
+	n := Node{P: b, Range: text.Region{1, 3}}
+	if d := n.DataBytes(); string(d) != "bc" || &d[0] != &b[1] {
+		t.Errorf("Expected the data of a ByteSource without copying, not %q", d)
+	}
+	n.P = strds("abc")
+	if d := n.DataBytes(); string(d) != "bc" {
+		t.Errorf("Expected the data of a DataSource, not %q", d)
+	}
+}
+
+func TestNodeArena(t *testing.T) {
+	var (
+		s ds
+		a NodeArena
+	)
+	build := func() *Node {
+		root := Node{Name: "Root", P: s}
+		for i := 0; i < 100; i++ {
+			root.Append(a.New(Node{Name: "Leaf", P: s, Range: text.Region{i, i + 1}}))
+			if i%3 == 2 {
+				n := a.Cleanup(&root, i-2, i+1)
+				n.Name = "Three"
+				root.Append(n)
+			}
+		}
+		return &root
+	}
+	first := build()
+	want := first.String()
+	a.Drop()
+	if second := build(); second.String() != want {
+		t.Errorf("Expected the same tree after dropping the nodes, not\n%s", second)
+	} else if first.String() != want {
+		t.Errorf("Expected the dropped tree not to change, not\n%s", first)
+	}
+	a.Release()
+	if third := build(); third.String() != want {
+		t.Errorf("Expected the same tree after releasing the nodes, not\n%s", third)
+	} else if n := testing.AllocsPerRun(10, func() { a.Release(); build() }); n > 10 {
+		t.Errorf("Expected the released nodes to be reused, not %v allocations", n)
+	}
+	// Dropping a tree allocated in chunks keeps it valid as well
+	a.Release()
+	fourth := build()
+	a.Drop()
+	if fifth := build(); fifth.String() != want {
+		t.Errorf("Expected the same tree after dropping the released nodes, not\n%s", fifth)
+	} else if fourth.String() != want {
+		t.Errorf("Expected the dropped tree not to change, not\n%s", fourth)
+	}
+}
+
+func exportTree() *Node {
+	s := strds(`a <"b">`)
+	n := &Node{Name: "Root", P: s, Range: text.Region{0, 7}}
+	n.Children = append(n.Children, &Node{Name: "A", P: s, Range: text.Region{0, 1}}, &Node{Name: "B", P: s, Range: text.Region{2, 7}})
+	n.Children[1].Children = append(n.Children[1].Children, &Node{Name: "Quoted", P: s, Range: text.Region{3, 6}})
+	return n
+}
+
+func TestNodeDot(t *testing.T) {
+	exp := `digraph tree {
+	node [shape=box, fontname="monospace"];
+	n0 [label="Root\n0-7"];
+	n0 -> n1;
+	n1 [label="A\n0-1\n\"a\""];
+	n0 -> n2;
+	n2 [label="B\n2-7"];
+	n2 -> n3;
+	n3 [label="Quoted\n3-6\n\"\\\"b\\\"\""];
+}
+`
+	if d := exportTree().Dot(); d != exp {
+		t.Errorf("Expected:\n%s\nReceived:\n%s", exp, d)
+	}
+}
+
+func TestNodeHTML(t *testing.T) {
+	h := exportTree().HTML()
+	for _, exp := range []string{
+		`<pre id="source"><span id="s0"><span id="s1">a</span> <span id="s2">&lt;<span id="s3">&#34;b&#34;</span>&gt;</span></span></pre>`,
+		`<summary data-id="2">B <span class="range">2-7</span></summary>`,
+		`<div class="leaf" data-id="3">Quoted <span class="range">3-6</span> <span class="data">&#34;\&#34;b\&#34;&#34;</span></div>`,
+	} {
+		if !strings.Contains(h, exp) {
+			t.Errorf("Expected %q in:\n%s", exp, h)
+		}
+	}
+}
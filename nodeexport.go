@@ -0,0 +1,144 @@
+/*
+Copyright (c) 2012-2013 Fredrik Ehnbom
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice, this
+   list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE LIABLE FOR
+ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+(INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+(INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"strings"
+)
+
+var dotEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+
+// Dot returns a Graphviz DOT representation of this node
+// and its sub-tree.
+func (n *Node) Dot() string {
+	buf := bytes.NewBufferString("digraph tree {\n\tnode [shape=box, fontname=\"monospace\"];\n")
+	id := 0
+	n.dot(buf, &id)
+	buf.WriteString("}\n")
+	return buf.String()
+}
+
+// dot is a helper function used by Dot for recursively
+// adding the node statements and edges to "buf".
+func (n *Node) dot(buf *bytes.Buffer, id *int) {
+	me := *id
+	*id++
+	label := fmt.Sprintf("%s\n%d-%d", n.Name, n.Range.Begin(), n.Range.End())
+	if len(n.Children) == 0 {
+		label += fmt.Sprintf("\n%q", n.Data())
+	}
+	fmt.Fprintf(buf, "\tn%d [label=\"%s\"];\n", me, dotEscaper.Replace(label))
+	for _, child := range n.Children {
+		fmt.Fprintf(buf, "\tn%d -> n%d;\n", me, *id)
+		child.dot(buf, id)
+	}
+}
+
+const (
+	htmlHeader = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>%s</title>
+<style>
+body { display: flex; margin: 0; height: 100vh; font-family: monospace; }
+#tree, #source { flex: 1; overflow: auto; margin: 0; padding: 1em; }
+#tree { border-right: 1px solid #ccc; }
+#tree details, #tree .leaf { margin-left: 1em; }
+#tree summary, #tree .leaf { cursor: pointer; }
+#tree .range { color: #888; }
+#tree .data { color: #a31515; }
+#source .hl { background: #ffe58f; }
+</style>
+</head>
+<body>
+<div id="tree">
+`
+	htmlFooter = `<script>
+Array.prototype.forEach.call(document.querySelectorAll("[data-id]"), function(e) {
+	var s = document.getElementById("s" + e.getAttribute("data-id"));
+	e.addEventListener("mouseover", function(ev) {
+		ev.stopPropagation();
+		Array.prototype.forEach.call(document.querySelectorAll(".hl"), function(h) { h.classList.remove("hl"); });
+		s.classList.add("hl");
+	});
+	e.addEventListener("click", function() { s.scrollIntoView({block: "nearest"}); });
+});
+</script>
+</body>
+</html>
+`
+)
+
+// HTML returns a self-contained HTML page showing this node and
+// its sub-tree as a collapsible tree next to the source text, in
+// which the range of the node under the mouse is highlighted.
+func (n *Node) HTML() string {
+	var tree, src bytes.Buffer
+	id, pos := 0, 0
+	n.html(&tree, &src, &id, &pos, n.Range.End())
+	return fmt.Sprintf(htmlHeader, html.EscapeString(n.Name)) + tree.String() +
+		"</div>\n<pre id=\"source\">" + src.String() + "</pre>\n" + htmlFooter
+}
+
+// html is a helper function used by HTML for recursively adding
+// this node to the tree in "tree" and wrapping its range of the
+// source text in "src" into a span. Text is written to "src" up
+// until "pos", and the span is kept within the parent's "limit".
+func (n *Node) html(tree, src *bytes.Buffer, id, pos *int, limit int) {
+	me := *id
+	*id++
+	a, b := n.Range.Begin(), n.Range.End()
+	if a < *pos {
+		a = *pos
+	}
+	if b > limit {
+		b = limit
+	}
+	if b < a {
+		b = a
+	}
+	src.WriteString(html.EscapeString(n.P.Data(*pos, a)))
+	fmt.Fprintf(src, `<span id="s%d">`, me)
+	*pos = a
+
+	label := fmt.Sprintf(`%s <span class="range">%d-%d</span>`, html.EscapeString(n.Name), n.Range.Begin(), n.Range.End())
+	if len(n.Children) == 0 {
+		fmt.Fprintf(tree, "<div class=\"leaf\" data-id=\"%d\">%s <span class=\"data\">%s</span></div>\n", me, label, html.EscapeString(fmt.Sprintf("%q", n.Data())))
+	} else {
+		fmt.Fprintf(tree, "<details open>\n<summary data-id=\"%d\">%s</summary>\n", me, label)
+		for _, child := range n.Children {
+			child.html(tree, src, id, pos, b)
+		}
+		tree.WriteString("</details>\n")
+	}
+
+	src.WriteString(html.EscapeString(n.P.Data(*pos, b)))
+	src.WriteString("</span>")
+	*pos = b
+}
@@ -26,6 +26,7 @@ SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
 package peg
 
 import (
+	"context"
 	"github.com/limetext/text"
 	. "github.com/quarnster/parser"
 )
@@ -35,6 +36,9 @@ type Peg struct {
 	IgnoreRange text.Region
 	Root        Node
 	LastError   int
+	Limits      Limits
+	limiter     *Limiter
+	arena       NodeArena
 }
 
 func (p *Peg) RootNode() *Node {
@@ -42,10 +46,32 @@ func (p *Peg) RootNode() *Node {
 }
 
 func (p *Peg) SetData(data string) {
-	p.ParserData = NewReader(data)
+	p.SetReader(NewReader(data))
+}
+
+// SetBytes is SetData for a []byte, which the parser reads without
+// copying. It must not change while the parser is in use, nor while
+// the slices DataBytes returns are.
+func (p *Peg) SetBytes(data []byte) {
+	p.SetReader(NewBytesReader(data))
+}
+
+// SetReader makes the parser start over with the data of "r"
+func (p *Peg) SetReader(r Reader) {
+	p.ParserData = r
 	p.Root = Node{Name: "Peg", P: p}
 	p.IgnoreRange = text.Region{}
 	p.LastError = 0
+	p.limiter = NewLimiter(context.Background(), p.Limits, p.ParserData)
+	p.arena.Drop()
+}
+
+// Release hands the nodes of the tree parsed last back to the parser,
+// which reuses them when parsing again. Neither the tree nor any node
+// of it may be used afterwards.
+func (p *Peg) Release() {
+	p.arena.Release()
+	p.Root = Node{Name: "Peg", P: p}
 }
 
 func (p *Peg) Parse(data string) bool {
@@ -55,11 +81,41 @@ func (p *Peg) Parse(data string) bool {
 	return ret
 }
 
+// ParseContext parses data like Parse, but gives up when "ctx" is done
+// or the parse exceeds p.Limits, the Error then being a *LimitError
+func (p *Peg) ParseContext(ctx context.Context, data string) bool {
+	p.SetData(data)
+	p.limiter = NewLimiter(ctx, p.Limits, p.ParserData)
+	ret := p.realParse()
+	p.Root.UpdateRange()
+	return ret
+}
+
+// ParseBytes is Parse for a []byte, which isn't copied. See SetBytes.
+func (p *Peg) ParseBytes(data []byte) bool {
+	p.SetBytes(data)
+	ret := p.realParse()
+	p.Root.UpdateRange()
+	return ret
+}
+
 func (p *Peg) Data(start, end int) string {
 	return p.ParserData.Substring(start, end)
 }
 
+// DataBytes returns the data between "start" and "end", without
+// copying it if the parser is reading a []byte
+func (p *Peg) DataBytes(start, end int) []byte {
+	if r, ok := p.ParserData.(ByteReader); ok {
+		return r.Bytes(start, end)
+	}
+	return []byte(p.ParserData.Substring(start, end))
+}
+
 func (p *Peg) Error() Error {
+	if err := p.limiter.Err(); err != nil {
+		return err
+	}
 	errstr := ""
 	line, column := p.ParserData.LineCol(p.LastError)
 
@@ -73,14 +129,129 @@ func (p *Peg) Error() Error {
 			errstr = "Unexpected " + string(r)
 		}
 	}
-	return NewError(line, column, errstr)
+	return NewErrorAt(p.LastError, line, column, errstr)
 }
 
 func (p *Peg) realParse() bool {
-	return p.Grammar()
+	return p.parse(p.Grammar)
+}
+
+// ParseRule parses data starting at the definition "name", returning
+// false if there's no such definition
+func (p *Peg) ParseRule(name, data string) bool {
+	var rule func() bool
+	switch name {
+	case "Grammar":
+		rule = p.Grammar
+	case "Header":
+		rule = p.Header
+	case "Lexical":
+		rule = p.Lexical
+	case "Trivia":
+		rule = p.Trivia
+	case "Definition":
+		rule = p.Definition
+	case "Precedence":
+		rule = p.Precedence
+	case "Level":
+		rule = p.Level
+	case "Associativity":
+		rule = p.Associativity
+	case "Expression":
+		rule = p.Expression
+	case "Sequence":
+		rule = p.Sequence
+	case "Prefix":
+		rule = p.Prefix
+	case "Label":
+		rule = p.Label
+	case "Predicate":
+		rule = p.Predicate
+	case "Suffix":
+		rule = p.Suffix
+	case "Primary":
+		rule = p.Primary
+	case "BackReference":
+		rule = p.BackReference
+	case "Identifier":
+		rule = p.Identifier
+	case "IdentStart":
+		rule = p.IdentStart
+	case "IdentCont":
+		rule = p.IdentCont
+	case "Literal":
+		rule = p.Literal
+	case "Class":
+		rule = p.Class
+	case "Range":
+		rule = p.Range
+	case "Char":
+		rule = p.Char
+	case "Hex":
+		rule = p.Hex
+	case "Code":
+		rule = p.Code
+	case "Braces":
+		rule = p.Braces
+	case "GoLiteral":
+		rule = p.GoLiteral
+	case "LEFTARROW":
+		rule = p.LEFTARROW
+	case "SLASH":
+		rule = p.SLASH
+	case "AND":
+		rule = p.AND
+	case "NOT":
+		rule = p.NOT
+	case "CUT":
+		rule = p.CUT
+	case "QUESTION":
+		rule = p.QUESTION
+	case "STAR":
+		rule = p.STAR
+	case "PLUS":
+		rule = p.PLUS
+	case "OPEN":
+		rule = p.OPEN
+	case "CLOSE":
+		rule = p.CLOSE
+	case "DOT":
+		rule = p.DOT
+	case "Spacing":
+		rule = p.Spacing
+	case "Comment":
+		rule = p.Comment
+	case "Space":
+		rule = p.Space
+	case "EndOfLine":
+		rule = p.EndOfLine
+	case "EndOfFile":
+		rule = p.EndOfFile
+	default:
+		return false
+	}
+	p.SetData(data)
+	ret := p.parse(rule)
+	p.Root.UpdateRange()
+	return ret
+}
+
+func (p *Peg) parse(rule func() bool) (accept bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(*LimitError); !ok {
+				panic(r)
+			}
+			accept = false
+		}
+	}()
+	return rule()
 }
 func (p *Peg) Grammar() bool {
-	// Grammar       <- Spacing Definition+ EndOfFile?
+	// Grammar       <- Spacing Header* Definition+ Lexical? EndOfFile?
+	if p.limiter != nil {
+		p.limiter.Enter(p.ParserData.Pos())
+	}
 	accept := false
 	accept = true
 	start := p.ParserData.Pos()
@@ -89,21 +260,34 @@ func (p *Peg) Grammar() bool {
 		accept = p.Spacing()
 		if accept {
 			{
-				save := p.ParserData.Pos()
-				accept = p.Definition()
-				if !accept {
-					p.ParserData.Seek(save)
-				} else {
-					for accept {
-						accept = p.Definition()
-					}
-					accept = true
+				accept = true
+				for accept {
+					accept = p.Header()
 				}
+				accept = true
 			}
 			if accept {
-				accept = p.EndOfFile()
-				accept = true
+				{
+					save := p.ParserData.Pos()
+					accept = p.Definition()
+					if !accept {
+						p.ParserData.Seek(save)
+					} else {
+						for accept {
+							accept = p.Definition()
+						}
+						accept = true
+					}
+				}
 				if accept {
+					accept = p.Lexical()
+					accept = true
+					if accept {
+						accept = p.EndOfFile()
+						accept = true
+						if accept {
+						}
+					}
 				}
 			}
 		}
@@ -115,26 +299,37 @@ func (p *Peg) Grammar() bool {
 		}
 	}
 	if accept && start != p.ParserData.Pos() {
-		if start < p.IgnoreRange.A || p.IgnoreRange.A == 0 {
+		if start < p.IgnoreRange.A || p.IgnoreRange.A == 0 || start > p.IgnoreRange.B {
 			p.IgnoreRange.A = start
 		}
 		p.IgnoreRange.B = p.ParserData.Pos()
 	}
+	if p.limiter != nil {
+		p.limiter.Exit()
+	}
 	return accept
 }
 
-func (p *Peg) Definition() bool {
-	// Definition    <- Identifier LEFTARROW Expression
+func (p *Peg) Header() bool {
+	// Header        <- '@' Identifier Identifier
+	if p.limiter != nil {
+		p.limiter.Enter(p.ParserData.Pos())
+	}
 	accept := false
 	accept = true
 	start := p.ParserData.Pos()
 	{
 		save := p.ParserData.Pos()
-		accept = p.Identifier()
+		if p.ParserData.Read() != '@' {
+			p.ParserData.UnRead()
+			accept = false
+		} else {
+			accept = true
+		}
 		if accept {
-			accept = p.LEFTARROW()
+			accept = p.Identifier()
 			if accept {
-				accept = p.Expression()
+				accept = p.Identifier()
 				if accept {
 				}
 			}
@@ -148,51 +343,105 @@ func (p *Peg) Definition() bool {
 	}
 	end := p.ParserData.Pos()
 	if accept {
-		node := p.Root.Cleanup(start, end)
-		node.Name = "Definition"
+		node := p.arena.Cleanup(&p.Root, start, end)
+		node.Name = "Header"
 		node.P = p
 		node.Range = node.Range.Clip(p.IgnoreRange)
 		p.Root.Append(node)
+		if p.limiter != nil {
+			p.limiter.Node(end)
+		}
 	} else {
 		p.Root.Discard(start)
 	}
 	if p.IgnoreRange.A >= end || p.IgnoreRange.B <= start {
 		p.IgnoreRange = text.Region{}
 	}
+	if p.limiter != nil {
+		p.limiter.Exit()
+	}
 	return accept
 }
 
-func (p *Peg) Expression() bool {
-	// Expression    <- Sequence (SLASH Sequence)*
+func (p *Peg) Lexical() bool {
+	// Lexical       <- "%lexical" Spacing '{' Spacing (Trivia / Definition)+ '}' Spacing
+	if p.limiter != nil {
+		p.limiter.Enter(p.ParserData.Pos())
+	}
 	accept := false
 	accept = true
 	start := p.ParserData.Pos()
 	{
 		save := p.ParserData.Pos()
-		accept = p.Sequence()
+		{
+			accept = true
+			s := p.ParserData.Pos()
+			if p.ParserData.Read() != '%' || p.ParserData.Read() != 'l' || p.ParserData.Read() != 'e' || p.ParserData.Read() != 'x' || p.ParserData.Read() != 'i' || p.ParserData.Read() != 'c' || p.ParserData.Read() != 'a' || p.ParserData.Read() != 'l' {
+				p.ParserData.Seek(s)
+				accept = false
+			}
+		}
 		if accept {
-			{
-				accept = true
-				for accept {
-					{
-						save := p.ParserData.Pos()
-						accept = p.SLASH()
-						if accept {
-							accept = p.Sequence()
-							if accept {
+			accept = p.Spacing()
+			if accept {
+				if p.ParserData.Read() != '{' {
+					p.ParserData.UnRead()
+					accept = false
+				} else {
+					accept = true
+				}
+				if accept {
+					accept = p.Spacing()
+					if accept {
+						{
+							save := p.ParserData.Pos()
+							{
+								save := p.ParserData.Pos()
+								accept = p.Trivia()
+								if !accept {
+									accept = p.Definition()
+									if !accept {
+									}
+								}
+								if !accept {
+									p.ParserData.Seek(save)
+								}
+							}
+							if !accept {
+								p.ParserData.Seek(save)
+							} else {
+								for accept {
+									{
+										save := p.ParserData.Pos()
+										accept = p.Trivia()
+										if !accept {
+											accept = p.Definition()
+											if !accept {
+											}
+										}
+										if !accept {
+											p.ParserData.Seek(save)
+										}
+									}
+								}
+								accept = true
 							}
 						}
-						if !accept {
-							if p.LastError < p.ParserData.Pos() {
-								p.LastError = p.ParserData.Pos()
+						if accept {
+							if p.ParserData.Read() != '}' {
+								p.ParserData.UnRead()
+								accept = false
+							} else {
+								accept = true
+							}
+							if accept {
+								accept = p.Spacing()
+								if accept {
+								}
 							}
-							p.ParserData.Seek(save)
 						}
 					}
 				}
-				accept = true
-			}
-			if accept {
 			}
 		}
 		if !accept {
@@ -204,76 +453,50 @@ func (p *Peg) Expression() bool {
 	}
 	end := p.ParserData.Pos()
 	if accept {
-		node := p.Root.Cleanup(start, end)
-		node.Name = "Expression"
+		node := p.arena.Cleanup(&p.Root, start, end)
+		node.Name = "Lexical"
 		node.P = p
 		node.Range = node.Range.Clip(p.IgnoreRange)
 		p.Root.Append(node)
-	} else {
-		p.Root.Discard(start)
-	}
-	if p.IgnoreRange.A >= end || p.IgnoreRange.B <= start {
-		p.IgnoreRange = text.Region{}
-	}
-	return accept
-}
-
-func (p *Peg) Sequence() bool {
-	// Sequence      <- Prefix+
-	accept := false
-	accept = true
-	start := p.ParserData.Pos()
-	{
-		save := p.ParserData.Pos()
-		accept = p.Prefix()
-		if !accept {
-			p.ParserData.Seek(save)
-		} else {
-			for accept {
-				accept = p.Prefix()
-			}
-			accept = true
+		if p.limiter != nil {
+			p.limiter.Node(end)
 		}
-	}
-	end := p.ParserData.Pos()
-	if accept {
-		node := p.Root.Cleanup(start, end)
-		node.Name = "Sequence"
-		node.P = p
-		node.Range = node.Range.Clip(p.IgnoreRange)
-		p.Root.Append(node)
 	} else {
 		p.Root.Discard(start)
 	}
 	if p.IgnoreRange.A >= end || p.IgnoreRange.B <= start {
 		p.IgnoreRange = text.Region{}
 	}
+	if p.limiter != nil {
+		p.limiter.Exit()
+	}
 	return accept
 }
 
-func (p *Peg) Prefix() bool {
-	// Prefix        <- (AND / NOT)? Suffix
+func (p *Peg) Trivia() bool {
+	// Trivia        <- "%trivia" Spacing Definition
+	if p.limiter != nil {
+		p.limiter.Enter(p.ParserData.Pos())
+	}
 	accept := false
 	accept = true
 	start := p.ParserData.Pos()
 	{
 		save := p.ParserData.Pos()
 		{
-			save := p.ParserData.Pos()
-			accept = p.AND()
-			if !accept {
-				accept = p.NOT()
-				if !accept {
-				}
-			}
-			if !accept {
-				p.ParserData.Seek(save)
+			accept = true
+			s := p.ParserData.Pos()
+			if p.ParserData.Read() != '%' || p.ParserData.Read() != 't' || p.ParserData.Read() != 'r' || p.ParserData.Read() != 'i' || p.ParserData.Read() != 'v' || p.ParserData.Read() != 'i' || p.ParserData.Read() != 'a' {
+				p.ParserData.Seek(s)
+				accept = false
 			}
 		}
-		accept = true
 		if accept {
-			accept = p.Suffix()
+			accept = p.Spacing()
 			if accept {
+				accept = p.Definition()
+				if accept {
+				}
 			}
 		}
 		if !accept {
@@ -285,47 +508,55 @@ func (p *Peg) Prefix() bool {
 	}
 	end := p.ParserData.Pos()
 	if accept {
-		node := p.Root.Cleanup(start, end)
-		node.Name = "Prefix"
+		node := p.arena.Cleanup(&p.Root, start, end)
+		node.Name = "Trivia"
 		node.P = p
 		node.Range = node.Range.Clip(p.IgnoreRange)
 		p.Root.Append(node)
+		if p.limiter != nil {
+			p.limiter.Node(end)
+		}
 	} else {
 		p.Root.Discard(start)
 	}
 	if p.IgnoreRange.A >= end || p.IgnoreRange.B <= start {
 		p.IgnoreRange = text.Region{}
 	}
+	if p.limiter != nil {
+		p.limiter.Exit()
+	}
 	return accept
 }
 
-func (p *Peg) Suffix() bool {
-	// Suffix        <- Primary (QUESTION / STAR / PLUS)?
+func (p *Peg) Definition() bool {
+	// Definition    <- Identifier LEFTARROW (Precedence / Expression)
+	if p.limiter != nil {
+		p.limiter.Enter(p.ParserData.Pos())
+	}
 	accept := false
 	accept = true
 	start := p.ParserData.Pos()
 	{
 		save := p.ParserData.Pos()
-		accept = p.Primary()
+		accept = p.Identifier()
 		if accept {
-			{
-				save := p.ParserData.Pos()
-				accept = p.QUESTION()
-				if !accept {
-					accept = p.STAR()
+			accept = p.LEFTARROW()
+			if accept {
+				{
+					save := p.ParserData.Pos()
+					accept = p.Precedence()
 					if !accept {
-						accept = p.PLUS()
+						accept = p.Expression()
 						if !accept {
 						}
 					}
+					if !accept {
+						p.ParserData.Seek(save)
+					}
 				}
-				if !accept {
-					p.ParserData.Seek(save)
+				if accept {
 				}
 			}
-			accept = true
-			if accept {
-			}
 		}
 		if !accept {
 			if p.LastError < p.ParserData.Pos() {
@@ -336,120 +567,185 @@ func (p *Peg) Suffix() bool {
 	}
 	end := p.ParserData.Pos()
 	if accept {
-		node := p.Root.Cleanup(start, end)
-		node.Name = "Suffix"
+		node := p.arena.Cleanup(&p.Root, start, end)
+		node.Name = "Definition"
 		node.P = p
 		node.Range = node.Range.Clip(p.IgnoreRange)
 		p.Root.Append(node)
+		if p.limiter != nil {
+			p.limiter.Node(end)
+		}
 	} else {
 		p.Root.Discard(start)
 	}
 	if p.IgnoreRange.A >= end || p.IgnoreRange.B <= start {
 		p.IgnoreRange = text.Region{}
 	}
+	if p.limiter != nil {
+		p.limiter.Exit()
+	}
 	return accept
 }
 
-func (p *Peg) Primary() bool {
-	// Primary       <- Identifier !LEFTARROW
-	//                / OPEN Expression CLOSE
-	//                / Literal / Class / DOT
-	// # Lexical syntax
+func (p *Peg) Precedence() bool {
+	// Precedence    <- "%prec" Spacing Identifier '{' Spacing Level (';' Spacing Level)* (';' Spacing)? '}' Spacing
+	if p.limiter != nil {
+		p.limiter.Enter(p.ParserData.Pos())
+	}
 	accept := false
 	accept = true
 	start := p.ParserData.Pos()
 	{
 		save := p.ParserData.Pos()
 		{
-			save := p.ParserData.Pos()
-			accept = p.Identifier()
-			if accept {
-				s := p.ParserData.Pos()
-				accept = p.LEFTARROW()
+			accept = true
+			s := p.ParserData.Pos()
+			if p.ParserData.Read() != '%' || p.ParserData.Read() != 'p' || p.ParserData.Read() != 'r' || p.ParserData.Read() != 'e' || p.ParserData.Read() != 'c' {
 				p.ParserData.Seek(s)
-				p.Root.Discard(s)
-				accept = !accept
-				if accept {
-				}
-			}
-			if !accept {
-				if p.LastError < p.ParserData.Pos() {
-					p.LastError = p.ParserData.Pos()
-				}
-				p.ParserData.Seek(save)
+				accept = false
 			}
 		}
-		if !accept {
-			{
-				save := p.ParserData.Pos()
-				accept = p.OPEN()
-				if accept {
-					accept = p.Expression()
+		if accept {
+			accept = p.Spacing()
+			if accept {
+				accept = p.Identifier()
+				if accept {
+					if p.ParserData.Read() != '{' {
+						p.ParserData.UnRead()
+						accept = false
+					} else {
+						accept = true
+					}
 					if accept {
-						accept = p.CLOSE()
+						accept = p.Spacing()
 						if accept {
-						}
-					}
-				}
-				if !accept {
-					if p.LastError < p.ParserData.Pos() {
-						p.LastError = p.ParserData.Pos()
-					}
-					p.ParserData.Seek(save)
-				}
-			}
-			if !accept {
-				accept = p.Literal()
-				if !accept {
-					accept = p.Class()
-					if !accept {
-						accept = p.DOT()
-						if !accept {
+							accept = p.Level()
+							if accept {
+								{
+									accept = true
+									for accept {
+										{
+											save := p.ParserData.Pos()
+											if p.ParserData.Read() != ';' {
+												p.ParserData.UnRead()
+												accept = false
+											} else {
+												accept = true
+											}
+											if accept {
+												accept = p.Spacing()
+												if accept {
+													accept = p.Level()
+													if accept {
+													}
+												}
+											}
+											if !accept {
+												if p.LastError < p.ParserData.Pos() {
+													p.LastError = p.ParserData.Pos()
+												}
+												p.ParserData.Seek(save)
+											}
+										}
+									}
+									accept = true
+								}
+								if accept {
+									{
+										save := p.ParserData.Pos()
+										if p.ParserData.Read() != ';' {
+											p.ParserData.UnRead()
+											accept = false
+										} else {
+											accept = true
+										}
+										if accept {
+											accept = p.Spacing()
+											if accept {
+											}
+										}
+										if !accept {
+											if p.LastError < p.ParserData.Pos() {
+												p.LastError = p.ParserData.Pos()
+											}
+											p.ParserData.Seek(save)
+										}
+									}
+									accept = true
+									if accept {
+										if p.ParserData.Read() != '}' {
+											p.ParserData.UnRead()
+											accept = false
+										} else {
+											accept = true
+										}
+										if accept {
+											accept = p.Spacing()
+											if accept {
+											}
+										}
+									}
+								}
+							}
 						}
 					}
 				}
 			}
 		}
 		if !accept {
+			if p.LastError < p.ParserData.Pos() {
+				p.LastError = p.ParserData.Pos()
+			}
 			p.ParserData.Seek(save)
 		}
 	}
 	end := p.ParserData.Pos()
 	if accept {
-		node := p.Root.Cleanup(start, end)
-		node.Name = "Primary"
+		node := p.arena.Cleanup(&p.Root, start, end)
+		node.Name = "Precedence"
 		node.P = p
 		node.Range = node.Range.Clip(p.IgnoreRange)
 		p.Root.Append(node)
+		if p.limiter != nil {
+			p.limiter.Node(end)
+		}
 	} else {
 		p.Root.Discard(start)
 	}
 	if p.IgnoreRange.A >= end || p.IgnoreRange.B <= start {
 		p.IgnoreRange = text.Region{}
 	}
+	if p.limiter != nil {
+		p.limiter.Exit()
+	}
 	return accept
 }
 
-func (p *Peg) Identifier() bool {
-	// Identifier    <- IdentStart IdentCont* Spacing
+func (p *Peg) Level() bool {
+	// Level         <- Associativity Literal+
+	if p.limiter != nil {
+		p.limiter.Enter(p.ParserData.Pos())
+	}
 	accept := false
 	accept = true
 	start := p.ParserData.Pos()
 	{
 		save := p.ParserData.Pos()
-		accept = p.IdentStart()
+		accept = p.Associativity()
 		if accept {
 			{
-				accept = true
-				for accept {
-					accept = p.IdentCont()
+				save := p.ParserData.Pos()
+				accept = p.Literal()
+				if !accept {
+					p.ParserData.Seek(save)
+				} else {
+					for accept {
+						accept = p.Literal()
+					}
+					accept = true
 				}
-				accept = true
 			}
 			if accept {
-				accept = p.Spacing()
-				if accept {
-				}
 			}
 		}
 		if !accept {
@@ -461,238 +757,251 @@ func (p *Peg) Identifier() bool {
 	}
 	end := p.ParserData.Pos()
 	if accept {
-		node := p.Root.Cleanup(start, end)
-		node.Name = "Identifier"
+		node := p.arena.Cleanup(&p.Root, start, end)
+		node.Name = "Level"
 		node.P = p
 		node.Range = node.Range.Clip(p.IgnoreRange)
 		p.Root.Append(node)
+		if p.limiter != nil {
+			p.limiter.Node(end)
+		}
 	} else {
 		p.Root.Discard(start)
 	}
 	if p.IgnoreRange.A >= end || p.IgnoreRange.B <= start {
 		p.IgnoreRange = text.Region{}
 	}
+	if p.limiter != nil {
+		p.limiter.Exit()
+	}
 	return accept
 }
 
-func (p *Peg) IdentStart() bool {
-	// IdentStart    <- [a-zA-Z_]
+func (p *Peg) Associativity() bool {
+	// Associativity <- ("left" / "right") Spacing
+	if p.limiter != nil {
+		p.limiter.Enter(p.ParserData.Pos())
+	}
 	accept := false
+	accept = true
+	start := p.ParserData.Pos()
 	{
 		save := p.ParserData.Pos()
-		c := p.ParserData.Read()
-		if c >= 'a' && c <= 'z' {
-			accept = true
-		} else {
-			p.ParserData.UnRead()
-			accept = false
-		}
-		if !accept {
-			c := p.ParserData.Read()
-			if c >= 'A' && c <= 'Z' {
+		{
+			save := p.ParserData.Pos()
+			{
 				accept = true
-			} else {
-				p.ParserData.UnRead()
-				accept = false
+				s := p.ParserData.Pos()
+				if p.ParserData.Read() != 'l' || p.ParserData.Read() != 'e' || p.ParserData.Read() != 'f' || p.ParserData.Read() != 't' {
+					p.ParserData.Seek(s)
+					accept = false
+				}
 			}
 			if !accept {
 				{
-					accept = false
-					c := p.ParserData.Read()
-					if c == '_' {
-						accept = true
-					} else {
-						p.ParserData.UnRead()
+					accept = true
+					s := p.ParserData.Pos()
+					if p.ParserData.Read() != 'r' || p.ParserData.Read() != 'i' || p.ParserData.Read() != 'g' || p.ParserData.Read() != 'h' || p.ParserData.Read() != 't' {
+						p.ParserData.Seek(s)
+						accept = false
 					}
 				}
 				if !accept {
 				}
 			}
+			if !accept {
+				p.ParserData.Seek(save)
+			}
+		}
+		if accept {
+			accept = p.Spacing()
+			if accept {
+			}
 		}
 		if !accept {
+			if p.LastError < p.ParserData.Pos() {
+				p.LastError = p.ParserData.Pos()
+			}
 			p.ParserData.Seek(save)
 		}
 	}
+	end := p.ParserData.Pos()
+	if accept {
+		node := p.arena.Cleanup(&p.Root, start, end)
+		node.Name = "Associativity"
+		node.P = p
+		node.Range = node.Range.Clip(p.IgnoreRange)
+		p.Root.Append(node)
+		if p.limiter != nil {
+			p.limiter.Node(end)
+		}
+	} else {
+		p.Root.Discard(start)
+	}
+	if p.IgnoreRange.A >= end || p.IgnoreRange.B <= start {
+		p.IgnoreRange = text.Region{}
+	}
+	if p.limiter != nil {
+		p.limiter.Exit()
+	}
 	return accept
 }
 
-func (p *Peg) IdentCont() bool {
-	// IdentCont     <- IdentStart / [0-9]
+func (p *Peg) Expression() bool {
+	// Expression    <- Sequence (SLASH Sequence)*
+	if p.limiter != nil {
+		p.limiter.Enter(p.ParserData.Pos())
+	}
 	accept := false
+	accept = true
+	start := p.ParserData.Pos()
 	{
 		save := p.ParserData.Pos()
-		accept = p.IdentStart()
-		if !accept {
-			c := p.ParserData.Read()
-			if c >= '0' && c <= '9' {
+		accept = p.Sequence()
+		if accept {
+			{
+				accept = true
+				for accept {
+					{
+						save := p.ParserData.Pos()
+						accept = p.SLASH()
+						if accept {
+							accept = p.Sequence()
+							if accept {
+							}
+						}
+						if !accept {
+							if p.LastError < p.ParserData.Pos() {
+								p.LastError = p.ParserData.Pos()
+							}
+							p.ParserData.Seek(save)
+						}
+					}
+				}
 				accept = true
-			} else {
-				p.ParserData.UnRead()
-				accept = false
 			}
-			if !accept {
+			if accept {
 			}
 		}
 		if !accept {
+			if p.LastError < p.ParserData.Pos() {
+				p.LastError = p.ParserData.Pos()
+			}
 			p.ParserData.Seek(save)
 		}
 	}
+	end := p.ParserData.Pos()
+	if accept {
+		node := p.arena.Cleanup(&p.Root, start, end)
+		node.Name = "Expression"
+		node.P = p
+		node.Range = node.Range.Clip(p.IgnoreRange)
+		p.Root.Append(node)
+		if p.limiter != nil {
+			p.limiter.Node(end)
+		}
+	} else {
+		p.Root.Discard(start)
+	}
+	if p.IgnoreRange.A >= end || p.IgnoreRange.B <= start {
+		p.IgnoreRange = text.Region{}
+	}
+	if p.limiter != nil {
+		p.limiter.Exit()
+	}
 	return accept
 }
 
-func (p *Peg) Literal() bool {
-	// Literal       <- '\'' (!'\'' Char) '\'' Spacing
-	//                / '"' (!'"' Char)+ '"' Spacing
+func (p *Peg) Sequence() bool {
+	// Sequence      <- Prefix+
+	if p.limiter != nil {
+		p.limiter.Enter(p.ParserData.Pos())
+	}
 	accept := false
 	accept = true
 	start := p.ParserData.Pos()
 	{
 		save := p.ParserData.Pos()
-		{
-			save := p.ParserData.Pos()
-			if p.ParserData.Read() != '\'' {
-				p.ParserData.UnRead()
-				accept = false
-			} else {
-				accept = true
+		accept = p.Prefix()
+		if !accept {
+			p.ParserData.Seek(save)
+		} else {
+			for accept {
+				accept = p.Prefix()
 			}
-			if accept {
+			accept = true
+		}
+	}
+	end := p.ParserData.Pos()
+	if accept {
+		node := p.arena.Cleanup(&p.Root, start, end)
+		node.Name = "Sequence"
+		node.P = p
+		node.Range = node.Range.Clip(p.IgnoreRange)
+		p.Root.Append(node)
+		if p.limiter != nil {
+			p.limiter.Node(end)
+		}
+	} else {
+		p.Root.Discard(start)
+	}
+	if p.IgnoreRange.A >= end || p.IgnoreRange.B <= start {
+		p.IgnoreRange = text.Region{}
+	}
+	if p.limiter != nil {
+		p.limiter.Exit()
+	}
+	return accept
+}
+
+func (p *Peg) Prefix() bool {
+	// Prefix        <- Predicate / CUT / (AND / NOT)? Label? Suffix
+	if p.limiter != nil {
+		p.limiter.Enter(p.ParserData.Pos())
+	}
+	accept := false
+	accept = true
+	start := p.ParserData.Pos()
+	{
+		save := p.ParserData.Pos()
+		accept = p.Predicate()
+		if !accept {
+			accept = p.CUT()
+			if !accept {
 				{
 					save := p.ParserData.Pos()
-					s := p.ParserData.Pos()
-					if p.ParserData.Read() != '\'' {
-						p.ParserData.UnRead()
-						accept = false
-					} else {
-						accept = true
-					}
-					p.ParserData.Seek(s)
-					p.Root.Discard(s)
-					accept = !accept
-					if accept {
-						accept = p.Char()
-						if accept {
-						}
-					}
-					if !accept {
-						if p.LastError < p.ParserData.Pos() {
-							p.LastError = p.ParserData.Pos()
-						}
-						p.ParserData.Seek(save)
-					}
-				}
-				if accept {
-					if p.ParserData.Read() != '\'' {
-						p.ParserData.UnRead()
-						accept = false
-					} else {
-						accept = true
-					}
-					if accept {
-						accept = p.Spacing()
-						if accept {
-						}
-					}
-				}
-			}
-			if !accept {
-				if p.LastError < p.ParserData.Pos() {
-					p.LastError = p.ParserData.Pos()
-				}
-				p.ParserData.Seek(save)
-			}
-		}
-		if !accept {
-			{
-				save := p.ParserData.Pos()
-				if p.ParserData.Read() != '"' {
-					p.ParserData.UnRead()
-					accept = false
-				} else {
-					accept = true
-				}
-				if accept {
 					{
 						save := p.ParserData.Pos()
-						{
-							save := p.ParserData.Pos()
-							s := p.ParserData.Pos()
-							if p.ParserData.Read() != '"' {
-								p.ParserData.UnRead()
-								accept = false
-							} else {
-								accept = true
-							}
-							p.ParserData.Seek(s)
-							p.Root.Discard(s)
-							accept = !accept
-							if accept {
-								accept = p.Char()
-								if accept {
-								}
-							}
+						accept = p.AND()
+						if !accept {
+							accept = p.NOT()
 							if !accept {
-								if p.LastError < p.ParserData.Pos() {
-									p.LastError = p.ParserData.Pos()
-								}
-								p.ParserData.Seek(save)
 							}
 						}
 						if !accept {
 							p.ParserData.Seek(save)
-						} else {
-							for accept {
-								{
-									save := p.ParserData.Pos()
-									s := p.ParserData.Pos()
-									if p.ParserData.Read() != '"' {
-										p.ParserData.UnRead()
-										accept = false
-									} else {
-										accept = true
-									}
-									p.ParserData.Seek(s)
-									p.Root.Discard(s)
-									accept = !accept
-									if accept {
-										accept = p.Char()
-										if accept {
-										}
-									}
-									if !accept {
-										if p.LastError < p.ParserData.Pos() {
-											p.LastError = p.ParserData.Pos()
-										}
-										p.ParserData.Seek(save)
-									}
-								}
-							}
-							accept = true
 						}
 					}
+					accept = true
 					if accept {
-						if p.ParserData.Read() != '"' {
-							p.ParserData.UnRead()
-							accept = false
-						} else {
-							accept = true
-						}
+						accept = p.Label()
+						accept = true
 						if accept {
-							accept = p.Spacing()
+							accept = p.Suffix()
 							if accept {
 							}
 						}
 					}
+					if !accept {
+						if p.LastError < p.ParserData.Pos() {
+							p.LastError = p.ParserData.Pos()
+						}
+						p.ParserData.Seek(save)
+					}
 				}
 				if !accept {
-					if p.LastError < p.ParserData.Pos() {
-						p.LastError = p.ParserData.Pos()
-					}
-					p.ParserData.Seek(save)
 				}
 			}
-			if !accept {
-			}
 		}
 		if !accept {
 			p.ParserData.Seek(save)
@@ -700,103 +1009,47 @@ func (p *Peg) Literal() bool {
 	}
 	end := p.ParserData.Pos()
 	if accept {
-		node := p.Root.Cleanup(start, end)
-		node.Name = "Literal"
+		node := p.arena.Cleanup(&p.Root, start, end)
+		node.Name = "Prefix"
 		node.P = p
 		node.Range = node.Range.Clip(p.IgnoreRange)
 		p.Root.Append(node)
+		if p.limiter != nil {
+			p.limiter.Node(end)
+		}
 	} else {
 		p.Root.Discard(start)
 	}
 	if p.IgnoreRange.A >= end || p.IgnoreRange.B <= start {
 		p.IgnoreRange = text.Region{}
 	}
+	if p.limiter != nil {
+		p.limiter.Exit()
+	}
 	return accept
 }
 
-func (p *Peg) Class() bool {
-	// Class         <- '[' (!']' Range)+ ']' Spacing
+func (p *Peg) Label() bool {
+	// Label         <- Identifier ':' Spacing
+	if p.limiter != nil {
+		p.limiter.Enter(p.ParserData.Pos())
+	}
 	accept := false
 	accept = true
 	start := p.ParserData.Pos()
 	{
 		save := p.ParserData.Pos()
-		if p.ParserData.Read() != '[' {
-			p.ParserData.UnRead()
-			accept = false
-		} else {
-			accept = true
-		}
+		accept = p.Identifier()
 		if accept {
-			{
-				save := p.ParserData.Pos()
-				{
-					save := p.ParserData.Pos()
-					s := p.ParserData.Pos()
-					if p.ParserData.Read() != ']' {
-						p.ParserData.UnRead()
-						accept = false
-					} else {
-						accept = true
-					}
-					p.ParserData.Seek(s)
-					p.Root.Discard(s)
-					accept = !accept
-					if accept {
-						accept = p.Range()
-						if accept {
-						}
-					}
-					if !accept {
-						if p.LastError < p.ParserData.Pos() {
-							p.LastError = p.ParserData.Pos()
-						}
-						p.ParserData.Seek(save)
-					}
-				}
-				if !accept {
-					p.ParserData.Seek(save)
-				} else {
-					for accept {
-						{
-							save := p.ParserData.Pos()
-							s := p.ParserData.Pos()
-							if p.ParserData.Read() != ']' {
-								p.ParserData.UnRead()
-								accept = false
-							} else {
-								accept = true
-							}
-							p.ParserData.Seek(s)
-							p.Root.Discard(s)
-							accept = !accept
-							if accept {
-								accept = p.Range()
-								if accept {
-								}
-							}
-							if !accept {
-								if p.LastError < p.ParserData.Pos() {
-									p.LastError = p.ParserData.Pos()
-								}
-								p.ParserData.Seek(save)
-							}
-						}
-					}
-					accept = true
-				}
+			if p.ParserData.Read() != ':' {
+				p.ParserData.UnRead()
+				accept = false
+			} else {
+				accept = true
 			}
 			if accept {
-				if p.ParserData.Read() != ']' {
-					p.ParserData.UnRead()
-					accept = false
-				} else {
-					accept = true
-				}
+				accept = p.Spacing()
 				if accept {
-					accept = p.Spacing()
-					if accept {
-					}
 				}
 			}
 		}
@@ -809,22 +1062,31 @@ func (p *Peg) Class() bool {
 	}
 	end := p.ParserData.Pos()
 	if accept {
-		node := p.Root.Cleanup(start, end)
-		node.Name = "Class"
+		node := p.arena.Cleanup(&p.Root, start, end)
+		node.Name = "Label"
 		node.P = p
 		node.Range = node.Range.Clip(p.IgnoreRange)
 		p.Root.Append(node)
+		if p.limiter != nil {
+			p.limiter.Node(end)
+		}
 	} else {
 		p.Root.Discard(start)
 	}
 	if p.IgnoreRange.A >= end || p.IgnoreRange.B <= start {
 		p.IgnoreRange = text.Region{}
 	}
+	if p.limiter != nil {
+		p.limiter.Exit()
+	}
 	return accept
 }
 
-func (p *Peg) Range() bool {
-	// Range         <- Char '-' Char / Char
+func (p *Peg) Predicate() bool {
+	// Predicate     <- (AND / NOT) '{' Code '}' Spacing
+	if p.limiter != nil {
+		p.limiter.Enter(p.ParserData.Pos())
+	}
 	accept := false
 	accept = true
 	start := p.ParserData.Pos()
@@ -832,59 +1094,136 @@ func (p *Peg) Range() bool {
 		save := p.ParserData.Pos()
 		{
 			save := p.ParserData.Pos()
-			accept = p.Char()
-			if accept {
-				if p.ParserData.Read() != '-' {
-					p.ParserData.UnRead()
-					accept = false
-				} else {
-					accept = true
-				}
-				if accept {
-					accept = p.Char()
-					if accept {
-					}
+			accept = p.AND()
+			if !accept {
+				accept = p.NOT()
+				if !accept {
 				}
 			}
 			if !accept {
-				if p.LastError < p.ParserData.Pos() {
-					p.LastError = p.ParserData.Pos()
-				}
 				p.ParserData.Seek(save)
 			}
 		}
-		if !accept {
-			accept = p.Char()
-			if !accept {
+		if accept {
+			if p.ParserData.Read() != '{' {
+				p.ParserData.UnRead()
+				accept = false
+			} else {
+				accept = true
+			}
+			if accept {
+				accept = p.Code()
+				if accept {
+					if p.ParserData.Read() != '}' {
+						p.ParserData.UnRead()
+						accept = false
+					} else {
+						accept = true
+					}
+					if accept {
+						accept = p.Spacing()
+						if accept {
+						}
+					}
+				}
 			}
 		}
 		if !accept {
+			if p.LastError < p.ParserData.Pos() {
+				p.LastError = p.ParserData.Pos()
+			}
 			p.ParserData.Seek(save)
 		}
 	}
 	end := p.ParserData.Pos()
 	if accept {
-		node := p.Root.Cleanup(start, end)
-		node.Name = "Range"
+		node := p.arena.Cleanup(&p.Root, start, end)
+		node.Name = "Predicate"
 		node.P = p
 		node.Range = node.Range.Clip(p.IgnoreRange)
 		p.Root.Append(node)
+		if p.limiter != nil {
+			p.limiter.Node(end)
+		}
 	} else {
 		p.Root.Discard(start)
 	}
 	if p.IgnoreRange.A >= end || p.IgnoreRange.B <= start {
 		p.IgnoreRange = text.Region{}
 	}
+	if p.limiter != nil {
+		p.limiter.Exit()
+	}
 	return accept
 }
 
-func (p *Peg) Char() bool {
-	// Char          <- '\\' [nrt'"\[\]\\]
-	//                / '\\' [0-2][0-7][0-7]
-	//                / '\\' [0-7][0-7]?
-	//                / "\\u" Hex Hex Hex Hex
-	//                / "\\U" Hex Hex Hex Hex Hex Hex Hex Hex
-	//                / !'\\' .
+func (p *Peg) Suffix() bool {
+	// Suffix        <- Primary (QUESTION / STAR / PLUS)?
+	if p.limiter != nil {
+		p.limiter.Enter(p.ParserData.Pos())
+	}
+	accept := false
+	accept = true
+	start := p.ParserData.Pos()
+	{
+		save := p.ParserData.Pos()
+		accept = p.Primary()
+		if accept {
+			{
+				save := p.ParserData.Pos()
+				accept = p.QUESTION()
+				if !accept {
+					accept = p.STAR()
+					if !accept {
+						accept = p.PLUS()
+						if !accept {
+						}
+					}
+				}
+				if !accept {
+					p.ParserData.Seek(save)
+				}
+			}
+			accept = true
+			if accept {
+			}
+		}
+		if !accept {
+			if p.LastError < p.ParserData.Pos() {
+				p.LastError = p.ParserData.Pos()
+			}
+			p.ParserData.Seek(save)
+		}
+	}
+	end := p.ParserData.Pos()
+	if accept {
+		node := p.arena.Cleanup(&p.Root, start, end)
+		node.Name = "Suffix"
+		node.P = p
+		node.Range = node.Range.Clip(p.IgnoreRange)
+		p.Root.Append(node)
+		if p.limiter != nil {
+			p.limiter.Node(end)
+		}
+	} else {
+		p.Root.Discard(start)
+	}
+	if p.IgnoreRange.A >= end || p.IgnoreRange.B <= start {
+		p.IgnoreRange = text.Region{}
+	}
+	if p.limiter != nil {
+		p.limiter.Exit()
+	}
+	return accept
+}
+
+func (p *Peg) Primary() bool {
+	// Primary       <- Identifier !LEFTARROW
+	//                / OPEN Expression CLOSE
+	//                / Literal / Class / DOT / BackReference
+	if p.limiter != nil {
+		p.limiter.Enter(p.ParserData.Pos())
+	}
 	accept := false
 	accept = true
 	start := p.ParserData.Pos()
@@ -892,22 +1231,13 @@ func (p *Peg) Char() bool {
 		save := p.ParserData.Pos()
 		{
 			save := p.ParserData.Pos()
-			if p.ParserData.Read() != '\\' {
-				p.ParserData.UnRead()
-				accept = false
-			} else {
-				accept = true
-			}
+			accept = p.Identifier()
 			if accept {
-				{
-					accept = false
-					c := p.ParserData.Read()
-					if c == 'n' || c == 'r' || c == 't' || c == '\'' || c == '"' || c == '[' || c == ']' || c == '\\' {
-						accept = true
-					} else {
-						p.ParserData.UnRead()
-					}
-				}
+				s := p.ParserData.Pos()
+				accept = p.LEFTARROW()
+				p.ParserData.Seek(s)
+				p.Root.Discard(s)
+				accept = !accept
 				if accept {
 				}
 			}
@@ -921,38 +1251,12 @@ func (p *Peg) Char() bool {
 		if !accept {
 			{
 				save := p.ParserData.Pos()
-				if p.ParserData.Read() != '\\' {
-					p.ParserData.UnRead()
-					accept = false
-				} else {
-					accept = true
-				}
+				accept = p.OPEN()
 				if accept {
-					c := p.ParserData.Read()
-					if c >= '0' && c <= '2' {
-						accept = true
-					} else {
-						p.ParserData.UnRead()
-						accept = false
-					}
+					accept = p.Expression()
 					if accept {
-						c := p.ParserData.Read()
-						if c >= '0' && c <= '7' {
-							accept = true
-						} else {
-							p.ParserData.UnRead()
-							accept = false
-						}
+						accept = p.CLOSE()
 						if accept {
-							c := p.ParserData.Read()
-							if c >= '0' && c <= '7' {
-								accept = true
-							} else {
-								p.ParserData.UnRead()
-								accept = false
-							}
-							if accept {
-							}
 						}
 					}
 				}
@@ -964,204 +1268,1354 @@ func (p *Peg) Char() bool {
 				}
 			}
 			if !accept {
-				{
-					save := p.ParserData.Pos()
-					if p.ParserData.Read() != '\\' {
-						p.ParserData.UnRead()
-						accept = false
-					} else {
-						accept = true
-					}
-					if accept {
-						c := p.ParserData.Read()
-						if c >= '0' && c <= '7' {
-							accept = true
-						} else {
-							p.ParserData.UnRead()
-							accept = false
-						}
-						if accept {
-							c := p.ParserData.Read()
-							if c >= '0' && c <= '7' {
-								accept = true
-							} else {
-								p.ParserData.UnRead()
-								accept = false
-							}
-							accept = true
-							if accept {
-							}
-						}
-					}
-					if !accept {
-						if p.LastError < p.ParserData.Pos() {
-							p.LastError = p.ParserData.Pos()
-						}
-						p.ParserData.Seek(save)
-					}
-				}
+				accept = p.Literal()
 				if !accept {
-					{
-						save := p.ParserData.Pos()
-						{
-							accept = true
-							s := p.ParserData.Pos()
-							if p.ParserData.Read() != '\\' || p.ParserData.Read() != 'u' {
-								p.ParserData.Seek(s)
-								accept = false
-							}
-						}
-						if accept {
-							accept = p.Hex()
-							if accept {
-								accept = p.Hex()
-								if accept {
-									accept = p.Hex()
-									if accept {
-										accept = p.Hex()
-										if accept {
-										}
-									}
-								}
-							}
-						}
+					accept = p.Class()
+					if !accept {
+						accept = p.DOT()
 						if !accept {
-							if p.LastError < p.ParserData.Pos() {
-								p.LastError = p.ParserData.Pos()
+							accept = p.BackReference()
+							if !accept {
 							}
-							p.ParserData.Seek(save)
 						}
 					}
-					if !accept {
-						{
-							save := p.ParserData.Pos()
-							{
-								accept = true
-								s := p.ParserData.Pos()
-								if p.ParserData.Read() != '\\' || p.ParserData.Read() != 'U' {
-									p.ParserData.Seek(s)
-									accept = false
+				}
+			}
+		}
+		if !accept {
+			p.ParserData.Seek(save)
+		}
+	}
+	end := p.ParserData.Pos()
+	if accept {
+		node := p.arena.Cleanup(&p.Root, start, end)
+		node.Name = "Primary"
+		node.P = p
+		node.Range = node.Range.Clip(p.IgnoreRange)
+		p.Root.Append(node)
+		if p.limiter != nil {
+			p.limiter.Node(end)
+		}
+	} else {
+		p.Root.Discard(start)
+	}
+	if p.IgnoreRange.A >= end || p.IgnoreRange.B <= start {
+		p.IgnoreRange = text.Region{}
+	}
+	if p.limiter != nil {
+		p.limiter.Exit()
+	}
+	return accept
+}
+
+func (p *Peg) BackReference() bool {
+	// BackReference <- '=' Identifier
+	// # Lexical syntax
+	if p.limiter != nil {
+		p.limiter.Enter(p.ParserData.Pos())
+	}
+	accept := false
+	accept = true
+	start := p.ParserData.Pos()
+	{
+		save := p.ParserData.Pos()
+		if p.ParserData.Read() != '=' {
+			p.ParserData.UnRead()
+			accept = false
+		} else {
+			accept = true
+		}
+		if accept {
+			accept = p.Identifier()
+			if accept {
+			}
+		}
+		if !accept {
+			if p.LastError < p.ParserData.Pos() {
+				p.LastError = p.ParserData.Pos()
+			}
+			p.ParserData.Seek(save)
+		}
+	}
+	end := p.ParserData.Pos()
+	if accept {
+		node := p.arena.Cleanup(&p.Root, start, end)
+		node.Name = "BackReference"
+		node.P = p
+		node.Range = node.Range.Clip(p.IgnoreRange)
+		p.Root.Append(node)
+		if p.limiter != nil {
+			p.limiter.Node(end)
+		}
+	} else {
+		p.Root.Discard(start)
+	}
+	if p.IgnoreRange.A >= end || p.IgnoreRange.B <= start {
+		p.IgnoreRange = text.Region{}
+	}
+	if p.limiter != nil {
+		p.limiter.Exit()
+	}
+	return accept
+}
+
+func (p *Peg) Identifier() bool {
+	// Identifier    <- IdentStart IdentCont* Spacing
+	if p.limiter != nil {
+		p.limiter.Enter(p.ParserData.Pos())
+	}
+	accept := false
+	accept = true
+	start := p.ParserData.Pos()
+	{
+		save := p.ParserData.Pos()
+		accept = p.IdentStart()
+		if accept {
+			{
+				accept = true
+				for accept {
+					accept = p.IdentCont()
+				}
+				accept = true
+			}
+			if accept {
+				accept = p.Spacing()
+				if accept {
+				}
+			}
+		}
+		if !accept {
+			if p.LastError < p.ParserData.Pos() {
+				p.LastError = p.ParserData.Pos()
+			}
+			p.ParserData.Seek(save)
+		}
+	}
+	end := p.ParserData.Pos()
+	if accept {
+		node := p.arena.Cleanup(&p.Root, start, end)
+		node.Name = "Identifier"
+		node.P = p
+		node.Range = node.Range.Clip(p.IgnoreRange)
+		p.Root.Append(node)
+		if p.limiter != nil {
+			p.limiter.Node(end)
+		}
+	} else {
+		p.Root.Discard(start)
+	}
+	if p.IgnoreRange.A >= end || p.IgnoreRange.B <= start {
+		p.IgnoreRange = text.Region{}
+	}
+	if p.limiter != nil {
+		p.limiter.Exit()
+	}
+	return accept
+}
+
+func (p *Peg) IdentStart() bool {
+	// IdentStart    <- [a-zA-Z_]
+	if p.limiter != nil {
+		p.limiter.Enter(p.ParserData.Pos())
+	}
+	accept := false
+	{
+		save := p.ParserData.Pos()
+		c := p.ParserData.Read()
+		if c >= 'a' && c <= 'z' {
+			accept = true
+		} else {
+			p.ParserData.UnRead()
+			accept = false
+		}
+		if !accept {
+			c := p.ParserData.Read()
+			if c >= 'A' && c <= 'Z' {
+				accept = true
+			} else {
+				p.ParserData.UnRead()
+				accept = false
+			}
+			if !accept {
+				{
+					accept = false
+					c := p.ParserData.Read()
+					if c == '_' {
+						accept = true
+					} else {
+						p.ParserData.UnRead()
+					}
+				}
+				if !accept {
+				}
+			}
+		}
+		if !accept {
+			p.ParserData.Seek(save)
+		}
+	}
+	if p.limiter != nil {
+		p.limiter.Exit()
+	}
+	return accept
+}
+
+func (p *Peg) IdentCont() bool {
+	// IdentCont     <- IdentStart / [0-9]
+	if p.limiter != nil {
+		p.limiter.Enter(p.ParserData.Pos())
+	}
+	accept := false
+	{
+		save := p.ParserData.Pos()
+		accept = p.IdentStart()
+		if !accept {
+			c := p.ParserData.Read()
+			if c >= '0' && c <= '9' {
+				accept = true
+			} else {
+				p.ParserData.UnRead()
+				accept = false
+			}
+			if !accept {
+			}
+		}
+		if !accept {
+			p.ParserData.Seek(save)
+		}
+	}
+	if p.limiter != nil {
+		p.limiter.Exit()
+	}
+	return accept
+}
+
+func (p *Peg) Literal() bool {
+	// Literal       <- '\'' (!'\'' Char) '\'' Spacing
+	//                / '"' (!'"' Char)+ '"' Spacing
+	if p.limiter != nil {
+		p.limiter.Enter(p.ParserData.Pos())
+	}
+	accept := false
+	accept = true
+	start := p.ParserData.Pos()
+	{
+		save := p.ParserData.Pos()
+		{
+			save := p.ParserData.Pos()
+			if p.ParserData.Read() != '\'' {
+				p.ParserData.UnRead()
+				accept = false
+			} else {
+				accept = true
+			}
+			if accept {
+				{
+					save := p.ParserData.Pos()
+					s := p.ParserData.Pos()
+					if p.ParserData.Read() != '\'' {
+						p.ParserData.UnRead()
+						accept = false
+					} else {
+						accept = true
+					}
+					p.ParserData.Seek(s)
+					p.Root.Discard(s)
+					accept = !accept
+					if accept {
+						accept = p.Char()
+						if accept {
+						}
+					}
+					if !accept {
+						if p.LastError < p.ParserData.Pos() {
+							p.LastError = p.ParserData.Pos()
+						}
+						p.ParserData.Seek(save)
+					}
+				}
+				if accept {
+					if p.ParserData.Read() != '\'' {
+						p.ParserData.UnRead()
+						accept = false
+					} else {
+						accept = true
+					}
+					if accept {
+						accept = p.Spacing()
+						if accept {
+						}
+					}
+				}
+			}
+			if !accept {
+				if p.LastError < p.ParserData.Pos() {
+					p.LastError = p.ParserData.Pos()
+				}
+				p.ParserData.Seek(save)
+			}
+		}
+		if !accept {
+			{
+				save := p.ParserData.Pos()
+				if p.ParserData.Read() != '"' {
+					p.ParserData.UnRead()
+					accept = false
+				} else {
+					accept = true
+				}
+				if accept {
+					{
+						save := p.ParserData.Pos()
+						{
+							save := p.ParserData.Pos()
+							s := p.ParserData.Pos()
+							if p.ParserData.Read() != '"' {
+								p.ParserData.UnRead()
+								accept = false
+							} else {
+								accept = true
+							}
+							p.ParserData.Seek(s)
+							p.Root.Discard(s)
+							accept = !accept
+							if accept {
+								accept = p.Char()
+								if accept {
+								}
+							}
+							if !accept {
+								if p.LastError < p.ParserData.Pos() {
+									p.LastError = p.ParserData.Pos()
+								}
+								p.ParserData.Seek(save)
+							}
+						}
+						if !accept {
+							p.ParserData.Seek(save)
+						} else {
+							for accept {
+								{
+									save := p.ParserData.Pos()
+									s := p.ParserData.Pos()
+									if p.ParserData.Read() != '"' {
+										p.ParserData.UnRead()
+										accept = false
+									} else {
+										accept = true
+									}
+									p.ParserData.Seek(s)
+									p.Root.Discard(s)
+									accept = !accept
+									if accept {
+										accept = p.Char()
+										if accept {
+										}
+									}
+									if !accept {
+										if p.LastError < p.ParserData.Pos() {
+											p.LastError = p.ParserData.Pos()
+										}
+										p.ParserData.Seek(save)
+									}
+								}
+							}
+							accept = true
+						}
+					}
+					if accept {
+						if p.ParserData.Read() != '"' {
+							p.ParserData.UnRead()
+							accept = false
+						} else {
+							accept = true
+						}
+						if accept {
+							accept = p.Spacing()
+							if accept {
+							}
+						}
+					}
+				}
+				if !accept {
+					if p.LastError < p.ParserData.Pos() {
+						p.LastError = p.ParserData.Pos()
+					}
+					p.ParserData.Seek(save)
+				}
+			}
+			if !accept {
+			}
+		}
+		if !accept {
+			p.ParserData.Seek(save)
+		}
+	}
+	end := p.ParserData.Pos()
+	if accept {
+		node := p.arena.Cleanup(&p.Root, start, end)
+		node.Name = "Literal"
+		node.P = p
+		node.Range = node.Range.Clip(p.IgnoreRange)
+		p.Root.Append(node)
+		if p.limiter != nil {
+			p.limiter.Node(end)
+		}
+	} else {
+		p.Root.Discard(start)
+	}
+	if p.IgnoreRange.A >= end || p.IgnoreRange.B <= start {
+		p.IgnoreRange = text.Region{}
+	}
+	if p.limiter != nil {
+		p.limiter.Exit()
+	}
+	return accept
+}
+
+func (p *Peg) Class() bool {
+	// Class         <- '[' (!']' Range)+ ']' Spacing
+	if p.limiter != nil {
+		p.limiter.Enter(p.ParserData.Pos())
+	}
+	accept := false
+	accept = true
+	start := p.ParserData.Pos()
+	{
+		save := p.ParserData.Pos()
+		if p.ParserData.Read() != '[' {
+			p.ParserData.UnRead()
+			accept = false
+		} else {
+			accept = true
+		}
+		if accept {
+			{
+				save := p.ParserData.Pos()
+				{
+					save := p.ParserData.Pos()
+					s := p.ParserData.Pos()
+					if p.ParserData.Read() != ']' {
+						p.ParserData.UnRead()
+						accept = false
+					} else {
+						accept = true
+					}
+					p.ParserData.Seek(s)
+					p.Root.Discard(s)
+					accept = !accept
+					if accept {
+						accept = p.Range()
+						if accept {
+						}
+					}
+					if !accept {
+						if p.LastError < p.ParserData.Pos() {
+							p.LastError = p.ParserData.Pos()
+						}
+						p.ParserData.Seek(save)
+					}
+				}
+				if !accept {
+					p.ParserData.Seek(save)
+				} else {
+					for accept {
+						{
+							save := p.ParserData.Pos()
+							s := p.ParserData.Pos()
+							if p.ParserData.Read() != ']' {
+								p.ParserData.UnRead()
+								accept = false
+							} else {
+								accept = true
+							}
+							p.ParserData.Seek(s)
+							p.Root.Discard(s)
+							accept = !accept
+							if accept {
+								accept = p.Range()
+								if accept {
+								}
+							}
+							if !accept {
+								if p.LastError < p.ParserData.Pos() {
+									p.LastError = p.ParserData.Pos()
+								}
+								p.ParserData.Seek(save)
+							}
+						}
+					}
+					accept = true
+				}
+			}
+			if accept {
+				if p.ParserData.Read() != ']' {
+					p.ParserData.UnRead()
+					accept = false
+				} else {
+					accept = true
+				}
+				if accept {
+					accept = p.Spacing()
+					if accept {
+					}
+				}
+			}
+		}
+		if !accept {
+			if p.LastError < p.ParserData.Pos() {
+				p.LastError = p.ParserData.Pos()
+			}
+			p.ParserData.Seek(save)
+		}
+	}
+	end := p.ParserData.Pos()
+	if accept {
+		node := p.arena.Cleanup(&p.Root, start, end)
+		node.Name = "Class"
+		node.P = p
+		node.Range = node.Range.Clip(p.IgnoreRange)
+		p.Root.Append(node)
+		if p.limiter != nil {
+			p.limiter.Node(end)
+		}
+	} else {
+		p.Root.Discard(start)
+	}
+	if p.IgnoreRange.A >= end || p.IgnoreRange.B <= start {
+		p.IgnoreRange = text.Region{}
+	}
+	if p.limiter != nil {
+		p.limiter.Exit()
+	}
+	return accept
+}
+
+func (p *Peg) Range() bool {
+	// Range         <- Char '-' Char / Char
+	if p.limiter != nil {
+		p.limiter.Enter(p.ParserData.Pos())
+	}
+	accept := false
+	accept = true
+	start := p.ParserData.Pos()
+	{
+		save := p.ParserData.Pos()
+		{
+			save := p.ParserData.Pos()
+			accept = p.Char()
+			if accept {
+				if p.ParserData.Read() != '-' {
+					p.ParserData.UnRead()
+					accept = false
+				} else {
+					accept = true
+				}
+				if accept {
+					accept = p.Char()
+					if accept {
+					}
+				}
+			}
+			if !accept {
+				if p.LastError < p.ParserData.Pos() {
+					p.LastError = p.ParserData.Pos()
+				}
+				p.ParserData.Seek(save)
+			}
+		}
+		if !accept {
+			accept = p.Char()
+			if !accept {
+			}
+		}
+		if !accept {
+			p.ParserData.Seek(save)
+		}
+	}
+	end := p.ParserData.Pos()
+	if accept {
+		node := p.arena.Cleanup(&p.Root, start, end)
+		node.Name = "Range"
+		node.P = p
+		node.Range = node.Range.Clip(p.IgnoreRange)
+		p.Root.Append(node)
+		if p.limiter != nil {
+			p.limiter.Node(end)
+		}
+	} else {
+		p.Root.Discard(start)
+	}
+	if p.IgnoreRange.A >= end || p.IgnoreRange.B <= start {
+		p.IgnoreRange = text.Region{}
+	}
+	if p.limiter != nil {
+		p.limiter.Exit()
+	}
+	return accept
+}
+
+func (p *Peg) Char() bool {
+	// Char          <- '\\' [nrt'"\[\]\\]
+	//                / '\\' [0-2][0-7][0-7]
+	//                / '\\' [0-7][0-7]?
+	//                / "\\u" Hex Hex Hex Hex
+	//                / "\\U" Hex Hex Hex Hex Hex Hex Hex Hex
+	//                / !'\\' .
+	if p.limiter != nil {
+		p.limiter.Enter(p.ParserData.Pos())
+	}
+	accept := false
+	accept = true
+	start := p.ParserData.Pos()
+	{
+		save := p.ParserData.Pos()
+		{
+			save := p.ParserData.Pos()
+			if p.ParserData.Read() != '\\' {
+				p.ParserData.UnRead()
+				accept = false
+			} else {
+				accept = true
+			}
+			if accept {
+				{
+					accept = false
+					c := p.ParserData.Read()
+					if c == 'n' || c == 'r' || c == 't' || c == '\'' || c == '"' || c == '[' || c == ']' || c == '\\' {
+						accept = true
+					} else {
+						p.ParserData.UnRead()
+					}
+				}
+				if accept {
+				}
+			}
+			if !accept {
+				if p.LastError < p.ParserData.Pos() {
+					p.LastError = p.ParserData.Pos()
+				}
+				p.ParserData.Seek(save)
+			}
+		}
+		if !accept {
+			{
+				save := p.ParserData.Pos()
+				if p.ParserData.Read() != '\\' {
+					p.ParserData.UnRead()
+					accept = false
+				} else {
+					accept = true
+				}
+				if accept {
+					c := p.ParserData.Read()
+					if c >= '0' && c <= '2' {
+						accept = true
+					} else {
+						p.ParserData.UnRead()
+						accept = false
+					}
+					if accept {
+						c := p.ParserData.Read()
+						if c >= '0' && c <= '7' {
+							accept = true
+						} else {
+							p.ParserData.UnRead()
+							accept = false
+						}
+						if accept {
+							c := p.ParserData.Read()
+							if c >= '0' && c <= '7' {
+								accept = true
+							} else {
+								p.ParserData.UnRead()
+								accept = false
+							}
+							if accept {
+							}
+						}
+					}
+				}
+				if !accept {
+					if p.LastError < p.ParserData.Pos() {
+						p.LastError = p.ParserData.Pos()
+					}
+					p.ParserData.Seek(save)
+				}
+			}
+			if !accept {
+				{
+					save := p.ParserData.Pos()
+					if p.ParserData.Read() != '\\' {
+						p.ParserData.UnRead()
+						accept = false
+					} else {
+						accept = true
+					}
+					if accept {
+						c := p.ParserData.Read()
+						if c >= '0' && c <= '7' {
+							accept = true
+						} else {
+							p.ParserData.UnRead()
+							accept = false
+						}
+						if accept {
+							c := p.ParserData.Read()
+							if c >= '0' && c <= '7' {
+								accept = true
+							} else {
+								p.ParserData.UnRead()
+								accept = false
+							}
+							accept = true
+							if accept {
+							}
+						}
+					}
+					if !accept {
+						if p.LastError < p.ParserData.Pos() {
+							p.LastError = p.ParserData.Pos()
+						}
+						p.ParserData.Seek(save)
+					}
+				}
+				if !accept {
+					{
+						save := p.ParserData.Pos()
+						{
+							accept = true
+							s := p.ParserData.Pos()
+							if p.ParserData.Read() != '\\' || p.ParserData.Read() != 'u' {
+								p.ParserData.Seek(s)
+								accept = false
+							}
+						}
+						if accept {
+							accept = p.Hex()
+							if accept {
+								accept = p.Hex()
+								if accept {
+									accept = p.Hex()
+									if accept {
+										accept = p.Hex()
+										if accept {
+										}
+									}
+								}
+							}
+						}
+						if !accept {
+							if p.LastError < p.ParserData.Pos() {
+								p.LastError = p.ParserData.Pos()
+							}
+							p.ParserData.Seek(save)
+						}
+					}
+					if !accept {
+						{
+							save := p.ParserData.Pos()
+							{
+								accept = true
+								s := p.ParserData.Pos()
+								if p.ParserData.Read() != '\\' || p.ParserData.Read() != 'U' {
+									p.ParserData.Seek(s)
+									accept = false
+								}
+							}
+							if accept {
+								accept = p.Hex()
+								if accept {
+									accept = p.Hex()
+									if accept {
+										accept = p.Hex()
+										if accept {
+											accept = p.Hex()
+											if accept {
+												accept = p.Hex()
+												if accept {
+													accept = p.Hex()
+													if accept {
+														accept = p.Hex()
+														if accept {
+															accept = p.Hex()
+															if accept {
+															}
+														}
+													}
+												}
+											}
+										}
+									}
+								}
+							}
+							if !accept {
+								if p.LastError < p.ParserData.Pos() {
+									p.LastError = p.ParserData.Pos()
+								}
+								p.ParserData.Seek(save)
+							}
+						}
+						if !accept {
+							{
+								save := p.ParserData.Pos()
+								s := p.ParserData.Pos()
+								if p.ParserData.Read() != '\\' {
+									p.ParserData.UnRead()
+									accept = false
+								} else {
+									accept = true
+								}
+								p.ParserData.Seek(s)
+								p.Root.Discard(s)
+								accept = !accept
+								if accept {
+									if p.ParserData.Pos() >= p.ParserData.Len() {
+										accept = false
+									} else {
+										p.ParserData.Read()
+										accept = true
+									}
+									if accept {
+									}
+								}
+								if !accept {
+									if p.LastError < p.ParserData.Pos() {
+										p.LastError = p.ParserData.Pos()
+									}
+									p.ParserData.Seek(save)
+								}
+							}
+							if !accept {
+							}
+						}
+					}
+				}
+			}
+		}
+		if !accept {
+			p.ParserData.Seek(save)
+		}
+	}
+	end := p.ParserData.Pos()
+	if accept {
+		node := p.arena.Cleanup(&p.Root, start, end)
+		node.Name = "Char"
+		node.P = p
+		node.Range = node.Range.Clip(p.IgnoreRange)
+		p.Root.Append(node)
+		if p.limiter != nil {
+			p.limiter.Node(end)
+		}
+	} else {
+		p.Root.Discard(start)
+	}
+	if p.IgnoreRange.A >= end || p.IgnoreRange.B <= start {
+		p.IgnoreRange = text.Region{}
+	}
+	if p.limiter != nil {
+		p.limiter.Exit()
+	}
+	return accept
+}
+
+func (p *Peg) Hex() bool {
+	// Hex           <- [A-Fa-f0-9]
+	if p.limiter != nil {
+		p.limiter.Enter(p.ParserData.Pos())
+	}
+	accept := false
+	accept = true
+	start := p.ParserData.Pos()
+	{
+		save := p.ParserData.Pos()
+		c := p.ParserData.Read()
+		if c >= 'A' && c <= 'F' {
+			accept = true
+		} else {
+			p.ParserData.UnRead()
+			accept = false
+		}
+		if !accept {
+			c := p.ParserData.Read()
+			if c >= 'a' && c <= 'f' {
+				accept = true
+			} else {
+				p.ParserData.UnRead()
+				accept = false
+			}
+			if !accept {
+				c := p.ParserData.Read()
+				if c >= '0' && c <= '9' {
+					accept = true
+				} else {
+					p.ParserData.UnRead()
+					accept = false
+				}
+				if !accept {
+				}
+			}
+		}
+		if !accept {
+			p.ParserData.Seek(save)
+		}
+	}
+	end := p.ParserData.Pos()
+	if accept {
+		node := p.arena.Cleanup(&p.Root, start, end)
+		node.Name = "Hex"
+		node.P = p
+		node.Range = node.Range.Clip(p.IgnoreRange)
+		p.Root.Append(node)
+		if p.limiter != nil {
+			p.limiter.Node(end)
+		}
+	} else {
+		p.Root.Discard(start)
+	}
+	if p.IgnoreRange.A >= end || p.IgnoreRange.B <= start {
+		p.IgnoreRange = text.Region{}
+	}
+	if p.limiter != nil {
+		p.limiter.Exit()
+	}
+	return accept
+}
+
+func (p *Peg) Code() bool {
+	// Code          <- (Braces / GoLiteral / !'}' .)*
+	if p.limiter != nil {
+		p.limiter.Enter(p.ParserData.Pos())
+	}
+	accept := false
+	accept = true
+	start := p.ParserData.Pos()
+	{
+		accept = true
+		for accept {
+			{
+				save := p.ParserData.Pos()
+				accept = p.Braces()
+				if !accept {
+					accept = p.GoLiteral()
+					if !accept {
+						{
+							save := p.ParserData.Pos()
+							s := p.ParserData.Pos()
+							if p.ParserData.Read() != '}' {
+								p.ParserData.UnRead()
+								accept = false
+							} else {
+								accept = true
+							}
+							p.ParserData.Seek(s)
+							p.Root.Discard(s)
+							accept = !accept
+							if accept {
+								if p.ParserData.Pos() >= p.ParserData.Len() {
+									accept = false
+								} else {
+									p.ParserData.Read()
+									accept = true
+								}
+								if accept {
+								}
+							}
+							if !accept {
+								if p.LastError < p.ParserData.Pos() {
+									p.LastError = p.ParserData.Pos()
+								}
+								p.ParserData.Seek(save)
+							}
+						}
+						if !accept {
+						}
+					}
+				}
+				if !accept {
+					p.ParserData.Seek(save)
+				}
+			}
+		}
+		accept = true
+	}
+	end := p.ParserData.Pos()
+	if accept {
+		node := p.arena.Cleanup(&p.Root, start, end)
+		node.Name = "Code"
+		node.P = p
+		node.Range = node.Range.Clip(p.IgnoreRange)
+		p.Root.Append(node)
+		if p.limiter != nil {
+			p.limiter.Node(end)
+		}
+	} else {
+		p.Root.Discard(start)
+	}
+	if p.IgnoreRange.A >= end || p.IgnoreRange.B <= start {
+		p.IgnoreRange = text.Region{}
+	}
+	if p.limiter != nil {
+		p.limiter.Exit()
+	}
+	return accept
+}
+
+func (p *Peg) Braces() bool {
+	// Braces        <- '{' (Braces / GoLiteral / !'}' .)* '}'
+	if p.limiter != nil {
+		p.limiter.Enter(p.ParserData.Pos())
+	}
+	accept := false
+	{
+		save := p.ParserData.Pos()
+		if p.ParserData.Read() != '{' {
+			p.ParserData.UnRead()
+			accept = false
+		} else {
+			accept = true
+		}
+		if accept {
+			{
+				accept = true
+				for accept {
+					{
+						save := p.ParserData.Pos()
+						accept = p.Braces()
+						if !accept {
+							accept = p.GoLiteral()
+							if !accept {
+								{
+									save := p.ParserData.Pos()
+									s := p.ParserData.Pos()
+									if p.ParserData.Read() != '}' {
+										p.ParserData.UnRead()
+										accept = false
+									} else {
+										accept = true
+									}
+									p.ParserData.Seek(s)
+									p.Root.Discard(s)
+									accept = !accept
+									if accept {
+										if p.ParserData.Pos() >= p.ParserData.Len() {
+											accept = false
+										} else {
+											p.ParserData.Read()
+											accept = true
+										}
+										if accept {
+										}
+									}
+									if !accept {
+										if p.LastError < p.ParserData.Pos() {
+											p.LastError = p.ParserData.Pos()
+										}
+										p.ParserData.Seek(save)
+									}
+								}
+								if !accept {
+								}
+							}
+						}
+						if !accept {
+							p.ParserData.Seek(save)
+						}
+					}
+				}
+				accept = true
+			}
+			if accept {
+				if p.ParserData.Read() != '}' {
+					p.ParserData.UnRead()
+					accept = false
+				} else {
+					accept = true
+				}
+				if accept {
+				}
+			}
+		}
+		if !accept {
+			if p.LastError < p.ParserData.Pos() {
+				p.LastError = p.ParserData.Pos()
+			}
+			p.ParserData.Seek(save)
+		}
+	}
+	if p.limiter != nil {
+		p.limiter.Exit()
+	}
+	return accept
+}
+
+func (p *Peg) GoLiteral() bool {
+	// GoLiteral     <- '"' ('\\' . / !'"' .)* '"'
+	//                / '\'' ('\\' . / !'\'' .)* '\''
+	//                / '`' (!'`' .)* '`'
+	if p.limiter != nil {
+		p.limiter.Enter(p.ParserData.Pos())
+	}
+	accept := false
+	{
+		save := p.ParserData.Pos()
+		{
+			save := p.ParserData.Pos()
+			if p.ParserData.Read() != '"' {
+				p.ParserData.UnRead()
+				accept = false
+			} else {
+				accept = true
+			}
+			if accept {
+				{
+					accept = true
+					for accept {
+						{
+							save := p.ParserData.Pos()
+							{
+								save := p.ParserData.Pos()
+								if p.ParserData.Read() != '\\' {
+									p.ParserData.UnRead()
+									accept = false
+								} else {
+									accept = true
+								}
+								if accept {
+									if p.ParserData.Pos() >= p.ParserData.Len() {
+										accept = false
+									} else {
+										p.ParserData.Read()
+										accept = true
+									}
+									if accept {
+									}
+								}
+								if !accept {
+									if p.LastError < p.ParserData.Pos() {
+										p.LastError = p.ParserData.Pos()
+									}
+									p.ParserData.Seek(save)
+								}
+							}
+							if !accept {
+								{
+									save := p.ParserData.Pos()
+									s := p.ParserData.Pos()
+									if p.ParserData.Read() != '"' {
+										p.ParserData.UnRead()
+										accept = false
+									} else {
+										accept = true
+									}
+									p.ParserData.Seek(s)
+									p.Root.Discard(s)
+									accept = !accept
+									if accept {
+										if p.ParserData.Pos() >= p.ParserData.Len() {
+											accept = false
+										} else {
+											p.ParserData.Read()
+											accept = true
+										}
+										if accept {
+										}
+									}
+									if !accept {
+										if p.LastError < p.ParserData.Pos() {
+											p.LastError = p.ParserData.Pos()
+										}
+										p.ParserData.Seek(save)
+									}
+								}
+								if !accept {
+								}
+							}
+							if !accept {
+								p.ParserData.Seek(save)
+							}
+						}
+					}
+					accept = true
+				}
+				if accept {
+					if p.ParserData.Read() != '"' {
+						p.ParserData.UnRead()
+						accept = false
+					} else {
+						accept = true
+					}
+					if accept {
+					}
+				}
+			}
+			if !accept {
+				if p.LastError < p.ParserData.Pos() {
+					p.LastError = p.ParserData.Pos()
+				}
+				p.ParserData.Seek(save)
+			}
+		}
+		if !accept {
+			{
+				save := p.ParserData.Pos()
+				if p.ParserData.Read() != '\'' {
+					p.ParserData.UnRead()
+					accept = false
+				} else {
+					accept = true
+				}
+				if accept {
+					{
+						accept = true
+						for accept {
+							{
+								save := p.ParserData.Pos()
+								{
+									save := p.ParserData.Pos()
+									if p.ParserData.Read() != '\\' {
+										p.ParserData.UnRead()
+										accept = false
+									} else {
+										accept = true
+									}
+									if accept {
+										if p.ParserData.Pos() >= p.ParserData.Len() {
+											accept = false
+										} else {
+											p.ParserData.Read()
+											accept = true
+										}
+										if accept {
+										}
+									}
+									if !accept {
+										if p.LastError < p.ParserData.Pos() {
+											p.LastError = p.ParserData.Pos()
+										}
+										p.ParserData.Seek(save)
+									}
 								}
-							}
-							if accept {
-								accept = p.Hex()
-								if accept {
-									accept = p.Hex()
-									if accept {
-										accept = p.Hex()
+								if !accept {
+									{
+										save := p.ParserData.Pos()
+										s := p.ParserData.Pos()
+										if p.ParserData.Read() != '\'' {
+											p.ParserData.UnRead()
+											accept = false
+										} else {
+											accept = true
+										}
+										p.ParserData.Seek(s)
+										p.Root.Discard(s)
+										accept = !accept
 										if accept {
-											accept = p.Hex()
+											if p.ParserData.Pos() >= p.ParserData.Len() {
+												accept = false
+											} else {
+												p.ParserData.Read()
+												accept = true
+											}
 											if accept {
-												accept = p.Hex()
-												if accept {
-													accept = p.Hex()
-													if accept {
-														accept = p.Hex()
-														if accept {
-															accept = p.Hex()
-															if accept {
-															}
-														}
-													}
-												}
 											}
 										}
+										if !accept {
+											if p.LastError < p.ParserData.Pos() {
+												p.LastError = p.ParserData.Pos()
+											}
+											p.ParserData.Seek(save)
+										}
+									}
+									if !accept {
 									}
 								}
-							}
-							if !accept {
-								if p.LastError < p.ParserData.Pos() {
-									p.LastError = p.ParserData.Pos()
+								if !accept {
+									p.ParserData.Seek(save)
 								}
-								p.ParserData.Seek(save)
 							}
 						}
-						if !accept {
-							{
-								save := p.ParserData.Pos()
-								s := p.ParserData.Pos()
-								if p.ParserData.Read() != '\\' {
-									p.ParserData.UnRead()
-									accept = false
-								} else {
-									accept = true
-								}
-								p.ParserData.Seek(s)
-								p.Root.Discard(s)
-								accept = !accept
-								if accept {
-									if p.ParserData.Pos() >= p.ParserData.Len() {
+						accept = true
+					}
+					if accept {
+						if p.ParserData.Read() != '\'' {
+							p.ParserData.UnRead()
+							accept = false
+						} else {
+							accept = true
+						}
+						if accept {
+						}
+					}
+				}
+				if !accept {
+					if p.LastError < p.ParserData.Pos() {
+						p.LastError = p.ParserData.Pos()
+					}
+					p.ParserData.Seek(save)
+				}
+			}
+			if !accept {
+				{
+					save := p.ParserData.Pos()
+					if p.ParserData.Read() != '`' {
+						p.ParserData.UnRead()
+						accept = false
+					} else {
+						accept = true
+					}
+					if accept {
+						{
+							accept = true
+							for accept {
+								{
+									save := p.ParserData.Pos()
+									s := p.ParserData.Pos()
+									if p.ParserData.Read() != '`' {
+										p.ParserData.UnRead()
 										accept = false
 									} else {
-										p.ParserData.Read()
 										accept = true
 									}
+									p.ParserData.Seek(s)
+									p.Root.Discard(s)
+									accept = !accept
 									if accept {
+										if p.ParserData.Pos() >= p.ParserData.Len() {
+											accept = false
+										} else {
+											p.ParserData.Read()
+											accept = true
+										}
+										if accept {
+										}
 									}
-								}
-								if !accept {
-									if p.LastError < p.ParserData.Pos() {
-										p.LastError = p.ParserData.Pos()
+									if !accept {
+										if p.LastError < p.ParserData.Pos() {
+											p.LastError = p.ParserData.Pos()
+										}
+										p.ParserData.Seek(save)
 									}
-									p.ParserData.Seek(save)
 								}
 							}
-							if !accept {
+							accept = true
+						}
+						if accept {
+							if p.ParserData.Read() != '`' {
+								p.ParserData.UnRead()
+								accept = false
+							} else {
+								accept = true
+							}
+							if accept {
 							}
 						}
 					}
-				}
-			}
-		}
-		if !accept {
-			p.ParserData.Seek(save)
-		}
-	}
-	end := p.ParserData.Pos()
-	if accept {
-		node := p.Root.Cleanup(start, end)
-		node.Name = "Char"
-		node.P = p
-		node.Range = node.Range.Clip(p.IgnoreRange)
-		p.Root.Append(node)
-	} else {
-		p.Root.Discard(start)
-	}
-	if p.IgnoreRange.A >= end || p.IgnoreRange.B <= start {
-		p.IgnoreRange = text.Region{}
-	}
-	return accept
-}
-
-func (p *Peg) Hex() bool {
-	// Hex           <- [A-Fa-f0-9]
-	accept := false
-	accept = true
-	start := p.ParserData.Pos()
-	{
-		save := p.ParserData.Pos()
-		c := p.ParserData.Read()
-		if c >= 'A' && c <= 'F' {
-			accept = true
-		} else {
-			p.ParserData.UnRead()
-			accept = false
-		}
-		if !accept {
-			c := p.ParserData.Read()
-			if c >= 'a' && c <= 'f' {
-				accept = true
-			} else {
-				p.ParserData.UnRead()
-				accept = false
-			}
-			if !accept {
-				c := p.ParserData.Read()
-				if c >= '0' && c <= '9' {
-					accept = true
-				} else {
-					p.ParserData.UnRead()
-					accept = false
+					if !accept {
+						if p.LastError < p.ParserData.Pos() {
+							p.LastError = p.ParserData.Pos()
+						}
+						p.ParserData.Seek(save)
+					}
 				}
 				if !accept {
 				}
@@ -1171,24 +2625,17 @@ func (p *Peg) Hex() bool {
 			p.ParserData.Seek(save)
 		}
 	}
-	end := p.ParserData.Pos()
-	if accept {
-		node := p.Root.Cleanup(start, end)
-		node.Name = "Hex"
-		node.P = p
-		node.Range = node.Range.Clip(p.IgnoreRange)
-		p.Root.Append(node)
-	} else {
-		p.Root.Discard(start)
-	}
-	if p.IgnoreRange.A >= end || p.IgnoreRange.B <= start {
-		p.IgnoreRange = text.Region{}
+	if p.limiter != nil {
+		p.limiter.Exit()
 	}
 	return accept
 }
 
 func (p *Peg) LEFTARROW() bool {
 	// LEFTARROW     <- "<-" Spacing
+	if p.limiter != nil {
+		p.limiter.Enter(p.ParserData.Pos())
+	}
 	accept := false
 	accept = true
 	start := p.ParserData.Pos()
@@ -1215,16 +2662,22 @@ func (p *Peg) LEFTARROW() bool {
 		}
 	}
 	if accept && start != p.ParserData.Pos() {
-		if start < p.IgnoreRange.A || p.IgnoreRange.A == 0 {
+		if start < p.IgnoreRange.A || p.IgnoreRange.A == 0 || start > p.IgnoreRange.B {
 			p.IgnoreRange.A = start
 		}
 		p.IgnoreRange.B = p.ParserData.Pos()
 	}
+	if p.limiter != nil {
+		p.limiter.Exit()
+	}
 	return accept
 }
 
 func (p *Peg) SLASH() bool {
 	// SLASH         <- '/' Spacing
+	if p.limiter != nil {
+		p.limiter.Enter(p.ParserData.Pos())
+	}
 	accept := false
 	accept = true
 	start := p.ParserData.Pos()
@@ -1249,16 +2702,22 @@ func (p *Peg) SLASH() bool {
 		}
 	}
 	if accept && start != p.ParserData.Pos() {
-		if start < p.IgnoreRange.A || p.IgnoreRange.A == 0 {
+		if start < p.IgnoreRange.A || p.IgnoreRange.A == 0 || start > p.IgnoreRange.B {
 			p.IgnoreRange.A = start
 		}
 		p.IgnoreRange.B = p.ParserData.Pos()
 	}
+	if p.limiter != nil {
+		p.limiter.Exit()
+	}
 	return accept
 }
 
 func (p *Peg) AND() bool {
 	// AND           <- '&' Spacing
+	if p.limiter != nil {
+		p.limiter.Enter(p.ParserData.Pos())
+	}
 	accept := false
 	accept = true
 	start := p.ParserData.Pos()
@@ -1284,22 +2743,31 @@ func (p *Peg) AND() bool {
 	}
 	end := p.ParserData.Pos()
 	if accept {
-		node := p.Root.Cleanup(start, end)
+		node := p.arena.Cleanup(&p.Root, start, end)
 		node.Name = "AND"
 		node.P = p
 		node.Range = node.Range.Clip(p.IgnoreRange)
 		p.Root.Append(node)
+		if p.limiter != nil {
+			p.limiter.Node(end)
+		}
 	} else {
 		p.Root.Discard(start)
 	}
 	if p.IgnoreRange.A >= end || p.IgnoreRange.B <= start {
 		p.IgnoreRange = text.Region{}
 	}
+	if p.limiter != nil {
+		p.limiter.Exit()
+	}
 	return accept
 }
 
 func (p *Peg) NOT() bool {
 	// NOT           <- '!' Spacing
+	if p.limiter != nil {
+		p.limiter.Enter(p.ParserData.Pos())
+	}
 	accept := false
 	accept = true
 	start := p.ParserData.Pos()
@@ -1325,22 +2793,81 @@ func (p *Peg) NOT() bool {
 	}
 	end := p.ParserData.Pos()
 	if accept {
-		node := p.Root.Cleanup(start, end)
+		node := p.arena.Cleanup(&p.Root, start, end)
 		node.Name = "NOT"
 		node.P = p
 		node.Range = node.Range.Clip(p.IgnoreRange)
 		p.Root.Append(node)
+		if p.limiter != nil {
+			p.limiter.Node(end)
+		}
+	} else {
+		p.Root.Discard(start)
+	}
+	if p.IgnoreRange.A >= end || p.IgnoreRange.B <= start {
+		p.IgnoreRange = text.Region{}
+	}
+	if p.limiter != nil {
+		p.limiter.Exit()
+	}
+	return accept
+}
+
+func (p *Peg) CUT() bool {
+	// CUT           <- '^' Spacing
+	if p.limiter != nil {
+		p.limiter.Enter(p.ParserData.Pos())
+	}
+	accept := false
+	accept = true
+	start := p.ParserData.Pos()
+	{
+		save := p.ParserData.Pos()
+		if p.ParserData.Read() != '^' {
+			p.ParserData.UnRead()
+			accept = false
+		} else {
+			accept = true
+		}
+		if accept {
+			accept = p.Spacing()
+			if accept {
+			}
+		}
+		if !accept {
+			if p.LastError < p.ParserData.Pos() {
+				p.LastError = p.ParserData.Pos()
+			}
+			p.ParserData.Seek(save)
+		}
+	}
+	end := p.ParserData.Pos()
+	if accept {
+		node := p.arena.Cleanup(&p.Root, start, end)
+		node.Name = "CUT"
+		node.P = p
+		node.Range = node.Range.Clip(p.IgnoreRange)
+		p.Root.Append(node)
+		if p.limiter != nil {
+			p.limiter.Node(end)
+		}
 	} else {
 		p.Root.Discard(start)
 	}
 	if p.IgnoreRange.A >= end || p.IgnoreRange.B <= start {
 		p.IgnoreRange = text.Region{}
 	}
+	if p.limiter != nil {
+		p.limiter.Exit()
+	}
 	return accept
 }
 
 func (p *Peg) QUESTION() bool {
 	// QUESTION      <- '?' Spacing
+	if p.limiter != nil {
+		p.limiter.Enter(p.ParserData.Pos())
+	}
 	accept := false
 	accept = true
 	start := p.ParserData.Pos()
@@ -1366,22 +2893,31 @@ func (p *Peg) QUESTION() bool {
 	}
 	end := p.ParserData.Pos()
 	if accept {
-		node := p.Root.Cleanup(start, end)
+		node := p.arena.Cleanup(&p.Root, start, end)
 		node.Name = "QUESTION"
 		node.P = p
 		node.Range = node.Range.Clip(p.IgnoreRange)
 		p.Root.Append(node)
+		if p.limiter != nil {
+			p.limiter.Node(end)
+		}
 	} else {
 		p.Root.Discard(start)
 	}
 	if p.IgnoreRange.A >= end || p.IgnoreRange.B <= start {
 		p.IgnoreRange = text.Region{}
 	}
+	if p.limiter != nil {
+		p.limiter.Exit()
+	}
 	return accept
 }
 
 func (p *Peg) STAR() bool {
 	// STAR          <- '*' Spacing
+	if p.limiter != nil {
+		p.limiter.Enter(p.ParserData.Pos())
+	}
 	accept := false
 	accept = true
 	start := p.ParserData.Pos()
@@ -1407,22 +2943,31 @@ func (p *Peg) STAR() bool {
 	}
 	end := p.ParserData.Pos()
 	if accept {
-		node := p.Root.Cleanup(start, end)
+		node := p.arena.Cleanup(&p.Root, start, end)
 		node.Name = "STAR"
 		node.P = p
 		node.Range = node.Range.Clip(p.IgnoreRange)
 		p.Root.Append(node)
+		if p.limiter != nil {
+			p.limiter.Node(end)
+		}
 	} else {
 		p.Root.Discard(start)
 	}
 	if p.IgnoreRange.A >= end || p.IgnoreRange.B <= start {
 		p.IgnoreRange = text.Region{}
 	}
+	if p.limiter != nil {
+		p.limiter.Exit()
+	}
 	return accept
 }
 
 func (p *Peg) PLUS() bool {
 	// PLUS          <- '+' Spacing
+	if p.limiter != nil {
+		p.limiter.Enter(p.ParserData.Pos())
+	}
 	accept := false
 	accept = true
 	start := p.ParserData.Pos()
@@ -1448,22 +2993,31 @@ func (p *Peg) PLUS() bool {
 	}
 	end := p.ParserData.Pos()
 	if accept {
-		node := p.Root.Cleanup(start, end)
+		node := p.arena.Cleanup(&p.Root, start, end)
 		node.Name = "PLUS"
 		node.P = p
 		node.Range = node.Range.Clip(p.IgnoreRange)
 		p.Root.Append(node)
+		if p.limiter != nil {
+			p.limiter.Node(end)
+		}
 	} else {
 		p.Root.Discard(start)
 	}
 	if p.IgnoreRange.A >= end || p.IgnoreRange.B <= start {
 		p.IgnoreRange = text.Region{}
 	}
+	if p.limiter != nil {
+		p.limiter.Exit()
+	}
 	return accept
 }
 
 func (p *Peg) OPEN() bool {
 	// OPEN          <- '(' Spacing
+	if p.limiter != nil {
+		p.limiter.Enter(p.ParserData.Pos())
+	}
 	accept := false
 	accept = true
 	start := p.ParserData.Pos()
@@ -1488,16 +3042,22 @@ func (p *Peg) OPEN() bool {
 		}
 	}
 	if accept && start != p.ParserData.Pos() {
-		if start < p.IgnoreRange.A || p.IgnoreRange.A == 0 {
+		if start < p.IgnoreRange.A || p.IgnoreRange.A == 0 || start > p.IgnoreRange.B {
 			p.IgnoreRange.A = start
 		}
 		p.IgnoreRange.B = p.ParserData.Pos()
 	}
+	if p.limiter != nil {
+		p.limiter.Exit()
+	}
 	return accept
 }
 
 func (p *Peg) CLOSE() bool {
 	// CLOSE         <- ')' Spacing
+	if p.limiter != nil {
+		p.limiter.Enter(p.ParserData.Pos())
+	}
 	accept := false
 	accept = true
 	start := p.ParserData.Pos()
@@ -1522,16 +3082,22 @@ func (p *Peg) CLOSE() bool {
 		}
 	}
 	if accept && start != p.ParserData.Pos() {
-		if start < p.IgnoreRange.A || p.IgnoreRange.A == 0 {
+		if start < p.IgnoreRange.A || p.IgnoreRange.A == 0 || start > p.IgnoreRange.B {
 			p.IgnoreRange.A = start
 		}
 		p.IgnoreRange.B = p.ParserData.Pos()
 	}
+	if p.limiter != nil {
+		p.limiter.Exit()
+	}
 	return accept
 }
 
 func (p *Peg) DOT() bool {
 	// DOT           <- '.' Spacing
+	if p.limiter != nil {
+		p.limiter.Enter(p.ParserData.Pos())
+	}
 	accept := false
 	accept = true
 	start := p.ParserData.Pos()
@@ -1557,22 +3123,31 @@ func (p *Peg) DOT() bool {
 	}
 	end := p.ParserData.Pos()
 	if accept {
-		node := p.Root.Cleanup(start, end)
+		node := p.arena.Cleanup(&p.Root, start, end)
 		node.Name = "DOT"
 		node.P = p
 		node.Range = node.Range.Clip(p.IgnoreRange)
 		p.Root.Append(node)
+		if p.limiter != nil {
+			p.limiter.Node(end)
+		}
 	} else {
 		p.Root.Discard(start)
 	}
 	if p.IgnoreRange.A >= end || p.IgnoreRange.B <= start {
 		p.IgnoreRange = text.Region{}
 	}
+	if p.limiter != nil {
+		p.limiter.Exit()
+	}
 	return accept
 }
 
 func (p *Peg) Spacing() bool {
 	// Spacing       <- (Space / Comment)*
+	if p.limiter != nil {
+		p.limiter.Enter(p.ParserData.Pos())
+	}
 	accept := false
 	accept = true
 	start := p.ParserData.Pos()
@@ -1595,16 +3170,22 @@ func (p *Peg) Spacing() bool {
 		accept = true
 	}
 	if accept && start != p.ParserData.Pos() {
-		if start < p.IgnoreRange.A || p.IgnoreRange.A == 0 {
+		if start < p.IgnoreRange.A || p.IgnoreRange.A == 0 || start > p.IgnoreRange.B {
 			p.IgnoreRange.A = start
 		}
 		p.IgnoreRange.B = p.ParserData.Pos()
 	}
+	if p.limiter != nil {
+		p.limiter.Exit()
+	}
 	return accept
 }
 
 func (p *Peg) Comment() bool {
 	// Comment       <- '#' (!EndOfLine .)* EndOfLine
+	if p.limiter != nil {
+		p.limiter.Enter(p.ParserData.Pos())
+	}
 	accept := false
 	accept = true
 	start := p.ParserData.Pos()
@@ -1661,16 +3242,22 @@ func (p *Peg) Comment() bool {
 		}
 	}
 	if accept && start != p.ParserData.Pos() {
-		if start < p.IgnoreRange.A || p.IgnoreRange.A == 0 {
+		if start < p.IgnoreRange.A || p.IgnoreRange.A == 0 || start > p.IgnoreRange.B {
 			p.IgnoreRange.A = start
 		}
 		p.IgnoreRange.B = p.ParserData.Pos()
 	}
+	if p.limiter != nil {
+		p.limiter.Exit()
+	}
 	return accept
 }
 
 func (p *Peg) Space() bool {
 	// Space         <- ' ' / '\t' / EndOfLine
+	if p.limiter != nil {
+		p.limiter.Enter(p.ParserData.Pos())
+	}
 	accept := false
 	accept = true
 	start := p.ParserData.Pos()
@@ -1700,16 +3287,22 @@ func (p *Peg) Space() bool {
 		}
 	}
 	if accept && start != p.ParserData.Pos() {
-		if start < p.IgnoreRange.A || p.IgnoreRange.A == 0 {
+		if start < p.IgnoreRange.A || p.IgnoreRange.A == 0 || start > p.IgnoreRange.B {
 			p.IgnoreRange.A = start
 		}
 		p.IgnoreRange.B = p.ParserData.Pos()
 	}
+	if p.limiter != nil {
+		p.limiter.Exit()
+	}
 	return accept
 }
 
 func (p *Peg) EndOfLine() bool {
 	// EndOfLine     <- "\r\n" / '\n' / '\r'
+	if p.limiter != nil {
+		p.limiter.Enter(p.ParserData.Pos())
+	}
 	accept := false
 	accept = true
 	start := p.ParserData.Pos()
@@ -1746,16 +3339,22 @@ func (p *Peg) EndOfLine() bool {
 		}
 	}
 	if accept && start != p.ParserData.Pos() {
-		if start < p.IgnoreRange.A || p.IgnoreRange.A == 0 {
+		if start < p.IgnoreRange.A || p.IgnoreRange.A == 0 || start > p.IgnoreRange.B {
 			p.IgnoreRange.A = start
 		}
 		p.IgnoreRange.B = p.ParserData.Pos()
 	}
+	if p.limiter != nil {
+		p.limiter.Exit()
+	}
 	return accept
 }
 
 func (p *Peg) EndOfFile() bool {
 	// EndOfFile     <- !.
+	if p.limiter != nil {
+		p.limiter.Enter(p.ParserData.Pos())
+	}
 	accept := false
 	accept = true
 	start := p.ParserData.Pos()
@@ -1771,16 +3370,22 @@ func (p *Peg) EndOfFile() bool {
 	accept = !accept
 	end := p.ParserData.Pos()
 	if accept {
-		node := p.Root.Cleanup(start, end)
+		node := p.arena.Cleanup(&p.Root, start, end)
 		node.Name = "EndOfFile"
 		node.P = p
 		node.Range = node.Range.Clip(p.IgnoreRange)
 		p.Root.Append(node)
+		if p.limiter != nil {
+			p.limiter.Node(end)
+		}
 	} else {
 		p.Root.Discard(start)
 	}
 	if p.IgnoreRange.A >= end || p.IgnoreRange.B <= start {
 		p.IgnoreRange = text.Region{}
 	}
+	if p.limiter != nil {
+		p.limiter.Exit()
+	}
 	return accept
 }
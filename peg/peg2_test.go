@@ -1,13 +1,24 @@
 package peg
 
 import (
-	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/limetext/text"
 	"github.com/quarnster/parser"
+	"github.com/quarnster/parser/fuzz"
+	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestPegs(t *testing.T) {
@@ -46,10 +57,8 @@ func TestPegs(t *testing.T) {
 					}
 					gen.SetCustomActions(customActions)
 					s := parser.GeneratorSettings{
-						Name:       strings.ToTitle(root),
-						Testname:   "../" + n + ".in",
-						Debug:      true,
-						DebugLevel: 0,
+						Name:     strings.ToTitle(root),
+						Testname: "testdata/*.in",
 						WriteFile: func(name, data string) error {
 							if err := os.Mkdir(root, 0755); err != nil && !os.IsExist(err) {
 								return err
@@ -62,27 +71,25 @@ func TestPegs(t *testing.T) {
 					}
 					if err := parser.GenerateParser(p.RootNode(), gen, s); err != nil {
 						t.Error(err)
+					} else if err := copyFile(n+".in", root+"/testdata/"+root+".in"); err != nil {
+						t.Error(err)
 					} else {
+						// Without the expected tree the generated test
+						// creates it, and it's copied back for next time
 						cmd := gen.TestCommand()
+						update := copyFile(n+".out", root+"/testdata/"+root+".out") != nil
+						if update {
+							t.Log("Unable to read expected output file, it'll be created")
+							cmd = append(cmd, "-update")
+						}
 						c := exec.Command(cmd[0], cmd[1:]...)
 						c.Dir = root
-						data, err := c.CombinedOutput()
-						if i := bytes.LastIndex(data, []byte("\nok ")); i > 0 {
-							data = data[:i+1]
-						}
-						if i := bytes.Index(data, []byte{'='}); i > 0 {
-							data = data[i:]
-						}
-						t.Log(string(data))
-						if err != nil {
-							t.Error(err)
-						} else if exp, err := ioutil.ReadFile(n + ".out"); err != nil {
-							t.Log("Unable to read expected output file, it'll be created")
-							if err := ioutil.WriteFile(n+".out", data, 0644); err != nil {
+						if data, err := c.CombinedOutput(); err != nil {
+							t.Error(err, string(data))
+						} else if update {
+							if err := copyFile(root+"/testdata/"+root+".out", n+".out"); err != nil {
 								t.Error(err)
 							}
-						} else if d, err := diff(exp, data); err != nil || len(d) != 0 {
-							t.Error(err, string(d))
 						}
 					}
 					os.RemoveAll(root)
@@ -91,3 +98,1224 @@ func TestPegs(t *testing.T) {
 		}
 	}
 }
+
+// copyFile copies the file "src" to "dst", creating the directory
+// "dst" is in if needed
+func copyFile(src, dst string) error {
+	data, err := ioutil.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(dst, data, 0644)
+}
+
+// runGenerated generates a Go parser with the settings "s" for the
+// grammar "grammar" in a directory of its own, writes "files" next to
+// it and runs its tests, passing go test the extra "flags"
+func runGenerated(t *testing.T, grammar string, s parser.GeneratorSettings, files map[string]string, flags ...string) string {
+	t.Helper()
+	return runGenerator(t, grammar, nil, s, files, flags...)
+}
+
+// runGenerator is like runGenerated, but generates the parser with the
+// custom actions "actions"
+func runGenerator(t *testing.T, grammar string, actions []parser.CustomAction, s parser.GeneratorSettings, files map[string]string, flags ...string) string {
+	t.Helper()
+	var p Peg
+	if !p.Parse(grammar) {
+		t.Fatal("Didn't parse correctly", p.Error())
+	}
+	dir, err := ioutil.TempDir(".", "generated")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s.WriteFile = func(name, data string) error {
+		return ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644)
+	}
+	gen := &parser.GoGenerator{RootNode: p.RootNode()}
+	gen.SetCustomActions(actions)
+	if err := parser.GenerateParser(p.RootNode(), gen, s); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range files {
+		fn := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(fn), 0755); err != nil {
+			t.Fatal(err)
+		} else if err := ioutil.WriteFile(fn, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cmd := append(gen.TestCommand(), flags...)
+	c := exec.Command(cmd[0], cmd[1:]...)
+	c.Dir = dir
+	out, err := c.CombinedOutput()
+	if err != nil {
+		t.Errorf("Testing the parser generated for %q failed: %s\n%s", grammar, err, out)
+	}
+	return string(out)
+}
+
+// treeTest returns a test for the generated parser "name" of package
+// "pkg", which expects it to parse each input in "trees" completely to
+// the tree the input maps to, or not to when that's empty
+func treeTest(pkg, name string, trees map[string]string) string {
+	var cases []string
+	for in, exp := range trees {
+		cases = append(cases, fmt.Sprintf("\t\t%q: %q,\n", in, exp))
+	}
+	sort.Strings(cases)
+	return `package ` + pkg + `
+
+import "testing"
+
+func TestTrees(t *testing.T) {
+	for in, exp := range map[string]string{
+` + strings.Join(cases, "") + `	} {
+		var p ` + name + `
+		if !p.Parse(in) || p.RootNode().Range.B != len(in) {
+			if exp != "" {
+				t.Errorf("%q didn't parse: %s\n%s", in, p.Error(), p.RootNode())
+			}
+		} else if exp == "" {
+			t.Errorf("Didn't expect %q to parse:\n%s", in, p.RootNode())
+		} else if tree := p.RootNode().String(); tree != exp {
+			t.Errorf("Expected %q to parse to\n%s\nnot\n%s", in, exp, tree)
+		}
+	}
+}
+`
+}
+
+// interpretTrees checks that interpreting "grammar" as "name" parses
+// each input in "trees" like treeTest expects the generated parser to
+func interpretTrees(t *testing.T, grammar, name string, trees map[string]string) {
+	t.Helper()
+	var p Peg
+	if !p.Parse(grammar) {
+		t.Fatal("Didn't parse correctly", p.Error())
+	}
+	in, err := parser.NewInterpreter(p.RootNode(), name, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for input, exp := range trees {
+		if !in.Parse(input) || in.RootNode().Range.B != len(input) {
+			if exp != "" {
+				t.Errorf("Interpreter didn't parse %q: %s", input, in.Error())
+			}
+		} else if exp == "" {
+			t.Errorf("Didn't expect the interpreter to parse %q:\n%s", input, in.RootNode())
+		} else if tree := in.RootNode().String(); tree != exp {
+			t.Errorf("Expected the interpreter to parse %q to\n%s\nnot\n%s", input, exp, tree)
+		}
+	}
+}
+
+// runC checks that the C parser generated for "grammar" parses each
+// input in "trees" like treeTest expects the Go parser to, an empty
+// tree meaning it shouldn't parse at all. It's skipped without a C
+// compiler.
+func runC(t *testing.T, grammar, name string, trees map[string]string) {
+	t.Helper()
+	cc, err := exec.LookPath("cc")
+	if err != nil {
+		t.Skip("No C compiler to run the C parser with")
+	}
+	var p Peg
+	if !p.Parse(grammar) {
+		t.Fatal("Didn't parse correctly", p.Error())
+	}
+	dir, err := ioutil.TempDir("", "generated")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s := parser.GeneratorSettings{
+		Name:     name,
+		Debug:    true,
+		Testname: "input",
+		WriteFile: func(name, data string) error {
+			return ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644)
+		},
+	}
+	if err := parser.GenerateParser(p.RootNode(), &parser.CGenerator{}, s); err != nil {
+		t.Fatal(err)
+	}
+	c := exec.Command(cc, "-o", "parser", strings.ToLower(name)+".c")
+	c.Dir = dir
+	if out, err := c.CombinedOutput(); err != nil {
+		t.Fatalf("Compiling the C parser generated for %q failed: %s\n%s", grammar, err, out)
+	}
+	for input, exp := range trees {
+		if err := ioutil.WriteFile(filepath.Join(dir, "input"), []byte(input), 0644); err != nil {
+			t.Fatal(err)
+		}
+		c := exec.Command(filepath.Join(dir, "parser"))
+		c.Dir = dir
+		out, err := c.Output()
+		if exp == "" {
+			if err == nil {
+				t.Errorf("Didn't expect the C parser to parse %q:\n%s", input, out)
+			}
+		} else if err != nil {
+			t.Errorf("The C parser didn't parse %q: %s\n%s", input, err, out)
+		} else if string(out) != exp {
+			t.Errorf("Expected the C parser to parse %q to\n%s\nnot\n%s", input, exp, out)
+		}
+	}
+}
+
+func TestPredicates(t *testing.T) {
+	grammar := "Word <- !{ p.State.Reserved == p.Data(p.ParserData.Pos(), p.ParserData.Len()) } [a-z]+ &{ p.State.Close == \"}\" && '}' != '{' }\n"
+	var p Peg
+	if !p.Parse(grammar) {
+		t.Fatal("Didn't parse correctly", p.Error())
+	}
+	var codes []string
+	var visit func(n *parser.Node)
+	visit = func(n *parser.Node) {
+		if n.Name == "Predicate" {
+			codes = append(codes, n.Children[0].Name+" "+n.Children[1].Data())
+		}
+		for _, c := range n.Children {
+			visit(c)
+		}
+	}
+	visit(p.RootNode())
+	if exp := []string{"NOT  p.State.Reserved == p.Data(p.ParserData.Pos(), p.ParserData.Len()) ", "AND  p.State.Close == \"}\" && '}' != '{' "}; strings.Join(codes, "\n") != strings.Join(exp, "\n") {
+		t.Fatalf("Unexpected predicates: %q", codes)
+	}
+
+	runGenerated(t, grammar, parser.GeneratorSettings{Name: "Word", State: "*WordState"}, map[string]string{"word_state_test.go": `package word
+
+import "testing"
+
+type WordState struct {
+	Reserved, Close string
+}
+
+func TestState(t *testing.T) {
+	for _, test := range []struct {
+		state WordState
+		in    string
+		ok    bool
+	}{
+		{WordState{"if", "}"}, "abc", true},
+		{WordState{"if", "}"}, "if", false},
+		{WordState{"if", "x"}, "abc", false},
+	} {
+		p := Word{State: &test.state}
+		if ok := p.Parse(test.in); ok != test.ok {
+			t.Errorf("Expected %q to parse %v with %+v, not %v", test.in, test.ok, test.state, ok)
+		}
+	}
+}
+`})
+
+	s := parser.GeneratorSettings{
+		Name:      "Word",
+		State:     "*WordState",
+		WriteFile: func(name, data string) error { return nil },
+	}
+	if err := parser.GenerateParser(p.RootNode(), &parser.CGenerator{}, s); err == nil {
+		t.Error("Expected the C generator to reject semantic predicates")
+	} else if _, ok := err.(*parser.UnsupportedError); !ok {
+		t.Errorf("Expected an UnsupportedError, not %v", err)
+	}
+}
+
+func TestBackReferences(t *testing.T) {
+	s := parser.GeneratorSettings{
+		Name:      "Ref",
+		WriteFile: func(name, data string) error { return nil },
+	}
+	for k, v := range map[string]bool{
+		"Quoted <- q:['\"] (!=q .)* =q\n": true,
+		"Quoted <- =q q:['\"]\n":          false,
+		"Quoted <- q:'a'\nOther <- =q\n":  false,
+	} {
+		var p Peg
+		if !p.Parse(k) {
+			t.Fatal("Didn't parse correctly", p.Error())
+		}
+		if err := parser.GenerateParser(p.RootNode(), &parser.GoGenerator{}, s); (err == nil) != v {
+			t.Errorf("Unexpected result for %q: %v", k, err)
+		}
+	}
+
+	// What a failed alternative captured is forgotten, and a
+	// back-reference to a capture that hasn't matched fails, unlike
+	// one to a capture that matched the empty string
+	grammar := "A <- (n:[xy] 'a' / [xy]) =n (m:'z'? / 'w') =m\n"
+	trees := map[string]string{
+		"xax":   "0-3: \"Ref\"\n\t0-3: \"A\" - Data: \"xax\"\n",
+		"xaxzz": "0-5: \"Ref\"\n\t0-5: \"A\" - Data: \"xaxzz\"\n",
+		"x":     "",
+		"xx":    "",
+		"xay":   "",
+		"xaxw":  "",
+	}
+	runGenerated(t, grammar, parser.GeneratorSettings{Name: "Ref"}, map[string]string{"trees_test.go": treeTest("ref", "Ref", trees)})
+	interpretTrees(t, grammar, "Ref", trees)
+}
+
+func TestCuts(t *testing.T) {
+	// A cut fails the innermost choice, repetition or predicate, or the
+	// definition when there's none, so Rule failing after its cut still
+	// lets S try its next alternative
+	grammar := `S    <- 'a' (Rule / 'x' 'y')
+      / 'b' ('x' ^ 'z' / 'x' 'y')
+      / 'c' !('x' ^ 'z') .
+      / 'd' ('x' ^ 'y')* 'x'
+      / 'e' ('x' ^ 'y')? 'x'
+Rule <- 'x' ^ 'z'
+`
+	trees := map[string]string{
+		"axy":  "0-3: \"Cut\"\n\t0-3: \"S\" - Data: \"axy\"\n",
+		"axz":  "0-3: \"Cut\"\n\t0-3: \"S\"\n\t\t1-3: \"Rule\" - Data: \"xz\"\n",
+		"bxy":  "",
+		"bxz":  "0-3: \"Cut\"\n\t0-3: \"S\" - Data: \"bxz\"\n",
+		"cx":   "0-2: \"Cut\"\n\t0-2: \"S\" - Data: \"cx\"\n",
+		"cxz":  "",
+		"dxyx": "",
+		"dxy":  "",
+		"ex":   "",
+		"exyx": "0-4: \"Cut\"\n\t0-4: \"S\" - Data: \"exyx\"\n",
+	}
+	runGenerated(t, grammar, parser.GeneratorSettings{Name: "Cut"}, map[string]string{"trees_test.go": treeTest("cut", "Cut", trees)})
+	interpretTrees(t, grammar, "Cut", trees)
+
+	// The cuts after the commas, in the choice of Item once those did
+	// and in the option leave nothing to go back to, unlike the one in
+	// the predicate, which always goes back
+	commits := `package list
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/quarnster/parser"
+)
+
+type committed struct {
+	Reader
+	offsets []int
+}
+
+func (c *committed) Commit(offset int) {
+	c.offsets = append(c.offsets, offset)
+}
+
+func TestCommits(t *testing.T) {
+	var p List
+	p.SetData("a,(b),cyzw")
+	c := &committed{Reader: p.ParserData}
+	p.ParserData = c
+	if !p.realParse() {
+		t.Fatalf("Didn't parse correctly: %s", p.Error())
+	}
+	if exp := "[2 3 6 8]"; fmt.Sprint(c.offsets) != exp {
+		t.Errorf("Expected commits at %s, not %v", exp, c.offsets)
+	}
+}
+`
+	runGenerated(t, "List <- Item (',' ^ Item)* ('y' ^ 'z')? &('w' ^ !.) 'w'\nItem <- '(' ^ [a-z] ')' / [a-z]\n", parser.GeneratorSettings{Name: "List"}, map[string]string{"commits_test.go": commits})
+
+	var p Peg
+	if !p.Parse(grammar) {
+		t.Fatal("Didn't parse correctly", p.Error())
+	}
+	s := parser.GeneratorSettings{Name: "Cut", WriteFile: func(name, data string) error { return nil }}
+	for _, gen := range []parser.Generator{&parser.JavaGenerator{}, &parser.PyGenerator{}, &parser.CPPGenerator{}} {
+		if err := parser.GenerateParser(p.RootNode(), gen, s); err != nil {
+			t.Errorf("%T: %s", gen, err)
+		}
+	}
+	runC(t, grammar, "Cut", trees)
+}
+
+func TestPrecedence(t *testing.T) {
+	grammar := "Sum <- %prec Number { left \"+\" \"-\"; right \"^\" }\nNumber <- [0-9]+\n"
+	trees := map[string]string{
+		"1": `0-1: "Sum"
+	0-1: "Number" - Data: "1"
+`,
+		"1+2-3": `0-5: "Sum"
+	0-5: "Sum"
+		0-3: "Sum"
+			0-1: "Number" - Data: "1"
+			1-2: "Operator" - Data: "+"
+			2-3: "Number" - Data: "2"
+		3-4: "Operator" - Data: "-"
+		4-5: "Number" - Data: "3"
+`,
+		"1+2^3^4": `0-7: "Sum"
+	0-7: "Sum"
+		0-1: "Number" - Data: "1"
+		1-2: "Operator" - Data: "+"
+		2-7: "Sum"
+			2-3: "Number" - Data: "2"
+			3-4: "Operator" - Data: "^"
+			4-7: "Sum"
+				4-5: "Number" - Data: "3"
+				5-6: "Operator" - Data: "^"
+				6-7: "Number" - Data: "4"
+`,
+		"2^3+4": `0-5: "Sum"
+	0-5: "Sum"
+		0-3: "Sum"
+			0-1: "Number" - Data: "2"
+			1-2: "Operator" - Data: "^"
+			2-3: "Number" - Data: "3"
+		3-4: "Operator" - Data: "+"
+		4-5: "Number" - Data: "4"
+`,
+		"1+": "",
+		"+1": "",
+	}
+	runGenerated(t, grammar, parser.GeneratorSettings{Name: "Sum"}, map[string]string{"trees_test.go": treeTest("sum", "Sum", trees)})
+	interpretTrees(t, grammar, "Sum", trees)
+
+	var p Peg
+	if !p.Parse(grammar) {
+		t.Fatal("Didn't parse correctly", p.Error())
+	}
+	s := parser.GeneratorSettings{Name: "Sum", WriteFile: func(name, data string) error { return nil }}
+	if err := parser.GenerateParser(p.RootNode(), &parser.CGenerator{}, s); err == nil {
+		t.Error("Expected the C generator to reject operator precedence")
+	}
+}
+
+func TestIgnoreRange(t *testing.T) {
+	// The Spacing after 'a' and the one ending Word aren't adjacent, so
+	// Word is clipped to the latter only rather than being covered by
+	// one range spanning both
+	grammar := "S <- 'a' Spacing Word 'c'\nWord <- [a-z]+ Spacing\nSpacing <- ' '*\n"
+	trees := map[string]string{
+		"a b c": `0-5: "Ign"
+	0-5: "S"
+		2-3: "Word" - Data: "b"
+`,
+	}
+	ignore := func(g parser.Generator, in string) string {
+		return g.Ignore(in)
+	}
+	runGenerator(t, grammar, []parser.CustomAction{{Name: "Spacing", Action: ignore}}, parser.GeneratorSettings{Name: "Ign"}, map[string]string{"trees_test.go": treeTest("ign", "Ign", trees)})
+
+	var p Peg
+	if !p.Parse(grammar) {
+		t.Fatal("Didn't parse correctly", p.Error())
+	}
+	in, err := parser.NewInterpreter(p.RootNode(), "Ign", []string{"Spacing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for input, exp := range trees {
+		if !in.Parse(input) {
+			t.Errorf("Interpreter didn't parse %q: %s", input, in.Error())
+		} else if tree := in.RootNode().String(); tree != exp {
+			t.Errorf("Expected the interpreter to parse %q to\n%s\nnot\n%s", input, exp, tree)
+		}
+	}
+}
+
+func TestLexical(t *testing.T) {
+	// Spaces are trivia between the tokens, and "1" isn't a token
+	grammar := "List <- '(' Word* ')'\n%lexical {\n\tWord <- [a-z]+\n\tParen <- [()]\n\t%trivia Space <- ' '+\n}\n"
+	trees := map[string]string{
+		"()": `0-2: "List"
+	0-2: "List" - Data: "()"
+`,
+		"(ab c)": `0-6: "List"
+	0-6: "List"
+		1-3: "Word" - Data: "ab"
+		4-5: "Word" - Data: "c"
+`,
+		" (ab )": `0-6: "List"
+	1-6: "List"
+		2-4: "Word" - Data: "ab"
+`,
+		"(a(b)": "",
+		"(ab":   "",
+		"(1)":   "",
+	}
+	runGenerated(t, grammar, parser.GeneratorSettings{Name: "List"}, map[string]string{"trees_test.go": treeTest("list", "List", trees)})
+	interpretTrees(t, grammar, "List", trees)
+
+	var p Peg
+	if !p.Parse(grammar) {
+		t.Fatal("Didn't parse correctly", p.Error())
+	}
+	s := parser.GeneratorSettings{Name: "List", WriteFile: func(name, data string) error { return nil }}
+	if err := parser.GenerateParser(p.RootNode(), &parser.JavaGenerator{}, s); err == nil {
+		t.Error("Expected the Java generator to reject lexical sections")
+	}
+
+	// Character classes only make sense where the input is characters
+	if !p.Parse("A <- B [a-z]\n%lexical {\n\tB <- 'b'\n}\n") {
+		t.Fatal("Didn't parse correctly", p.Error())
+	}
+	exp := "A: character class [a-z] outside the lexical section"
+	if err := parser.GenerateParser(p.RootNode(), &parser.GoGenerator{}, s); err == nil || err.Error() != exp {
+		t.Errorf("Expected the error %q, not %v", exp, err)
+	}
+	if _, err := parser.NewInterpreter(p.RootNode(), "List", nil); err == nil || err.Error() != exp {
+		t.Errorf("Expected the interpreter to fail with %q, not %v", exp, err)
+	}
+}
+
+func TestHeader(t *testing.T) {
+	for k, v := range map[string]string{
+		"@start Other\nItem <- [a-z]\n": `unknown start definition "Other"`,
+		"@starts Item\nItem <- [a-z]\n": "unknown header @starts",
+	} {
+		var p Peg
+		if !p.Parse(k) {
+			t.Fatal("Didn't parse correctly", p.Error())
+		}
+		s := parser.GeneratorSettings{Name: "Default", WriteFile: func(name, data string) error { return nil }}
+		if err := parser.GenerateParser(p.RootNode(), &parser.GoGenerator{}, s); err == nil || err.Error() != v {
+			t.Errorf("Expected error %q for %q, not %v", v, k, err)
+		}
+	}
+
+	// The headers override the settings, making the parser List of the
+	// package list, which starts at Item unless asked for another rule
+	grammar := "@start Item\n@package list\n@type List\nPair <- Item Item\nItem <- [a-z]\n"
+	trees := map[string]string{
+		"a": `0-1: "List"
+	0-1: "Item" - Data: "a"
+`,
+		"ab": "",
+	}
+	rules := `package list
+
+import "testing"
+
+func TestRule(t *testing.T) {
+	var p List
+	if !p.ParseRule("Pair", "ab") {
+		t.Fatalf("Didn't parse correctly: %s", p.Error())
+	}
+	if exp, tree := "0-2: \"List\"\n\t0-2: \"Pair\"\n\t\t0-1: \"Item\" - Data: \"a\"\n\t\t1-2: \"Item\" - Data: \"b\"\n", p.RootNode().String(); tree != exp {
+		t.Errorf("Expected\n%s\nnot\n%s", exp, tree)
+	}
+	if p.ParseRule("Other", "a") {
+		t.Error("Parsed with an unknown rule")
+	}
+}
+`
+	s := parser.GeneratorSettings{Name: "Default"}
+	runGenerated(t, grammar, s, map[string]string{"trees_test.go": treeTest("list", "List", trees), "rule_test.go": rules})
+
+	var p Peg
+	if !p.Parse(grammar) {
+		t.Fatal("Didn't parse correctly", p.Error())
+	}
+	var files []string
+	s.WriteFile = func(name, data string) error {
+		files = append(files, name)
+		return nil
+	}
+	if err := parser.GenerateParser(p.RootNode(), &parser.GoGenerator{}, s); err != nil {
+		t.Fatal(err)
+	} else if len(files) != 1 || files[0] != "list.go" {
+		t.Errorf("Unexpected files written: %v", files)
+	}
+}
+
+func TestRailroad(t *testing.T) {
+	var p Peg
+	if !p.Parse("List <- '(' ^ Item (',' Item)* ')' / !'(' Item+ Item?\nItem <- [a-z] / .\n") {
+		t.Fatal("Didn't parse correctly", p.Error())
+	}
+	files := make(map[string]string)
+	s := parser.GeneratorSettings{
+		Name: "List",
+		WriteFile: func(name, data string) error {
+			files[name] = data
+			return nil
+		},
+	}
+	if err := parser.GenerateRailroad(p.RootNode(), s); err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 3 {
+		t.Errorf("Expected List.svg, Item.svg and index.html, got %d files", len(files))
+	}
+	for _, name := range []string{"List.svg", "Item.svg"} {
+		d := xml.NewDecoder(strings.NewReader(files[name]))
+		for {
+			if _, err := d.Token(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Errorf("%s isn't well formed: %s\n%s", name, err, files[name])
+				break
+			}
+		}
+	}
+	for _, exp := range []string{
+		`<a href="Item.svg"><text`,
+		`<text x="`,
+		`>^</text>`,
+		`>not followed by</text>`,
+		`>&#39;(&#39;</text>`,
+	} {
+		if !strings.Contains(files["List.svg"], exp) {
+			t.Errorf("Expected %q in List.svg:\n%s", exp, files["List.svg"])
+		}
+	}
+	for _, exp := range []string{`<h2 id="Item">Item</h2>`, `<a href="#Item">`} {
+		if !strings.Contains(files["index.html"], exp) {
+			t.Errorf("Expected %q in index.html", exp)
+		}
+	}
+}
+
+func TestCoverage(t *testing.T) {
+	grammar := "List <- Item (',' Item)*\nItem <- [a-z] / [0-9]\n"
+	// Only the digits are never matched
+	counts := `package list
+
+import "testing"
+
+func TestCounts(t *testing.T) {
+	Coverage.Reset()
+	var p List
+	if !p.Parse("a,b,c") {
+		t.Fatalf("Didn't parse correctly: %s", p.Error())
+	}
+	if exp := "6 of 7 grammar points hit\n1:9  1     List Item\n1:14 1     List (',' Item)*\n1:14 2     List (',' Item)\n1:15 2     List ','\n1:19 2     List Item\n2:9  3     Item [a-z]\n2:17 never Item [0-9]\n"; Coverage.String() != exp {
+		t.Errorf("Expected:\n%s\nReceived:\n%s", exp, Coverage.String())
+	}
+}
+`
+	runGenerated(t, grammar, parser.GeneratorSettings{Name: "List", Coverage: true}, map[string]string{"counts_test.go": counts})
+	// Profiling the test inputs and covering the grammar both need os
+	s := parser.GeneratorSettings{Name: "List", Coverage: true, Profile: true, Testname: "testdata/*.in"}
+	if out := runGenerated(t, grammar, s, map[string]string{
+		"testdata/list.in":  "a,1",
+		"testdata/list.out": "0-3: \"List\"\n\t0-3: \"List\"\n\t\t0-1: \"Item\" - Data: \"a\"\n\t\t2-3: \"Item\" - Data: \"1\"\n",
+	}); !strings.Contains(out, "--- PASS: TestParser") {
+		t.Errorf("Expected the parser generated to both profile and cover the grammar to pass its tests:\n%s", out)
+	}
+
+	c := parser.CoverageProfile{Grammar: grammar, Points: []parser.CoveragePoint{
+		{Definition: "Item", Range: text.Region{A: 33, B: 38}, Line: 2, Column: 9},
+		{Definition: "Item", Range: text.Region{A: 41, B: 46}, Line: 2, Column: 17},
+	}}
+	c.Hit(0)
+	c.Hit(0)
+	if exp := "1 of 2 grammar points hit\n2:9  2     Item [a-z]\n2:17 never Item [0-9]\n"; c.String() != exp {
+		t.Errorf("Expected:\n%s\nReceived:\n%s", exp, c.String())
+	}
+	if exp := `<span class="missed" title="Item 2:17, 0 matches">[0-9]</span>`; !strings.Contains(c.HTML(), exp) {
+		t.Errorf("Expected %q in:\n%s", exp, c.HTML())
+	}
+	c.Reset()
+	if len(c.Missed()) != 2 {
+		t.Error("Expected all points to be missed after a reset")
+	}
+}
+
+// dropNodes removes the nodes named in "names" from the tree "n"
+func dropNodes(n *parser.Node, names ...string) {
+	var children []*parser.Node
+	for _, child := range n.Children {
+		drop := false
+		for _, name := range names {
+			drop = drop || child.Name == name
+		}
+		if !drop {
+			dropNodes(child, names...)
+			children = append(children, child)
+		}
+	}
+	n.Children = children
+}
+
+func TestInterpreter(t *testing.T) {
+	data, err := ioutil.ReadFile("peg.peg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p Peg
+	if !p.Parse(string(data)) {
+		t.Fatal("Didn't parse correctly", p.Error())
+	}
+	// The generated peg parser just calls IdentStart, IdentCont, Braces
+	// and GoLiteral, which the interpreter has no equivalent for
+	in, err := parser.NewInterpreter(p.RootNode(), "Peg", []string{"Spacing", "Space", "EndOfLine", "SLASH", "LEFTARROW", "OPEN", "CLOSE", "Comment", "Grammar"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !in.Parse(string(data)) {
+		t.Fatal("Interpreter didn't parse correctly", in.Error())
+	}
+	dropNodes(in.RootNode(), "IdentStart", "IdentCont", "Braces", "GoLiteral")
+	if a, b := in.RootNode().String(), p.RootNode().String(); a != b {
+		d, _ := diff([]byte(b), []byte(a))
+		t.Errorf("Interpreted tree differs from the generated parser's:\n%s", d)
+	}
+
+	tests := []struct {
+		peg, ignore, in, out string
+	}{
+		{"../json/json.peg", "Spacing,Values,Value,QuotedText,KeyValuePairs,JsonFile", "[1E+2]\n", `0-7: "JSON"
+	0-6: "Array"
+		1-5: "Float" - Data: "1E+2"
+	7-7: "EndOfFile" - Data: ""
+`},
+		{"../expression/expression.peg", "Expression,Grouping", "A | B & C << 1 | D", `0-18: "EXPRESSION"
+	0-18: "Op"
+		0-14: "Op"
+			0-1: "Identifier" - Data: "A"
+			2-3: "Operator" - Data: "|"
+			4-14: "Op"
+				4-5: "Identifier" - Data: "B"
+				6-7: "Operator" - Data: "&"
+				8-14: "Op"
+					8-9: "Identifier" - Data: "C"
+					10-12: "Operator" - Data: "<<"
+					13-14: "Constant" - Data: "1"
+		15-16: "Operator" - Data: "|"
+		17-18: "Identifier" - Data: "D"
+	18-18: "EndOfFile" - Data: ""
+`},
+	}
+	for _, test := range tests {
+		data, err := ioutil.ReadFile(test.peg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !p.Parse(string(data)) {
+			t.Fatal("Didn't parse correctly", p.Error())
+		}
+		name := strings.ToUpper(strings.TrimSuffix(test.peg[strings.LastIndex(test.peg, "/")+1:], ".peg"))
+		in, err := parser.NewInterpreter(p.RootNode(), name, strings.Split(test.ignore, ","))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !in.Parse(test.in) {
+			t.Errorf("%s didn't parse %q: %s", test.peg, test.in, in.Error())
+		} else if out := in.RootNode().String(); out != test.out {
+			t.Errorf("%s output differs\n%s\n%s", test.peg, out, test.out)
+		}
+	}
+
+	if !p.Parse("A <- B\n") {
+		t.Fatal("Didn't parse correctly", p.Error())
+	}
+	if _, err := parser.NewInterpreter(p.RootNode(), "A", nil); err == nil {
+		t.Error("Expected an error for the reference to an unknown definition")
+	}
+
+	// The generated parsers would loop forever
+	if !p.Parse("A <- 'a' ('b'?)*\n") {
+		t.Fatal("Didn't parse correctly", p.Error())
+	}
+	exp := "1:10: error: ('b'?) can match nothing, so repeating it never ends"
+	if _, err := parser.NewInterpreter(p.RootNode(), "A", nil); err == nil || err.Error() != exp {
+		t.Errorf("Expected the error %q, not %v", exp, err)
+	}
+}
+
+func TestShapes(t *testing.T) {
+	prec := "Stmt <- Sum ';' Number\nSum <- %prec Number { left \"+\" }\nNumber <- [0-9]+\n"
+	tests := []struct {
+		grammar string
+		shapes  map[string]parser.Shape
+		in, exp string
+	}{
+		{
+			"List <- '(' Items ')'\nItems <- (Item (Comma Item)*)?\nItem <- Number Unit? / List\nNumber <- [0-9]+\nUnit <- [a-z]+\nComma <- ','\n",
+			map[string]parser.Shape{
+				"Items":  {Lift: true},
+				"Item":   {Collapse: true},
+				"Comma":  {Drop: true},
+				"Number": {Rename: "Num"},
+			},
+			"(1,(2kg,3))",
+			`0-11: "P"
+	0-11: "List"
+		1-2: "Num" - Data: "1"
+		3-10: "List"
+			4-7: "Item"
+				4-5: "Num" - Data: "2"
+				5-7: "Unit" - Data: "kg"
+			8-9: "Num" - Data: "3"
+`,
+		},
+		{
+			prec,
+			map[string]parser.Shape{"Sum": {Rename: "Add"}, "Number": {Rename: "Num"}},
+			"1+2+3;4",
+			`0-7: "P"
+	0-7: "Stmt"
+		0-5: "Add"
+			0-3: "Add"
+				0-1: "Num" - Data: "1"
+				1-2: "Operator" - Data: "+"
+				2-3: "Num" - Data: "2"
+			3-4: "Operator" - Data: "+"
+			4-5: "Num" - Data: "3"
+		6-7: "Num" - Data: "4"
+`,
+		},
+		{
+			prec,
+			map[string]parser.Shape{"Sum": {Lift: true}},
+			"1+2+3;4",
+			`0-7: "P"
+	0-7: "Stmt"
+		0-1: "Number" - Data: "1"
+		1-2: "Operator" - Data: "+"
+		2-3: "Number" - Data: "2"
+		3-4: "Operator" - Data: "+"
+		4-5: "Number" - Data: "3"
+		6-7: "Number" - Data: "4"
+`,
+		},
+		{
+			prec,
+			map[string]parser.Shape{"Sum": {Drop: true}},
+			"1+2+3;4",
+			`0-7: "P"
+	0-7: "Stmt"
+		6-7: "Number" - Data: "4"
+`,
+		},
+	}
+	for _, test := range tests {
+		var p Peg
+		if !p.Parse(test.grammar) {
+			t.Fatal("Didn't parse correctly", p.Error())
+		}
+		in, err := parser.NewInterpreter(p.RootNode(), "P", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		in.Shapes = test.shapes
+		if !in.Parse(test.in) {
+			t.Error("Interpreter didn't parse correctly", in.Error())
+		} else if out := in.RootNode().String(); out != test.exp {
+			t.Errorf("Expected the shaped tree\n%s\nnot\n%s", test.exp, out)
+		}
+		trees := map[string]string{test.in: test.exp}
+		runGenerated(t, test.grammar, parser.GeneratorSettings{Name: "P", Shapes: test.shapes}, map[string]string{"trees_test.go": treeTest("p", "P", trees)})
+	}
+}
+
+func TestFuzz(t *testing.T) {
+	var p Peg
+	for _, fn := range []string{"../json/json.peg", "../expression/expression.peg", "../ini/ini.peg", "../xml/xml.peg"} {
+		data, err := ioutil.ReadFile(fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !p.Parse(string(data)) {
+			t.Fatal("Didn't parse correctly", p.Error())
+		}
+		var samples [2][]string
+		for i := range samples {
+			g, err := fuzz.New(p.RootNode(), fuzz.Config{Seed: 1})
+			if err != nil {
+				t.Fatal(fn, err)
+			}
+			for j := 0; j < 20; j++ {
+				s, err := g.Generate()
+				if err != nil {
+					t.Fatal(fn, err)
+				}
+				samples[i] = append(samples[i], s)
+			}
+		}
+		if strings.Join(samples[0], "\x00") != strings.Join(samples[1], "\x00") {
+			t.Errorf("%s: the same seed gave different samples", fn)
+		}
+	}
+
+	for _, test := range []struct {
+		peg  string
+		want []string
+	}{
+		{"A <- !'b' [ab]\n", []string{"a"}},
+		{"A <- x:[ab] =x\n", []string{"aa", "bb"}},
+		{"A <- 'a' A / 'b'\n", []string{"b", "ab", "aab", "aaab", "aaaab"}},
+		{"A <- ('x' / 'y') &'y' [xy]\n", []string{"xy", "yy"}},
+	} {
+		if !p.Parse(test.peg) {
+			t.Fatal("Didn't parse correctly", p.Error())
+		}
+		g, err := fuzz.New(p.RootNode(), fuzz.Config{Seed: 2, MaxDepth: 3})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 10; i++ {
+			s, err := g.Generate()
+			if err != nil {
+				t.Fatal(err)
+			}
+			found := false
+			for _, w := range test.want {
+				found = found || s == w
+			}
+			if !found {
+				t.Errorf("%q generated %q", test.peg, s)
+			}
+		}
+	}
+
+	if !p.Parse("A <- 'a' A\n") {
+		t.Fatal("Didn't parse correctly", p.Error())
+	}
+	if _, err := fuzz.New(p.RootNode(), fuzz.Config{}); err == nil {
+		t.Error("Expected an error for a grammar without finite input")
+	}
+	if !p.Parse("A <- 'a' / 'b'\n") {
+		t.Fatal("Didn't parse correctly", p.Error())
+	}
+	g, err := fuzz.New(p.RootNode(), fuzz.Config{Weights: map[string][]float64{"A": {0, 1}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if s, _ := g.Generate(); s != "b" {
+			t.Errorf("Expected the weights to only allow \"b\", not %q", s)
+		}
+	}
+}
+
+func TestFuzzTarget(t *testing.T) {
+	s := parser.GeneratorSettings{
+		Name:     "List",
+		Testname: "testdata/*.in",
+		Samples:  "testdata/samples",
+	}
+	out := runGenerated(t, "List <- [a-z]+\n", s, map[string]string{
+		"testdata/word.in":   "abc",
+		"testdata/word.out":  "0-3: \"List\"\n\t0-3: \"List\" - Data: \"abc\"\n",
+		"testdata/samples/0": "xyz",
+		// Directories among the samples are skipped
+		"testdata/samples/dir/1": "123",
+		// A failure go test saved to the fuzz corpus
+		"testdata/fuzz/FuzzParser/saved": "go test fuzz v1\nstring(\"a1\")\n",
+	})
+	// The samples seed the fuzz target, which go test runs with them
+	// and the saved corpus
+	for _, exp := range []string{"--- PASS: TestParser", "--- PASS: TestSamples", "--- PASS: FuzzParser", "--- PASS: FuzzParser/saved"} {
+		if !strings.Contains(out, exp) {
+			t.Errorf("Expected %q in the output of the generated tests:\n%s", exp, out)
+		}
+	}
+}
+
+func TestLint(t *testing.T) {
+	tests := []struct {
+		in  string
+		exp []string
+	}{
+		{"A <- 'a'\n", nil},
+		{"A <- B\n", []string{`1:6: error: A refers to the undefined B`}},
+		{"A <- B 'a'\nB <- 'b' A?\n", nil},
+		{"A <- B 'a'\nB <- C? A\nC <- 'c'\n", []string{
+			`1:1: error: A is left recursive: A -> B -> A`,
+			`2:1: error: B is left recursive: B -> A -> B`,
+		}},
+		{"A <- B*\nB <- 'b'?\n", []string{`1:6: error: B can match nothing, so repeating it never ends`}},
+		{"A <- ('a' / !'b')+\n", []string{`1:6: error: ('a' / !'b') can match nothing, so repeating it never ends`}},
+		{"A <- 'a'\nB <- 'b'\n", []string{`2:1: warning: B is never used`}},
+		{"@start B\nA <- 'a'\nB <- 'b'\n", []string{`2:1: warning: A is never used`}},
+		{"@start C\nA <- 'a'\n", []string{`1:1: error: unknown start definition "C"`, `2:1: warning: A is never used`}},
+		{"A <- x:'a' =y\n", []string{`1:13: error: A refers back to the unknown capture y`}},
+		{"A <- 'a'\nA <- 'b'\n", []string{`2:1: error: A is defined more than once`}},
+	}
+	for _, test := range tests {
+		var p Peg
+		if !p.Parse(test.in) {
+			t.Fatal("Didn't parse correctly", p.Error())
+		}
+		var got []string
+		for _, d := range parser.Lint(p.RootNode()) {
+			got = append(got, d.String())
+		}
+		if strings.Join(got, "\n") != strings.Join(test.exp, "\n") {
+			t.Errorf("Lint of %q\nExpected:\n%s\nGot:\n%s", test.in, strings.Join(test.exp, "\n"), strings.Join(got, "\n"))
+		}
+	}
+
+	for _, fn := range []string{"peg.peg", "../json/json.peg", "../xml/xml.peg", "../ini/ini.peg", "../expression/expression.peg", "../plistxml/plistxml.peg"} {
+		data, err := ioutil.ReadFile(fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var p Peg
+		if !p.Parse(string(data)) {
+			t.Fatal("Didn't parse correctly", p.Error())
+		}
+		for _, d := range parser.Lint(p.RootNode()) {
+			if d.Severity == parser.SeverityError {
+				t.Errorf("%s:%s", fn, d)
+			}
+		}
+	}
+}
+
+// countTracer counts the events it's told about by kind
+type countTracer [4]int
+
+func (t *countTracer) Trace(e parser.Event) {
+	t[e.Kind]++
+}
+
+// TestTrace checks the events a generated parser traces, both as text
+// and as JSON Lines read back with ReadTrace
+func TestTrace(t *testing.T) {
+	const grammar = "A <- 'a' B / 'a' 'c'\nB <- 'b'\n"
+	const text = `enter A at 0
+  enter B at 1
+    mismatch 'b' at 1
+  exit B 1-1, failed
+  backtrack A from 1 to 0
+exit A 0-2, matched
+`
+	trace := `package trace
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	. "github.com/quarnster/parser"
+)
+
+func TestTracers(t *testing.T) {
+	var buf bytes.Buffer
+	p := Trace{Tracer: &TextTracer{W: &buf}}
+	if !p.Parse("ac") {
+		t.Fatal(p.Error())
+	}
+	exp := ` + "`" + text + "`" + `
+	if buf.String() != exp {
+		t.Errorf("Expected the text trace:\n%s\nGot:\n%s", exp, buf.String())
+	}
+
+	buf.Reset()
+	jt := NewJSONTracer(&buf)
+	p = Trace{Tracer: jt}
+	if !p.Parse("ac") {
+		t.Fatal(p.Error())
+	} else if err := jt.Err(); err != nil {
+		t.Fatal(err)
+	}
+	events, err := ReadTrace(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	for _, e := range events {
+		lines = append(lines, e.String())
+	}
+	var expLines []string
+	for _, l := range strings.Split(strings.TrimSpace(exp), "\n") {
+		expLines = append(expLines, strings.TrimSpace(l))
+	}
+	if got, exp := strings.Join(lines, "\n"), strings.Join(expLines, "\n"); got != exp {
+		t.Errorf("Expected to read back:\n%s\nGot:\n%s", exp, got)
+	}
+}
+`
+	s := parser.GeneratorSettings{Name: "Trace", DebugLevel: parser.DebugLevelAccept}
+	if out := runGenerated(t, grammar, s, map[string]string{"trace_test.go": trace}); !strings.Contains(out, "--- PASS: TestTracers") {
+		t.Errorf("The traces weren't tested:\n%s", out)
+	}
+}
+
+// TestParallel parses, generates and interprets grammars in several
+// goroutines at once, which go test -race checks don't share any state
+func TestParallel(t *testing.T) {
+	data, err := ioutil.ReadFile("../json/json.peg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p Peg
+	if !p.Parse(string(data)) {
+		t.Fatal("Didn't parse correctly", p.Error())
+	}
+	tree := p.RootNode().String()
+	generate := func(root *parser.Node, level parser.DebugLevel) (map[string]string, error) {
+		out := make(map[string]string)
+		s := parser.GeneratorSettings{
+			Name:       "JSON",
+			DebugLevel: level,
+			WriteFile: func(name, data string) error {
+				out[name] = data
+				return nil
+			},
+		}
+		err := parser.GenerateParser(root, &parser.GoGenerator{RootNode: root}, s)
+		return out, err
+	}
+	levels := []parser.DebugLevel{parser.DebugLevelNone, parser.DebugLevelAccept}
+	var exp []map[string]string
+	for _, level := range levels {
+		out, err := generate(p.RootNode(), level)
+		if err != nil {
+			t.Fatal(err)
+		}
+		exp = append(exp, out)
+	}
+	in := "{\"a\": [1, 2.5, true, null, \"b\"]}\n"
+	interpret := func(root *parser.Node) (string, *countTracer, error) {
+		ip, err := parser.NewInterpreter(root, "JSON", []string{"Spacing", "Values", "Value", "QuotedText", "KeyValuePairs", "JsonFile"})
+		if err != nil {
+			return "", nil, err
+		}
+		tr := &countTracer{}
+		ip.Tracer = tr
+		if !ip.Parse(in) {
+			return "", nil, ip.Error()
+		}
+		return ip.RootNode().String(), tr, nil
+	}
+	expTree, expTrace, err := interpret(p.RootNode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expTrace[parser.EventEnter] == 0 || expTrace[parser.EventEnter] != expTrace[parser.EventExit] || expTrace[parser.EventMismatch] == 0 || expTrace[parser.EventBacktrack] == 0 {
+		t.Errorf("Unexpected trace: %v", *expTrace)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var p Peg
+			if !p.Parse(string(data)) {
+				t.Error("Didn't parse correctly", p.Error())
+				return
+			}
+			if root := p.RootNode().String(); root != tree {
+				t.Errorf("Parsing in parallel gave another tree:\n%s", root)
+			}
+			for i, level := range levels {
+				out, err := generate(p.RootNode(), level)
+				if err != nil {
+					t.Error(err)
+				} else if !reflect.DeepEqual(out, exp[i]) {
+					t.Errorf("Generating in parallel at debug level %d gave other code", level)
+				}
+			}
+			got, trace, err := interpret(p.RootNode())
+			if err != nil {
+				t.Error(err)
+			} else if got != expTree || *trace != *expTrace {
+				t.Errorf("Interpreting in parallel gave another result: %v\n%s", *trace, got)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// The generated parsers, each with a tracer of its own, which
+	// also fail if a rule that didn't match consumed input
+	parallel := `package json
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	. "github.com/quarnster/parser"
+)
+
+func TestTraceParallel(t *testing.T) {
+	in := ` + "`" + in + "`" + `
+	parse := func() (string, string) {
+		var buf bytes.Buffer
+		p := JSON{Tracer: &TextTracer{W: &buf}}
+		if !p.Parse(in) {
+			t.Error(p.Error())
+		}
+		return p.RootNode().String(), buf.String()
+	}
+	exp, expTrace := parse()
+	if expTrace == "" {
+		t.Fatal("Nothing was traced")
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if got, trace := parse(); got != exp || trace != expTrace {
+				t.Errorf("Parsing in parallel gave another result:\n%s\n%s", got, trace)
+			}
+		}()
+	}
+	wg.Wait()
+}
+`
+	for _, level := range []parser.DebugLevel{parser.DebugLevelAccept, parser.DebugLevelEnterExit} {
+		s := parser.GeneratorSettings{Name: "JSON", DebugLevel: level}
+		if out := runGenerated(t, string(data), s, map[string]string{"parallel_test.go": parallel}, "-race"); !strings.Contains(out, "--- PASS: TestTraceParallel") {
+			t.Errorf("The parser generated at debug level %d wasn't tested in parallel:\n%s", level, out)
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	deep := "A <- " + strings.Repeat("(", 10000) + "'a'" + strings.Repeat(")", 10000) + "\n"
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	tests := []struct {
+		ctx    context.Context
+		limits parser.Limits
+		limit  string
+	}{
+		{context.Background(), parser.Limits{Depth: 1000}, "depth"},
+		{context.Background(), parser.Limits{Steps: 100}, "steps"},
+		{context.Background(), parser.Limits{Nodes: 10}, "nodes"},
+		{expired, parser.Limits{}, "context"},
+		{context.Background(), parser.Limits{}, ""},
+	}
+	for _, test := range tests {
+		p := Peg{Limits: test.limits}
+		ok := p.ParseContext(test.ctx, deep)
+		err, limited := p.Error().(*parser.LimitError)
+		switch {
+		case test.limit == "" && (!ok || limited):
+			t.Errorf("Didn't parse correctly without limits: %s", p.Error())
+		case test.limit != "" && (ok || !limited || err.Limit != test.limit):
+			t.Errorf("Expected the %s limit to be exceeded with %+v, got %v, %v", test.limit, test.limits, ok, p.Error())
+		case test.limit == "context" && !errors.Is(err, context.DeadlineExceeded):
+			t.Errorf("Expected the deadline to be exceeded, not %v", err)
+		}
+	}
+	// Parse applies the limits as well
+	p := Peg{Limits: parser.Limits{Depth: 1000}}
+	if p.Parse(deep) {
+		t.Error("Parse didn't apply the limits")
+	} else if err := p.Error(); err.Line() != 1 || !strings.Contains(err.Description(), "depth limit of 1000") {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
+
+func TestErrorOffset(t *testing.T) {
+	var p Peg
+	p.Parse("A <- 'å'\nB <- å\n")
+	e := p.Error()
+	if e.Offset() != p.LastError {
+		t.Errorf("Expected the error at %d, not %d", p.LastError, e.Offset())
+	}
+	if line, column := p.ParserData.LineCol(e.Offset()); line != e.Line() || column != e.Column() || line != 2 || column != 6 {
+		t.Errorf("Expected the error at 2:6, not %d:%d (%d:%d)", e.Line(), e.Column(), line, column)
+	}
+	if e := parser.NewError(1, 1, "x"); e.Offset() != -1 {
+		t.Errorf("Expected an unknown offset, not %d", e.Offset())
+	}
+}
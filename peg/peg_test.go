@@ -67,6 +67,8 @@ func TestParser(t *testing.T) {
 						{"EndOfLine", ignore},
 						{"IdentStart", justcall},
 						{"IdentCont", justcall},
+						{"Braces", justcall},
+						{"GoLiteral", justcall},
 						{"SLASH", ignore},
 						{"LEFTARROW", ignore},
 						{"OPEN", ignore},
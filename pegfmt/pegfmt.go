@@ -0,0 +1,451 @@
+/*
+Copyright (c) 2012-2013 Fredrik Ehnbom
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice, this
+   list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE LIABLE FOR
+ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+(INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+(INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+// Package pegfmt formats grammars in a canonical way.
+package pegfmt
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/quarnster/parser"
+	"github.com/quarnster/parser/peg"
+	"sort"
+	"strings"
+)
+
+// Width is the column past which the alternatives of a definition are
+// wrapped onto continuation lines
+const Width = 80
+
+type (
+	// comment is a "#" comment in the source, ending before the new line
+	comment struct {
+		begin, end int
+	}
+
+	// unit is a line of its own in the output: a header, definition,
+	// lexical section or full line comment
+	unit struct {
+		node    *parser.Node
+		comment string
+		// Whether a blank line precedes it
+		blank bool
+		// Where the closing brace of a lexical section is
+		close int
+		// Comments at the end of the line of the alternative with the
+		// index of the key, and full line comments before it
+		trailing, before map[int][]string
+	}
+
+	formatter struct {
+		src      string
+		comments []comment
+		// The comments by the position they end at
+		ends map[int]int
+		buf  bytes.Buffer
+	}
+)
+
+// Source returns the grammar "src" formatted in the canonical way. Each
+// definition is on a line of its own with the arrows of consecutive
+// definitions aligned and a single space around each "/". Alternatives
+// that were on lines of their own stay so, and those that would go past
+// Width are wrapped onto continuation lines. Comments are kept, and so
+// are single blank lines.
+func Source(src []byte) ([]byte, error) {
+	var p peg.Peg
+	if !p.Parse(string(src)) {
+		return nil, fmt.Errorf("%s", p.Error())
+	}
+	root := p.RootNode()
+	if len(root.Children) == 0 || root.Children[len(root.Children)-1].Name != "EndOfFile" {
+		return nil, fmt.Errorf("%s", p.Error())
+	}
+	f := formatter{src: string(src), ends: make(map[int]int)}
+	f.scan()
+	f.write(f.units(root.Children[:len(root.Children)-1], 0, len(src)), "")
+	// pegparser fmt -w overwrites the grammar with the result, so
+	// rather fail than lose a comment.
+	res := formatter{src: f.buf.String(), ends: make(map[int]int)}
+	res.scan()
+	if len(res.comments) != len(f.comments) {
+		return nil, fmt.Errorf("formatting kept %d of the %d comments", len(res.comments), len(f.comments))
+	}
+	for i, c := range f.comments {
+		if exp, got := f.text(c), res.text(res.comments[i]); got != exp {
+			return nil, fmt.Errorf("formatting changed the comment %q into %q", exp, got)
+		}
+	}
+	return f.buf.Bytes(), nil
+}
+
+// scan finds the comments of the source, skipping over literals,
+// character classes and the code of semantic predicates
+func (f *formatter) scan() {
+	src := f.src
+	skip := func(i int, end byte) int {
+		for i++; i < len(src) && src[i] != end; i++ {
+			if src[i] == '\\' {
+				i++
+			}
+		}
+		return i
+	}
+	for i := 0; i < len(src); i++ {
+		switch c := src[i]; c {
+		case '#':
+			begin := i
+			for i < len(src) && src[i] != '\n' && src[i] != '\r' {
+				i++
+			}
+			f.comments = append(f.comments, comment{begin, i})
+			f.ends[i] = begin
+		case '\'', '"':
+			i = skip(i, c)
+		case '[':
+			i = skip(i, ']')
+		case '{':
+			if j := strings.TrimRight(src[:i], " \t\r\n"); !strings.HasSuffix(j, "&") && !strings.HasSuffix(j, "!") {
+				continue
+			}
+			for depth := 0; i < len(src); i++ {
+				if src[i] == '{' {
+					depth++
+				} else if src[i] == '}' {
+					if depth--; depth == 0 {
+						break
+					}
+				}
+			}
+		}
+	}
+}
+
+// skipBack returns the position after the content before "pos",
+// skipping white space and comments
+func (f *formatter) skipBack(pos int) int {
+	for {
+		for pos > 0 && strings.IndexByte(" \t\r\n", f.src[pos-1]) != -1 {
+			pos--
+		}
+		begin, ok := f.ends[pos]
+		if !ok {
+			return pos
+		}
+		pos = begin
+	}
+}
+
+// blank returns whether there's a blank line before "pos"
+func (f *formatter) blank(pos int) bool {
+	lines := 0
+	for ; pos > 0 && strings.IndexByte(" \t\r\n", f.src[pos-1]) != -1; pos-- {
+		if f.src[pos-1] == '\n' {
+			lines++
+		}
+	}
+	return lines > 1
+}
+
+// fullLine returns whether nothing but white space precedes the comment
+// "c" on its line
+func (f *formatter) fullLine(c comment) bool {
+	line := f.src[:c.begin]
+	if i := strings.LastIndexAny(line, "\r\n"); i != -1 {
+		line = line[i+1:]
+	}
+	return strings.TrimSpace(line) == ""
+}
+
+// text returns the text of the comment "c"
+func (f *formatter) text(c comment) string {
+	return strings.TrimRight(f.src[c.begin:c.end], " \t")
+}
+
+// in returns the comments in between "begin" and "end"
+func (f *formatter) in(begin, end int) []comment {
+	i := sort.Search(len(f.comments), func(i int) bool { return f.comments[i].begin >= begin })
+	j := sort.Search(len(f.comments), func(i int) bool { return f.comments[i].begin >= end })
+	return f.comments[i:j]
+}
+
+// units returns the output lines of the headers, definitions and
+// lexical sections "items" written in between "begin" and "end" in the
+// source, along with the comments there
+func (f *formatter) units(items []*parser.Node, begin, end int) (units []unit) {
+	full := func(c comment) {
+		units = append(units, unit{comment: f.text(c), blank: len(units) > 0 && f.blank(c.begin)})
+	}
+	if len(items) > 0 {
+		end := items[0].Range.Begin()
+		for _, c := range f.in(begin, end) {
+			full(c)
+		}
+	}
+	for i, item := range items {
+		regionEnd := end
+		if i+1 < len(items) {
+			regionEnd = items[i+1].Range.Begin()
+		}
+		u := unit{node: item, blank: len(units) > 0 && f.blank(item.Range.Begin()), trailing: make(map[int][]string), before: make(map[int][]string)}
+		contentEnd := f.skipBack(regionEnd)
+		if item.Name == "Lexical" {
+			u.close = contentEnd - 1
+		} else {
+			f.inner(&u, f.in(item.Range.Begin(), contentEnd))
+		}
+		units = append(units, u)
+		last := &units[len(units)-1]
+		for j, c := range f.in(contentEnd, regionEnd) {
+			if j == 0 && !strings.ContainsAny(f.src[contentEnd:c.begin], "\r\n") {
+				last.trailing[-1] = append(last.trailing[-1], f.text(c))
+			} else {
+				full(c)
+			}
+		}
+	}
+	return
+}
+
+// alternatives returns the alternatives of the definition "u" is for
+func alternatives(u *unit) []*parser.Node {
+	if u.node.Name == "Header" {
+		return nil
+	}
+	if expr := definition(u.node).Children[1]; expr.Name == "Expression" {
+		return expr.Children
+	}
+	return nil
+}
+
+// inner assigns the comments "cs" within the definition "u" to its
+// alternatives. Full line comments in between two alternatives go on
+// the line before the latter one, and the others at the end of the
+// line of the alternative they are in.
+func (f *formatter) inner(u *unit, cs []comment) {
+	alts := alternatives(u)
+	for _, c := range cs {
+		k := 0
+		for k+1 < len(alts) && alts[k+1].Range.Begin() <= c.begin {
+			k++
+		}
+		if k+1 < len(alts) && f.fullLine(c) && c.begin >= f.skipBack(f.skipBack(alts[k+1].Range.Begin())-1) {
+			u.before[k+1] = append(u.before[k+1], f.text(c))
+		} else {
+			u.trailing[k] = append(u.trailing[k], f.text(c))
+		}
+	}
+}
+
+// separated returns whether the source has a new line in between the
+// alternative "alt" and the "/" in front of it
+func (f *formatter) separated(alt *parser.Node) bool {
+	slash := f.skipBack(alt.Range.Begin()) - 1
+	return strings.ContainsAny(f.src[f.skipBack(slash):alt.Range.Begin()], "\r\n")
+}
+
+// kind returns what kind of line "u" is, with definitions and trivia
+// being the same kind
+func (u *unit) kind() string {
+	if u.node == nil {
+		return ""
+	} else if u.node.Name == "Trivia" {
+		return "Definition"
+	}
+	return u.node.Name
+}
+
+// write writes the output lines "units", each indented by "indent".
+// The arrows of the definitions and the values of the headers are
+// aligned with those of the same kind on the lines around them, up to a
+// blank line.
+func (f *formatter) write(units []unit, indent string) {
+	var (
+		// The index of the first line of the group of each line, and
+		// the width of the names of each group
+		groups = make([]int, len(units))
+		widths = make([]int, len(units))
+		group  = 0
+		kind   = ""
+	)
+	for i := range units {
+		u := &units[i]
+		if k := u.kind(); u.blank || k != "" && kind != "" && k != kind {
+			group, kind = i, ""
+		}
+		if u.node != nil {
+			kind = u.kind()
+			if l := len(name(u.node)); l > widths[group] && kind != "Lexical" {
+				widths[group] = l
+			}
+		}
+		groups[i] = group
+	}
+	for i := range units {
+		u := &units[i]
+		width := widths[groups[i]]
+		if u.blank {
+			f.buf.WriteString("\n")
+		}
+		switch {
+		case u.node == nil:
+			f.buf.WriteString(indent + u.comment + "\n")
+		case u.node.Name == "Header":
+			f.line(fmt.Sprintf("%s%-*s %s", indent, width, name(u.node), u.node.Children[1].Data()), u.trailing[0], u.trailing[-1])
+		case u.node.Name == "Lexical":
+			f.buf.WriteString(indent + "%lexical {\n")
+			begin := u.node.Range.Begin() + len("%lexical")
+			begin += strings.Index(f.src[begin:], "{") + 1
+			f.write(f.units(u.node.Children, begin, u.close), indent+"\t")
+			f.line(indent+"}", u.trailing[-1])
+		default:
+			f.definition(u, indent, width)
+		}
+	}
+}
+
+// line writes "text" followed by the comments "cs" and a new line
+func (f *formatter) line(text string, cs ...[]string) {
+	f.buf.WriteString(text)
+	for _, c := range cs {
+		for _, c := range c {
+			f.buf.WriteString(" " + c)
+		}
+	}
+	f.buf.WriteString("\n")
+}
+
+// columns returns the width of "s" with tabs taking eight columns
+func columns(s string) int {
+	return len(s) + 7*strings.Count(s, "\t")
+}
+
+// definition writes the definition "u" with its name padded to "width"
+func (f *formatter) definition(u *unit, indent string, width int) {
+	line := fmt.Sprintf("%s%-*s <- ", indent, width, name(u.node))
+	alts := alternatives(u)
+	if alts == nil {
+		f.line(line+expression(definition(u.node).Children[1]), u.trailing[0], u.trailing[-1])
+		return
+	}
+	var cs []string
+	cont := indent + strings.Repeat(" ", width+2) + "/ "
+	for i, alt := range alts {
+		text := expression(alt)
+		if i > 0 {
+			if f.separated(alt) || len(u.before[i]) > 0 || columns(line)+3+len(text) > Width {
+				f.line(line, cs)
+				for _, c := range u.before[i] {
+					f.buf.WriteString(indent + strings.Repeat(" ", width+2) + c + "\n")
+				}
+				line, cs = cont, nil
+			} else {
+				line += " / "
+			}
+		}
+		line += text
+		cs = append(cs, u.trailing[i]...)
+	}
+	f.line(line, cs, u.trailing[-1])
+}
+
+// definition returns the Definition of a Definition or Trivia node
+func definition(n *parser.Node) *parser.Node {
+	if n.Name == "Trivia" {
+		return n.Children[0]
+	}
+	return n
+}
+
+// name returns what's written in front of the arrow of the Definition
+// or Trivia node "n", or in front of the value of the Header node "n"
+func name(n *parser.Node) string {
+	switch n.Name {
+	case "Trivia":
+		return "%trivia " + n.Children[0].Children[0].Data()
+	case "Header":
+		return "@" + n.Children[0].Data()
+	}
+	return n.Children[0].Data()
+}
+
+// expression returns the canonical text of the expression "n"
+func expression(n *parser.Node) string {
+	switch n.Name {
+	case "Expression":
+		var alts []string
+		for _, child := range n.Children {
+			alts = append(alts, expression(child))
+		}
+		return strings.Join(alts, " / ")
+	case "Sequence":
+		var items []string
+		for _, child := range n.Children {
+			items = append(items, expression(child))
+		}
+		return strings.Join(items, " ")
+	case "Prefix", "Suffix":
+		ret := ""
+		for _, child := range n.Children {
+			ret += expression(child)
+		}
+		return ret
+	case "Primary":
+		if front := n.Children[0]; front.Name == "Expression" {
+			return "(" + expression(front) + ")"
+		}
+		return expression(n.Children[0])
+	case "Label":
+		return n.Children[0].Data() + ":"
+	case "Predicate":
+		return expression(n.Children[0]) + "{" + n.Children[1].Data() + "}"
+	case "BackReference":
+		return "=" + n.Children[0].Data()
+	case "Precedence":
+		var levels []string
+		for _, level := range n.Children[1:] {
+			l := level.Children[0].Data()
+			for _, op := range level.Children[1:] {
+				l += " " + op.Data()
+			}
+			levels = append(levels, l)
+		}
+		return "%prec " + n.Children[0].Data() + " { " + strings.Join(levels, "; ") + " }"
+	case "AND":
+		return "&"
+	case "NOT":
+		return "!"
+	case "CUT":
+		return "^"
+	case "QUESTION":
+		return "?"
+	case "STAR":
+		return "*"
+	case "PLUS":
+		return "+"
+	case "DOT":
+		return "."
+	}
+	return strings.TrimSpace(n.Data())
+}
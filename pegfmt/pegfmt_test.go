@@ -0,0 +1,165 @@
+/*
+Copyright (c) 2012-2013 Fredrik Ehnbom
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice, this
+   list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE LIABLE FOR
+ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+(INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+(INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+package pegfmt
+
+import (
+	"github.com/quarnster/parser"
+	"github.com/quarnster/parser/peg"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		in, exp string
+	}{
+		{
+			"A<-B/C\nLonger    <-   'x'\n",
+			"A      <- B / C\nLonger <- 'x'\n",
+		},
+		{
+			"@start A\n@package x\n\nA <- B\n\n\n\nB <- 'b'\n",
+			"@start   A\n@package x\n\nA <- B\n\nB <- 'b'\n",
+		},
+		{
+			"# leading\nA <- B # trailing\n   # before C\n   / C\n   / (D # inner\n   E)+\nB <- 'b'\n# end\n",
+			"# leading\nA <- B # trailing\n   # before C\n   / C\n   / (D E)+ # inner\nB <- 'b'\n# end\n",
+		},
+		{
+			`A <- "aaaaaaaaaaaaaaaaaaaa" / "bbbbbbbbbbbbbbbbbbbbbbb" / "cccccccccccccccccccccccc" / 'd'` + "\n",
+			`A <- "aaaaaaaaaaaaaaaaaaaa" / "bbbbbbbbbbbbbbbbbbbbbbb"` + "\n" + `   / "cccccccccccccccccccccccc" / 'd'` + "\n",
+		},
+		{
+			"A <- &{ x # y } '#' [#] \"#\"\n",
+			"A <- &{ x # y } '#' [#] \"#\"\n",
+		},
+		{
+			"A <- B\n%lexical {\n    # tokens\n    B <- [b]\n    %trivia Spacing <- [ ]+ # spaces\n    # done\n} # lexical\n",
+			"A <- B\n%lexical {\n\t# tokens\n\tB               <- [b]\n\t%trivia Spacing <- [ ]+ # spaces\n\t# done\n} # lexical\n",
+		},
+		{
+			"A <- %prec B {left \"+\" \"-\";right '^'}\nB <- x:'b' =x\n",
+			"A <- %prec B { left \"+\" \"-\"; right '^' }\nB <- x:'b' =x\n",
+		},
+	}
+	for _, test := range tests {
+		out, err := Source([]byte(test.in))
+		if err != nil {
+			t.Errorf("%q: %s", test.in, err)
+		} else if string(out) != test.exp {
+			t.Errorf("%q\nExpected:\n%s\nGot:\n%s", test.in, test.exp, out)
+		} else if again, _ := Source(out); string(again) != string(out) {
+			t.Errorf("Formatting %q again changed it to:\n%s", out, again)
+		}
+	}
+	if _, err := Source([]byte("A <- 'a\n")); err == nil {
+		t.Error("Expected an error for an invalid grammar")
+	}
+}
+
+func diff(b1, b2 []byte) (data []byte, err error) {
+	f1, err := ioutil.TempFile("", "pegfmt")
+	if err != nil {
+		return
+	}
+	defer os.Remove(f1.Name())
+	defer f1.Close()
+
+	f2, err := ioutil.TempFile("", "pegfmt")
+	if err != nil {
+		return
+	}
+	defer os.Remove(f2.Name())
+	defer f2.Close()
+
+	f1.Write(b1)
+	f2.Write(b2)
+
+	data, err = exec.Command("diff", "-u", f1.Name(), f2.Name()).CombinedOutput()
+	if len(data) > 0 {
+		// diff exits with a non-zero status when the files don't match.
+		// Ignore that failure as long as we get output.
+		err = nil
+	}
+	return
+}
+
+// generate returns the go parser generated from the grammar "src",
+// without the comments quoting the grammar
+func generate(t *testing.T, src []byte) map[string]string {
+	var p peg.Peg
+	if !p.Parse(string(src)) {
+		t.Fatal("Didn't parse correctly", p.Error())
+	}
+	files := make(map[string]string)
+	s := parser.GeneratorSettings{
+		Name:     "Test",
+		Testname: "testdata/*.in",
+		WriteFile: func(name, data string) error {
+			var lines []string
+			for _, line := range strings.Split(data, "\n") {
+				if !strings.HasPrefix(strings.TrimSpace(line), "//") {
+					lines = append(lines, line)
+				}
+			}
+			files[name] = strings.Join(lines, "\n")
+			return nil
+		},
+	}
+	if err := parser.GenerateParser(p.RootNode(), &parser.GoGenerator{RootNode: p.RootNode()}, s); err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, fn := range []string{"../peg/peg.peg", "../json/json.peg", "../xml/xml.peg", "../ini/ini.peg", "../plistxml/plistxml.peg", "../expression/expression.peg", "../test.peg", "../gen.peg"} {
+		src, err := ioutil.ReadFile(fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := Source(src)
+		if err != nil {
+			t.Errorf("%s: %s", fn, err)
+			continue
+		}
+		if again, _ := Source(out); string(again) != string(out) {
+			t.Errorf("%s: Formatting again changed the result", fn)
+		}
+		if n := strings.Count(string(src), "#"); n != strings.Count(string(out), "#") {
+			t.Errorf("%s: Lost comments", fn)
+		}
+		a, b := generate(t, src), generate(t, out)
+		for name, data := range a {
+			if b[name] != data {
+				d, _ := diff([]byte(data), []byte(b[name]))
+				t.Errorf("%s: The generated %s differs after formatting:\n%s", fn, name, d)
+			}
+		}
+	}
+}
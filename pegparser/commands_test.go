@@ -0,0 +1,147 @@
+/*
+Copyright (c) 2012-2013 Fredrik Ehnbom
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice, this
+   list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE LIABLE FOR
+ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+(INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+(INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCommands(t *testing.T) {
+	dir, err := ioutil.TempDir("", "commands")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, data := range map[string]string{
+		"list.peg":  "List <- Item (',' Item)* !.\nItem <- [a-z]+\n",
+		"lint.peg":  "A <- B  \nC <- 'c'\n",
+		"ok.in":     "a,bc",
+		"bad.in":    "a,,b",
+		"comma.in":  "a,",
+		"bad.jsonl": "{\"kind\":\"enter\",\"name\":\"List\",\"start\":0}\n{\"kind\":\"leave\"}\n",
+		"error.peg": "A <- 'a\n",
+		"sem.peg":   "A <- [a-z]+ &{ true }\n",
+		"notes.peg": "# A list\nList<-Item (',' Item)* !.  # to the end\n\n# Words\nItem <- [a-z]+\n",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	list := filepath.Join(dir, "list.peg")
+	tests := []struct {
+		cmd  func([]string, io.Writer) int
+		args []string
+		ret  int
+		exp  string
+	}{
+		{parse, []string{list, filepath.Join(dir, "ok.in")}, 0, "0-4: \"LIST\"\n\t0-4: \"List\"\n\t\t0-1: \"Item\" - Data: \"a\"\n\t\t2-4: \"Item\" - Data: \"bc\"\n"},
+		{parse, []string{"-rule", "Item", list, filepath.Join(dir, "ok.in")}, 1, "0-1: \"LIST\"\n\t0-1: \"Item\" - Data: \"a\"\n"},
+		{parse, []string{"-lift", "List", "-rename", "Item=Word", list, filepath.Join(dir, "ok.in")}, 0, "0-4: \"LIST\"\n\t0-1: \"Word\" - Data: \"a\"\n\t2-4: \"Word\" - Data: \"bc\"\n"},
+		{parse, []string{"-rename", "Item", list, filepath.Join(dir, "ok.in")}, 2, ""},
+		{parse, []string{list, filepath.Join(dir, "bad.in")}, 1, ""},
+		{parse, []string{list, filepath.Join(dir, "missing.in")}, 2, ""},
+		{parse, []string{filepath.Join(dir, "error.peg"), filepath.Join(dir, "ok.in")}, 2, ""},
+		{parse, []string{filepath.Join(dir, "sem.peg"), filepath.Join(dir, "ok.in")}, 2, ""},
+		{parse, []string{"-format", "svg", list}, 2, ""},
+		{parse, []string{"-trace", filepath.Join(dir, "trace.jsonl"), list, filepath.Join(dir, "comma.in")}, 1, ""},
+		{replay, []string{filepath.Join(dir, "trace.jsonl"), filepath.Join(dir, "comma.in")}, 0, `enter List at 1:1
+  enter Item at 1:1
+    mismatch [a-z] at 1:2, found ","
+  exit Item at 1:2, matched "a"
+  enter Item at 1:3
+    mismatch [a-z] at 1:3, found end of input
+  exit Item at 1:3, failed
+  backtrack List from 1:3 to 1:2, giving up ","
+  backtrack List from 1:2 to 1:1, giving up "a"
+exit List at 1:1, failed
+`},
+		{replay, []string{"-depth", "1", filepath.Join(dir, "trace.jsonl"), filepath.Join(dir, "comma.in")}, 0, "enter List at 1:1\nexit List at 1:1, failed\n"},
+		{replay, []string{filepath.Join(dir, "bad.jsonl"), filepath.Join(dir, "comma.in")}, 2, ""},
+		{parse, nil, 2, ""},
+		{lint, []string{list}, 0, ""},
+		{lint, []string{filepath.Join(dir, "lint.peg")}, 1, filepath.Join(dir, "lint.peg") + ":1:6: error: A refers to the undefined B\n" + filepath.Join(dir, "lint.peg") + ":2:1: warning: C is never used\n"},
+		{graph, []string{list}, 0, "digraph \"LIST\" {\n\t\"List\";\n\t\"List\" -> \"Item\";\n\t\"Item\";\n}\n"},
+		{format, []string{list}, 0, "List <- Item (',' Item)* !.\nItem <- [a-z]+\n"},
+		{format, []string{"-d", list}, 0, ""},
+		{format, []string{"-d", filepath.Join(dir, "lint.peg")}, 0, "--- " + filepath.Join(dir, "lint.peg") + ".orig\n+++ " + filepath.Join(dir, "lint.peg") + "\n@@ -1,2 +1,2 @@\n-A <- B  \n+A <- B\n C <- 'c'\n"},
+	}
+	for i, test := range tests {
+		var buf bytes.Buffer
+		if ret := test.cmd(test.args, &buf); ret != test.ret {
+			t.Errorf("%d: Expected exit code %d, not %d", i, test.ret, ret)
+		}
+		if test.exp != "" && buf.String() != test.exp {
+			t.Errorf("%d: Expected %q, not %q", i, test.exp, buf.String())
+		}
+	}
+
+	notes := filepath.Join(dir, "notes.peg")
+	if ret := format([]string{"-w", notes}, ioutil.Discard); ret != 0 {
+		t.Errorf("Expected fmt -w to succeed, not to exit with %d", ret)
+	}
+	const exp = "# A list\nList <- Item (',' Item)* !. # to the end\n\n# Words\nItem <- [a-z]+\n"
+	if data, err := ioutil.ReadFile(notes); err != nil {
+		t.Error(err)
+	} else if string(data) != exp {
+		t.Errorf("Expected fmt -w to keep the comments, writing %q, not %q", exp, data)
+	}
+}
+
+func TestGenerateSamples(t *testing.T) {
+	dir, err := ioutil.TempDir("", "samples")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	saved := filepath.Join(dir, "testdata", "fuzz", "FuzzParser", "saved")
+	if err := os.MkdirAll(filepath.Dir(saved), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for fn, data := range map[string]string{
+		filepath.Join(dir, "list.peg"): "List <- [a-z]+\n",
+		saved:                          "go test fuzz v1\nstring(\"a1\")\n",
+	} {
+		if err := ioutil.WriteFile(fn, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Generating again replaces the samples but keeps the fuzz corpus
+	for i := 0; i < 2; i++ {
+		if ret := generate([]string{"-peg", filepath.Join(dir, "list.peg"), "-notest", "-header", "", "-fuzz", "3"}); ret != 0 {
+			t.Fatalf("Expected exit code 0, not %d", ret)
+		}
+	}
+	if files, err := filepath.Glob(filepath.Join(dir, "testdata", "samples", "*")); err != nil || len(files) != 3 {
+		t.Errorf("Expected 3 samples, not %v %v", files, err)
+	}
+	if _, err := os.Stat(saved); err != nil {
+		t.Errorf("Expected the fuzz corpus to be kept: %s", err)
+	}
+}
@@ -0,0 +1,119 @@
+/*
+Copyright (c) 2012-2013 Fredrik Ehnbom
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice, this
+   list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE LIABLE FOR
+ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+(INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+(INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/quarnster/parser/pegfmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+)
+
+// diff returns the differences between the grammar "fn" and its
+// formatted version "res" in the unified format
+func diff(fn string, src, res []byte) ([]byte, error) {
+	f1, err := ioutil.TempFile("", "pegfmt")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f1.Name())
+	defer f1.Close()
+
+	f2, err := ioutil.TempFile("", "pegfmt")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f2.Name())
+	defer f2.Close()
+
+	f1.Write(src)
+	f2.Write(res)
+
+	data, err := exec.Command("diff", "-u", "-L", fn+".orig", "-L", fn, f1.Name(), f2.Name()).CombinedOutput()
+	if len(data) > 0 {
+		// diff exits with a non-zero status when the files don't match.
+		// Ignore that failure as long as we get output.
+		err = nil
+	}
+	return data, err
+}
+
+// format formats the grammars named by the command line arguments
+// "args", writing them to "w" unless told to rewrite the files, and
+// returns the exit code
+func format(args []string, w io.Writer) int {
+	var (
+		fs    = flag.NewFlagSet("fmt", flag.ContinueOnError)
+		write = fs.Bool("w", false, "Write the result to the grammar file instead of the standard output")
+		diffs = fs.Bool("d", false, "Write the differences from the formatted grammars instead of the grammars")
+	)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), "usage: pegparser fmt [flags] grammar.peg...\n\nPrints the grammars in canonical form, with the arrows aligned, single spaces\naround the slashes and long alternatives wrapped. Comments are kept.\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+	for _, fn := range fs.Args() {
+		src, err := ioutil.ReadFile(fn)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		res, err := pegfmt.Source(src)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s:%s\n", fn, err)
+			return 1
+		}
+		if *diffs {
+			if bytes.Equal(src, res) {
+				continue
+			}
+			data, err := diff(fn, src, res)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 2
+			}
+			w.Write(data)
+		}
+		if *write && !bytes.Equal(src, res) {
+			if err := ioutil.WriteFile(fn, res, 0644); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 2
+			}
+		} else if !*diffs {
+			w.Write(res)
+		}
+	}
+	return 0
+}
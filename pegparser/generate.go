@@ -0,0 +1,276 @@
+/*
+Copyright (c) 2012-2013 Fredrik Ehnbom
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice, this
+   list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE LIABLE FOR
+ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+(INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+(INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/quarnster/parser"
+	"github.com/quarnster/parser/fuzz"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// dumpFlag is a boolean flag that optionally takes the format
+// to dump the tree in, as in -dumptree=html
+type dumpFlag string
+
+func (d *dumpFlag) String() string {
+	return string(*d)
+}
+
+func (d *dumpFlag) Set(value string) error {
+	switch value {
+	case "false":
+		*d = ""
+	case "true", "text":
+		*d = "text"
+	case "html", "dot":
+		*d = dumpFlag(value)
+	default:
+		return fmt.Errorf("unknown tree format %q", value)
+	}
+	return nil
+}
+
+func (d *dumpFlag) IsBoolFlag() bool {
+	return true
+}
+
+// writeSamples replaces the files in "dir" with "n" random inputs
+// generated from the grammar "root"
+func writeSamples(root *parser.Node, dir string, n int, seed int64) error {
+	g, err := fuzz.New(root, fuzz.Config{Seed: seed})
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for i := 0; i < n; i++ {
+		data, err := g.Generate()
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, fmt.Sprintf("sample%d", i)), []byte(data), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// generate generates a parser as instructed by the command line
+// arguments "args", and returns the exit code
+func generate(args []string) int {
+	fs := flag.NewFlagSet("generate", flag.ContinueOnError)
+	var (
+		pegfile    = ""
+		testfile   = ""
+		bench      = false
+		debug      = 0
+		dumptree   dumpFlag
+		notest     = false
+		profile    = false
+		coverage   = false
+		ignore     = ""
+		generator  = "go"
+		outpath    = ""
+		outfile    = ""
+		typename   = ""
+		header     = "default"
+		gogenerate = false
+		state      = ""
+		samples    = 0
+		seed       = int64(1)
+	)
+	fs.StringVar(&ignore, "ignore", ignore, "List of definitions to ignore (not generate nodes for)")
+	shape := addShapeFlags(fs)
+	fs.StringVar(&pegfile, "peg", pegfile, "Pegfile for which to generate a parser for")
+	fs.StringVar(&testfile, "testfile", testfile, "Glob, relative to the generated parser, of the inputs to test it with such as testdata/*.in. The tree of each input is compared with the file of the same name but with an .out extension, which go test -update writes")
+	fs.StringVar(&outpath, "outpath", outpath, "Destination directory path")
+	fs.StringVar(&outfile, "outfile", outfile, "Destination file")
+	fs.BoolVar(&bench, "bench", bench, "Whether to run a benchmark test or not")
+	fs.IntVar(&debug, "debug", debug, "The desired debug level the generated parser will use")
+	fs.Var(&dumptree, "dumptree", "Whether to make the generated parser spit out the generated tree. -dumptree=html or -dumptree=dot writes it to a file named after the -testfile instead")
+	fs.BoolVar(&notest, "notest", notest, "Whether to test the generated parser")
+	fs.BoolVar(&profile, "profile", profile, "Whether the generated parser records where it spends its time. The generated test writes a pprof profile of the grammar to profile.pb.gz")
+	fs.BoolVar(&coverage, "coverage", coverage, "Whether to count how often each alternative and repetition of the grammar matches. The generated test writes the counts to coverage.txt and coverage.html")
+	fs.StringVar(&generator, "generator", generator, "Which generator to use: go, c, cpp, java, py or railroad for syntax diagrams")
+	fs.StringVar(&header, "header", header, "Header to put at the top of the generated source code")
+	fs.StringVar(&typename, "name", typename, "Name of the generated type/namespace/package. By default it'll be based on the name of the .peg-file. Overridden by a @type header")
+	fs.StringVar(&state, "state", state, "Type of the user supplied State member accessible from semantic predicates")
+	fs.IntVar(&samples, "fuzz", samples, "Number of random inputs to generate from the grammar into testdata/samples, which the generated test checks parse to completion. Not for grammars with semantic predicates, which the sampling can't evaluate")
+	fs.Int64Var(&seed, "seed", seed, "Seed for the random inputs generated with -fuzz")
+	fs.BoolVar(&gogenerate, "gogenerate", gogenerate, "Add a Go 1.4 \"//go:generate\" line to the generated code")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), "usage: pegparser generate -peg file.peg [flags]\n\nGenerates a parser for the grammar and, unless -notest is given, runs its tests.\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if pegfile == "" {
+		fs.Usage()
+		return 2
+	}
+	if coverage && generator != "go" {
+		fmt.Fprintln(os.Stderr, "-coverage is only supported by the go generator")
+		return 2
+	}
+	if samples > 0 && generator != "go" {
+		fmt.Fprintln(os.Stderr, "-fuzz is only supported by the go generator")
+		return 2
+	}
+	if (dumptree == "html" || dumptree == "dot") && generator != "go" {
+		fmt.Fprintf(os.Stderr, "-dumptree=%s is only supported by the go generator\n", dumptree)
+		return 2
+	}
+	shapes, err := shape.shapes()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if shapes != nil && generator != "go" {
+		fmt.Fprintln(os.Stderr, "-lift, -collapse, -drop and -rename are only supported by the go generator")
+		return 2
+	}
+	grammar, err := loadGrammar(pegfile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	ignoreFunc := func(g parser.Generator, in string) string {
+		return g.Ignore(in)
+	}
+	var customActions []parser.CustomAction
+	for _, action := range splitList(ignore) {
+		customActions = append(customActions, parser.CustomAction{action, ignoreFunc})
+	}
+
+	var gen parser.Generator
+	switch generator {
+	case "go":
+		gen = &parser.GoGenerator{RootNode: grammar}
+	case "c":
+		gen = &parser.CGenerator{}
+	case "cpp":
+		gen = &parser.CPPGenerator{}
+	case "java":
+		gen = &parser.JavaGenerator{}
+	case "py":
+		gen = &parser.PyGenerator{}
+	case "railroad":
+		// Not a parser generator, handled below
+	default:
+		fmt.Fprintf(os.Stderr, "unknown generator %q\n", generator)
+		return 2
+	}
+
+	//	gen.AddDebugLogging = debug
+	root := outpath
+	if root == "" {
+		root = filepath.Dir(pegfile)
+		if generator != "go" {
+			root += "_" + generator
+		}
+	}
+	root += "/"
+	if gen != nil {
+		gen.SetCustomActions(customActions)
+	}
+	if header == "default" {
+		header = ""
+		gogenerate = true
+	}
+	if gogenerate {
+		header += "//go:generate"
+		for _, a := range os.Args {
+			header += " \"" + strings.Replace(strings.Replace(a, "\n", "\\n", -1), "\"", "\\\"", -1) + `"`
+		}
+		header += "\n"
+	}
+	if typename == "" {
+		typename = defaultName(pegfile)
+	}
+	s := parser.GeneratorSettings{
+		Header:      header,
+		Name:        typename,
+		Testname:    testfile,
+		FileName:    outfile,
+		Debug:       dumptree != "",
+		DumpFormat:  string(dumptree),
+		DebugLevel:  parser.DebugLevel(debug),
+		Bench:       bench,
+		Profile:     profile,
+		GrammarFile: filepath.Base(pegfile),
+		Coverage:    coverage,
+		State:       state,
+		Shapes:      shapes,
+		WriteFile: func(name, data string) error {
+			if err := os.Mkdir(root, 0755); err != nil && !os.IsExist(err) {
+				return err
+			}
+			if err := ioutil.WriteFile(root+name, []byte(data), 0644); err != nil {
+				return err
+			}
+			return nil
+		},
+	}
+	if samples > 0 {
+		// Apart from testdata/fuzz, where go test keeps the fuzz corpus
+		if err := writeSamples(grammar, root+"testdata/samples", samples, seed); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		s.Samples = "testdata/samples"
+	}
+	if generator == "railroad" {
+		err = parser.GenerateRailroad(grammar, s)
+	} else {
+		err = parser.GenerateParser(grammar, gen, s)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	} else if notest || gen == nil {
+		return 0
+	}
+	cmd := gen.TestCommand()
+	c := exec.Command(cmd[0], cmd[1:]...)
+	c.Dir = root
+	data, err := c.CombinedOutput()
+	os.Stderr.Write(data)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
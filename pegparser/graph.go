@@ -0,0 +1,146 @@
+/*
+Copyright (c) 2012-2013 Fredrik Ehnbom
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice, this
+   list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE LIABLE FOR
+ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+(INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+(INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/quarnster/parser"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// definitions returns the definitions of the grammar "root" in the
+// order they are written
+func definitions(root *parser.Node) (defs []*parser.Node) {
+	for _, node := range root.Children {
+		switch node.Name {
+		case "Definition":
+			defs = append(defs, node)
+		case "Lexical":
+			for _, child := range node.Children {
+				if child.Name == "Trivia" {
+					child = child.Children[0]
+				}
+				defs = append(defs, child)
+			}
+		}
+	}
+	return
+}
+
+// references calls "f" with the name of each definition the
+// expression "n" refers to
+func references(n *parser.Node, f func(string)) {
+	switch n.Name {
+	case "Primary", "Precedence":
+		if id := n.Children[0]; id.Name == "Identifier" {
+			f(id.Data())
+			return
+		}
+	case "Label", "BackReference", "Predicate":
+		return
+	}
+	for _, child := range n.Children {
+		references(child, f)
+	}
+}
+
+// dotGraph writes the graph of which definitions of the grammar "root"
+// refer to which in the dot format to "w"
+func dotGraph(w io.Writer, root *parser.Node, name string) {
+	fmt.Fprintf(w, "digraph %q {\n", name)
+	for _, def := range definitions(root) {
+		from := def.Children[0].Data()
+		fmt.Fprintf(w, "\t%q;\n", from)
+		seen := make(map[string]bool)
+		references(def.Children[len(def.Children)-1], func(to string) {
+			if !seen[to] {
+				seen[to] = true
+				fmt.Fprintf(w, "\t%q -> %q;\n", from, to)
+			}
+		})
+	}
+	fmt.Fprintln(w, "}")
+}
+
+// graph visualises the grammar as instructed by the command line
+// arguments "args", and returns the exit code
+func graph(args []string, w io.Writer) int {
+	var (
+		fs       = flag.NewFlagSet("graph", flag.ContinueOnError)
+		format   = fs.String("format", "dot", "Format of the graph: dot for the references between the definitions, or railroad for syntax diagrams")
+		outpath  = fs.String("outpath", "", "Destination directory of the railroad diagrams. By default it's the directory of the grammar with a _railroad suffix")
+		typename = fs.String("name", "", "Name of the graph. By default it'll be based on the name of the .peg-file")
+	)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), "usage: pegparser graph [flags] grammar.peg\n\nWrites the graph of which definitions refer to which in the dot format, or\nsyntax diagrams of the definitions as svg files with an index.html.\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	pegfile := fs.Arg(0)
+	root, err := loadGrammar(pegfile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if *typename == "" {
+		*typename = defaultName(pegfile)
+	}
+	switch *format {
+	case "dot":
+		dotGraph(w, root, *typename)
+	case "railroad":
+		dir := *outpath
+		if dir == "" {
+			dir = filepath.Dir(pegfile) + "_railroad"
+		}
+		s := parser.GeneratorSettings{
+			Name: *typename,
+			WriteFile: func(name, data string) error {
+				if err := os.MkdirAll(dir, 0755); err != nil {
+					return err
+				}
+				return ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644)
+			},
+		}
+		if err := parser.GenerateRailroad(root, s); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "unknown graph format %q\n", *format)
+		return 2
+	}
+	return 0
+}
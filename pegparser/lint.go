@@ -0,0 +1,68 @@
+/*
+Copyright (c) 2012-2013 Fredrik Ehnbom
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice, this
+   list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE LIABLE FOR
+ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+(INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+(INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/quarnster/parser"
+	"io"
+	"os"
+)
+
+// lint checks the grammars named by the command line arguments "args",
+// writing the problems found to "w", and returns the exit code
+func lint(args []string, w io.Writer) int {
+	var (
+		fs     = flag.NewFlagSet("lint", flag.ContinueOnError)
+		strict = fs.Bool("strict", false, "Exit with 1 on warnings too")
+	)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), "usage: pegparser lint [flags] grammar.peg...\n\nChecks the grammars for problems such as undefined references, left recursion\nand unused definitions, writing one line per problem. Exits with 1 if any of\nthem is an error.\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+	ret := 0
+	for _, fn := range fs.Args() {
+		root, err := loadGrammar(fn)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		for _, d := range parser.Lint(root) {
+			fmt.Fprintf(w, "%s:%s\n", fn, d)
+			if d.Severity == parser.SeverityError || *strict {
+				ret = 1
+			}
+		}
+	}
+	return ret
+}
@@ -22,153 +22,164 @@ ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
 (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
 SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
 */
-
 package main
 
 import (
 	"flag"
+	"fmt"
 	"github.com/quarnster/parser"
 	"github.com/quarnster/parser/peg"
 	"io/ioutil"
-	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 )
 
+const usage = `usage: pegparser <command> [flags]
+
+The commands are:
+
+	generate  generate a parser for a grammar and test it
+	parse     parse input with a grammar and print the tree
+	lint      check grammars for problems
+	fmt       print grammars in canonical form
+	graph     visualise a grammar
+	verify    check that the test inputs of a grammar parse
+	repl      parse input interactively with a grammar
+	trace     replay a trace of parsing input
+	lsp       run a language server for grammars
+
+Run "pegparser <command> -h" for the flags of a command. Without a
+command the flags are those of generate.
+
+The exit code is 0 on success, 1 if the command found a problem, such as
+a failing test, input that doesn't parse or a lint issue, and 2 if it
+couldn't run because of bad flags or unreadable files.
+`
+
+// interpreted is the part of the help of the commands that interpret
+// the grammar instead of generating a parser for it
+const interpreted = `The grammar is interpreted, which rejects the semantic predicates &{...} and
+!{...}, as only a generated parser can run their code.
+`
+
 func main() {
-	var (
-		pegfile    = ""
-		testfile   = ""
-		bench      = false
-		debug      = 0
-		dumptree   = false
-		notest     = false
-		heatmap    = false
-		ignore     = ""
-		generator  = "go"
-		outpath    = ""
-		outfile    = ""
-		typename   = ""
-		header     = "default"
-		gogenerate = false
-	)
-	flag.StringVar(&ignore, "ignore", ignore, "List of definitions to ignore (not generate nodes for)")
-	flag.StringVar(&pegfile, "peg", pegfile, "Pegfile for which to generate a parser for")
-	flag.StringVar(&testfile, "testfile", testfile, "Test file to be used in testing")
-	flag.StringVar(&outpath, "outpath", outpath, "Destination directory path")
-	flag.StringVar(&outfile, "outfile", outfile, "Destination file")
-	flag.BoolVar(&bench, "bench", bench, "Whether to run a benchmark test or not")
-	flag.IntVar(&debug, "debug", debug, "The desired debug level the generated parser will use")
-	flag.BoolVar(&dumptree, "dumptree", dumptree, "Whether to make the generated parser spit out the generated tree")
-	flag.BoolVar(&notest, "notest", notest, "Whether to test the generated parser")
-	flag.BoolVar(&heatmap, "heatmap", heatmap, "Whether to generate a heatmap or not")
-	flag.StringVar(&generator, "generator", generator, "Which generator to use")
-	flag.StringVar(&header, "header", header, "Header to put at the top of the generated source code")
-	flag.StringVar(&typename, "name", typename, "Name of the generated type/namespace/package. By default it'll be based on the name of the .peg-file")
-	flag.BoolVar(&gogenerate, "gogenerate", gogenerate, "Add a Go 1.4 \"//go:generate\" line to the generated code")
-	flag.Parse()
-	if pegfile == "" {
-		flag.Usage()
-		os.Exit(1)
+	args := os.Args[1:]
+	cmd := "generate"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cmd, args = args[0], args[1:]
+	}
+	switch cmd {
+	case "generate":
+		os.Exit(generate(args))
+	case "parse":
+		os.Exit(parse(args, os.Stdout))
+	case "lint":
+		os.Exit(lint(args, os.Stdout))
+	case "fmt":
+		os.Exit(format(args, os.Stdout))
+	case "graph":
+		os.Exit(graph(args, os.Stdout))
+	case "verify":
+		os.Exit(verify(args, os.Stdout))
+	case "repl":
+		os.Exit(repl(args, os.Stdin, os.Stdout))
+	case "trace":
+		os.Exit(replay(args, os.Stdout))
+	case "lsp":
+		os.Exit(serveLSP(args))
+	case "help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", cmd, usage)
+		os.Exit(2)
+	}
+}
+
+// loadGrammar parses the grammar in the file "fn"
+func loadGrammar(fn string) (*parser.Node, error) {
+	data, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return nil, err
+	}
+	var p peg.Peg
+	ok := p.Parse(string(data))
+	if e := p.Error(); !ok {
+		return nil, fmt.Errorf("%s:%d:%d: %s", fn, e.Line(), e.Column(), e.Description())
+	} else if back := p.RootNode().Children[len(p.RootNode().Children)-1]; back.Name != "EndOfFile" {
+		return nil, fmt.Errorf("%s:%d:%d: the grammar didn't finish parsing: %s", fn, e.Line(), e.Column(), e.Description())
+	}
+	return p.RootNode(), nil
+}
+
+// defaultName returns the name of the root node of the trees parsed
+// with the grammar in "pegfile" when there's no -name flag
+func defaultName(pegfile string) string {
+	name := filepath.Base(pegfile)
+	return strings.ToTitle(strings.TrimSuffix(name, filepath.Ext(name)))
+}
+
+// splitList splits the comma separated list "s"
+func splitList(s string) (ret []string) {
+	for _, i := range strings.Split(s, ",") {
+		if i = strings.TrimSpace(i); i != "" {
+			ret = append(ret, i)
+		}
+	}
+	return
+}
+
+// shapeFlags are the flags shaping the tree as it's built
+type shapeFlags struct {
+	lift, collapse, drop, rename *string
+}
+
+// addShapeFlags adds the flags shaping the tree to "fs"
+func addShapeFlags(fs *flag.FlagSet) shapeFlags {
+	return shapeFlags{
+		lift:     fs.String("lift", "", "List of definitions whose nodes are replaced by their children"),
+		collapse: fs.String("collapse", "", "List of definitions whose nodes are replaced by their child when they have exactly one"),
+		drop:     fs.String("drop", "", "List of definitions whose nodes are left out along with their children"),
+		rename:   fs.String("rename", "", "List of definition=name pairs naming the nodes of the definitions otherwise"),
+	}
+}
+
+// shapes returns the Shapes of the flags, nil if none are given
+func (f shapeFlags) shapes() (map[string]parser.Shape, error) {
+	shapes := make(map[string]parser.Shape)
+	set := func(list string, apply func(*parser.Shape)) {
+		for _, name := range splitList(list) {
+			shape := shapes[name]
+			apply(&shape)
+			shapes[name] = shape
+		}
 	}
-	p := peg.Peg{}
-	if data, err := ioutil.ReadFile(pegfile); err != nil {
-		log.Fatalf("%s", err)
-	} else {
-		if !p.Parse(string(data)) {
-			log.Fatalf("Didn't parse correctly\n")
-		} else {
-			back := p.RootNode().Children[len(p.RootNode().Children)-1]
-			if back.Name != "EndOfFile" {
-				log.Println(p.RootNode())
-				log.Println("File didn't finish parsing")
-			}
-			name := outfile
-			if name == "" {
-				name = filepath.Base(pegfile)
-				name = name[:len(name)-len(filepath.Ext(name))]
-			}
-
-			ignoreFunc := func(g parser.Generator, in string) string {
-				return g.Ignore(in)
-			}
-			var customActions []parser.CustomAction
-			for _, action := range strings.Split(ignore, ",") {
-				action = strings.TrimSpace(action)
-				customActions = append(customActions, parser.CustomAction{action, ignoreFunc})
-			}
-
-			var gen parser.Generator
-			switch generator {
-			case "go":
-				gen = &parser.GoGenerator{RootNode: p.RootNode()}
-			case "c":
-				gen = &parser.CGenerator{}
-			case "cpp":
-				gen = &parser.CPPGenerator{}
-			case "java":
-				gen = &parser.JavaGenerator{}
-			case "py":
-				gen = &parser.PyGenerator{}
-			default:
-				panic(generator)
-			}
-
-			//			gen.AddDebugLogging = debug
-			root := outpath
-			if root == "" {
-				root = filepath.Dir(pegfile)
-				if generator != "go" {
-					root += "_" + generator
-				}
-			}
-			root += "/"
-			gen.SetCustomActions(customActions)
-			if header == "default" {
-				header = ""
-				gogenerate = true
-			}
-			if gogenerate {
-				header += "//go:generate"
-				for _, a := range os.Args {
-					header += " \"" + strings.Replace(strings.Replace(a, "\n", "\\n", -1), "\"", "\\\"", -1) + `"`
-				}
-				header += "\n"
-			}
-			if typename == "" {
-				typename = filepath.Base(pegfile)
-				typename = strings.ToTitle(typename[:len(typename)-len(filepath.Ext(typename))])
-			}
-			s := parser.GeneratorSettings{
-				Header:     header,
-				Name:       typename,
-				Testname:   testfile,
-				FileName:   outfile,
-				Debug:      dumptree,
-				DebugLevel: parser.DebugLevel(debug),
-				Bench:      bench,
-				Heatmap:    heatmap,
-				WriteFile: func(name, data string) error {
-					if err := os.Mkdir(root, 0755); err != nil && !os.IsExist(err) {
-						return err
-					}
-					if err := ioutil.WriteFile(root+name, []byte(data), 0644); err != nil {
-						return err
-					}
-					return nil
-				},
-			}
-			if err := parser.GenerateParser(p.RootNode(), gen, s); err != nil {
-				log.Fatalln(err)
-			} else if !notest {
-				cmd := gen.TestCommand()
-				c := exec.Command(cmd[0], cmd[1:]...)
-				c.Dir = root
-				data, _ := c.CombinedOutput()
-				log.Println(string(data))
-			}
+	set(*f.lift, func(s *parser.Shape) { s.Lift = true })
+	set(*f.collapse, func(s *parser.Shape) { s.Collapse = true })
+	set(*f.drop, func(s *parser.Shape) { s.Drop = true })
+	for _, pair := range splitList(*f.rename) {
+		name, to, ok := strings.Cut(pair, "=")
+		if name, to = strings.TrimSpace(name), strings.TrimSpace(to); !ok || name == "" || to == "" {
+			return nil, fmt.Errorf("-rename expects definition=name pairs, not %q", pair)
 		}
+		shape := shapes[name]
+		shape.Rename = to
+		shapes[name] = shape
+	}
+	if len(shapes) == 0 {
+		return nil, nil
+	}
+	return shapes, nil
+}
+
+// interpreter returns an Interpreter for the grammar in "pegfile"
+func interpreter(pegfile, name, ignore string) (*parser.Interpreter, error) {
+	root, err := loadGrammar(pegfile)
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		name = defaultName(pegfile)
 	}
+	return parser.NewInterpreter(root, name, splitList(ignore))
 }
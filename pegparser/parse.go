@@ -0,0 +1,136 @@
+/*
+Copyright (c) 2012-2013 Fredrik Ehnbom
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice, this
+   list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE LIABLE FOR
+ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+(INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+(INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/quarnster/parser"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// parse parses an input with the grammar as instructed by the command
+// line arguments "args", writing the tree to "w", and returns the exit
+// code
+func parse(args []string, w io.Writer) int {
+	var (
+		fs       = flag.NewFlagSet("parse", flag.ContinueOnError)
+		ignore   = fs.String("ignore", "", "List of definitions to ignore (not generate nodes for)")
+		typename = fs.String("name", "", "Name of the root node. By default it'll be based on the name of the .peg-file. Overridden by a @type header")
+		rule     = fs.String("rule", "", "Definition to start parsing at instead of the first one")
+		format   = fs.String("format", "text", "Format to write the tree in: text, html or dot")
+		trace    = fs.String("trace", "", "File to write a JSON Lines trace of the parse to, which \"pegparser trace\" replays")
+		shape    = addShapeFlags(fs)
+	)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), "usage: pegparser parse [flags] grammar.peg [input]\n\nParses the input, or the standard input if there's none or it's \"-\", with the\ngrammar without generating a parser and writes the tree. Exits with 1 if the\ninput doesn't parse.\n\n"+interpreted+"\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		fs.Usage()
+		return 2
+	}
+	switch *format {
+	case "text", "html", "dot":
+	default:
+		fmt.Fprintf(os.Stderr, "unknown tree format %q\n", *format)
+		return 2
+	}
+	shapes, err := shape.shapes()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	in, err := interpreter(fs.Arg(0), *typename, *ignore)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	in.Shapes = shapes
+	var (
+		input = fs.Arg(1)
+		data  []byte
+	)
+	if input == "" || input == "-" {
+		input = "<stdin>"
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(input)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if *rule == "" {
+		*rule = in.Start()
+	}
+	var tracer *parser.JSONTracer
+	if *trace != "" {
+		f, err := os.Create(*trace)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		defer f.Close()
+		tracer = parser.NewJSONTracer(f)
+		in.Tracer = tracer
+	}
+	ok, err := in.ParseRule(*rule, string(data))
+	if err == nil && tracer != nil {
+		err = tracer.Err()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if end := in.ParserData.Pos(); ok && end != in.ParserData.Len() {
+		if in.LastError < end {
+			in.LastError = end
+		}
+		ok = false
+		e := in.Error()
+		fmt.Fprintf(os.Stderr, "%s:%d:%d: parsing didn't finish: %s\n", input, e.Line(), e.Column(), e.Description())
+	} else if !ok {
+		e := in.Error()
+		fmt.Fprintf(os.Stderr, "%s:%d:%d: %s\n", input, e.Line(), e.Column(), e.Description())
+	}
+	switch *format {
+	case "text":
+		fmt.Fprint(w, in.RootNode())
+	case "html":
+		fmt.Fprint(w, in.RootNode().HTML())
+	case "dot":
+		fmt.Fprint(w, in.RootNode().Dot())
+	}
+	if !ok {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,254 @@
+/*
+Copyright (c) 2012-2013 Fredrik Ehnbom
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice, this
+   list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE LIABLE FOR
+ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+(INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+(INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"github.com/quarnster/parser"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+)
+
+const replHelp = `Each line is parsed with the grammar, printing the tree or the error.
+The commands are:
+
+	:rule [name]   parse starting at the definition "name", or list them
+	:simplify      toggle simplifying the trees printed
+	:trace         toggle printing the definitions entered and exited
+	:load file     parse the contents of "file"
+	:reload        reload the grammar
+	:help          print this help
+	:quit          exit
+
+The grammar is reloaded whenever its file changes.
+`
+
+// session is the state of a repl
+type session struct {
+	out              io.Writer
+	pegfile          string
+	name, ignore     string
+	in               *parser.Interpreter
+	modified         time.Time
+	rule             string
+	simplify, traced bool
+}
+
+// load loads the grammar, keeping the rule to start at if it's
+// still defined
+func (s *session) load() error {
+	fi, err := os.Stat(s.pegfile)
+	if err != nil {
+		return err
+	}
+	in, err := interpreter(s.pegfile, s.name, s.ignore)
+	if err != nil {
+		return err
+	}
+	if s.rule != "" && !contains(in.Rules(), s.rule) {
+		fmt.Fprintf(s.out, "%s is no longer defined, starting at %s\n", s.rule, in.Start())
+		s.rule = ""
+	}
+	s.in, s.modified = in, fi.ModTime()
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, i := range list {
+		if i == s {
+			return true
+		}
+	}
+	return false
+}
+
+// reload loads the grammar again if its file has changed since
+func (s *session) reload() {
+	if fi, err := os.Stat(s.pegfile); err == nil && !fi.ModTime().Equal(s.modified) {
+		if err := s.load(); err != nil {
+			fmt.Fprintln(s.out, err)
+		} else {
+			fmt.Fprintf(s.out, "reloaded %s\n", s.pegfile)
+		}
+	}
+}
+
+// replTracer prints the definitions entered and exited, indented by
+// how deep into the definitions they are
+type replTracer struct {
+	out   io.Writer
+	in    *parser.Interpreter
+	depth int
+}
+
+func (t *replTracer) Trace(e parser.Event) {
+	switch e.Kind {
+	case parser.EventEnter:
+		line, column := t.in.ParserData.LineCol(e.Start)
+		fmt.Fprintf(t.out, "%senter %s at %d:%d\n", strings.Repeat("  ", t.depth), e.Name, line, column)
+		t.depth++
+	case parser.EventExit:
+		t.depth--
+		result := "failed"
+		if e.Accept {
+			result = "matched"
+		}
+		line, column := t.in.ParserData.LineCol(e.End)
+		fmt.Fprintf(t.out, "%sexit %s at %d:%d, %s\n", strings.Repeat("  ", t.depth), e.Name, line, column, result)
+	}
+}
+
+// parse parses "data" from "input", printing the tree or the error
+func (s *session) parse(input, data string) {
+	rule := s.rule
+	if rule == "" {
+		rule = s.in.Start()
+	}
+	s.in.Tracer = nil
+	if s.traced {
+		s.in.Tracer = &replTracer{out: s.out, in: s.in}
+	}
+	ok, err := s.in.ParseRule(rule, data)
+	if err != nil {
+		fmt.Fprintln(s.out, err)
+		return
+	}
+	root := s.in.RootNode()
+	if s.simplify {
+		root.Simplify()
+	}
+	fmt.Fprint(s.out, root)
+	e := s.in.Error()
+	if !ok {
+		fmt.Fprintf(s.out, "%s:%d:%d: %s\n", input, e.Line(), e.Column(), e.Description())
+	} else if end := s.in.ParserData.Pos(); end != s.in.ParserData.Len() {
+		if s.in.LastError < end {
+			s.in.LastError = end
+		}
+		e = s.in.Error()
+		fmt.Fprintf(s.out, "%s:%d:%d: parsing didn't finish: %s\n", input, e.Line(), e.Column(), e.Description())
+	}
+}
+
+// command runs the repl command "cmd", returning false if it's time to
+// exit
+func (s *session) command(cmd string) bool {
+	args := strings.Fields(cmd)
+	switch args[0] {
+	case ":rule":
+		if len(args) == 1 {
+			rule := s.rule
+			if rule == "" {
+				rule = s.in.Start()
+			}
+			fmt.Fprintf(s.out, "starting at %s of %s\n", rule, strings.Join(s.in.Rules(), ", "))
+		} else if !contains(s.in.Rules(), args[1]) {
+			fmt.Fprintf(s.out, "unknown definition %q\n", args[1])
+		} else {
+			s.rule = args[1]
+			fmt.Fprintf(s.out, "starting at %s\n", s.rule)
+		}
+	case ":simplify":
+		s.simplify = !s.simplify
+		fmt.Fprintln(s.out, "simplify", onOff(s.simplify))
+	case ":trace":
+		s.traced = !s.traced
+		fmt.Fprintln(s.out, "trace", onOff(s.traced))
+	case ":load":
+		if len(args) != 2 {
+			fmt.Fprintln(s.out, "usage: :load file")
+		} else if data, err := ioutil.ReadFile(args[1]); err != nil {
+			fmt.Fprintln(s.out, err)
+		} else {
+			s.parse(args[1], string(data))
+		}
+	case ":reload":
+		if err := s.load(); err != nil {
+			fmt.Fprintln(s.out, err)
+		} else {
+			fmt.Fprintf(s.out, "reloaded %s\n", s.pegfile)
+		}
+	case ":help":
+		fmt.Fprint(s.out, replHelp)
+	case ":quit":
+		return false
+	default:
+		fmt.Fprintf(s.out, "unknown command %s, see :help\n", args[0])
+	}
+	return true
+}
+
+func onOff(b bool) string {
+	if b {
+		return "on"
+	}
+	return "off"
+}
+
+// repl reads inputs and commands from "r" as instructed by the command
+// line arguments "args", writing the results to "w", and returns the
+// exit code
+func repl(args []string, r io.Reader, w io.Writer) int {
+	var (
+		fs       = flag.NewFlagSet("repl", flag.ContinueOnError)
+		ignore   = fs.String("ignore", "", "List of definitions to ignore (not generate nodes for)")
+		typename = fs.String("name", "", "Name of the root node. By default it'll be based on the name of the .peg-file. Overridden by a @type header")
+	)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), "usage: pegparser repl [flags] grammar.peg\n\n"+replHelp+"\n"+interpreted+"\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	s := &session{out: w, pegfile: fs.Arg(0), name: *typename, ignore: *ignore}
+	if err := s.load(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	scanner := bufio.NewScanner(r)
+	for fmt.Fprint(w, "> "); scanner.Scan(); fmt.Fprint(w, "> ") {
+		s.reload()
+		line := scanner.Text()
+		if strings.HasPrefix(line, ":") {
+			if !s.command(line) {
+				return 0
+			}
+		} else {
+			s.parse("<input>", line)
+		}
+	}
+	fmt.Fprintln(w)
+	return 0
+}
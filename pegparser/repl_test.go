@@ -0,0 +1,102 @@
+/*
+Copyright (c) 2012-2013 Fredrik Ehnbom
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice, this
+   list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE LIABLE FOR
+ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+(INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+(INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRepl(t *testing.T) {
+	dir, err := ioutil.TempDir("", "repl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	pegfile := filepath.Join(dir, "list.peg")
+	input := filepath.Join(dir, "input")
+	if err := ioutil.WriteFile(pegfile, []byte("List <- Item (',' Item)* !.\nItem <- [a-z]+\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(input, []byte("x,y"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, w := io.Pipe()
+	go func() {
+		for _, line := range []string{"a,b", ":simplify", "a", ":trace", "a", ":trace", ":rule Item", "a,b", ":rule Nope", ":load " + input, "!", "<reload>", "a;b", ":rule", ":quit", "ignored"} {
+			if line == "<reload>" {
+				ioutil.WriteFile(pegfile, []byte("List <- Item (';' Item)* !.\nItem <- [a-z]+\n"), 0644)
+				// Make sure the modification time differs
+				later := time.Now().Add(time.Minute)
+				os.Chtimes(pegfile, later, later)
+				continue
+			}
+			io.WriteString(w, line+"\n")
+		}
+		w.Close()
+	}()
+	var buf bytes.Buffer
+	if ret := repl([]string{pegfile}, r, &buf); ret != 0 {
+		t.Errorf("Expected exit code 0, not %d", ret)
+	}
+	exp := strings.Join([]string{
+		`> 0-3: "LIST"`,
+		`	0-3: "List"`,
+		`		0-1: "Item" - Data: "a"`,
+		`		2-3: "Item" - Data: "b"`,
+		`> simplify on`,
+		`> 0-1: "Item" - Data: "a"`,
+		`> trace on`,
+		`> enter List at 1:1`,
+		`  enter Item at 1:1`,
+		`  exit Item at 1:2, matched`,
+		`exit List at 1:2, matched`,
+		`0-1: "Item" - Data: "a"`,
+		`> trace off`,
+		`> starting at Item`,
+		`> 0-1: "Item" - Data: "a"`,
+		`<input>:1:2: parsing didn't finish: Unexpected ,`,
+		`> unknown definition "Nope"`,
+		`> 0-1: "Item" - Data: "x"`,
+		input + `:1:2: parsing didn't finish: Unexpected ,`,
+		`> 0-0: "LIST" - Data: ""`,
+		`<input>:1:1: Unexpected !`,
+		`> reloaded ` + pegfile,
+		`0-1: "Item" - Data: "a"`,
+		`<input>:1:2: parsing didn't finish: Unexpected ;`,
+		`> starting at Item of List, Item`,
+		`> `,
+	}, "\n")
+	if buf.String() != exp {
+		t.Errorf("Expected:\n%s\nGot:\n%s", exp, buf.String())
+	}
+}
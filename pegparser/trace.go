@@ -0,0 +1,134 @@
+/*
+Copyright (c) 2012-2013 Fredrik Ehnbom
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice, this
+   list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE LIABLE FOR
+ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+(INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+(INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/quarnster/parser"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// excerptLength is how many runes of the input an event shows at most
+const excerptLength = 30
+
+// replay replays the trace and input named by the command line
+// arguments "args", writing each event with where in the input it
+// happened and what it matched to "w", and returns the exit code
+func replay(args []string, w io.Writer) int {
+	var (
+		fs    = flag.NewFlagSet("trace", flag.ContinueOnError)
+		depth = fs.Int("depth", 0, "How many definitions deep to show events, 0 for all of them")
+	)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), "usage: pegparser trace [flags] trace.jsonl input\n\nReplays a JSON Lines trace, such as the one \"pegparser parse -trace\" writes,\nagainst the input that was parsed, showing each event with its line and\ncolumn and the text it's about.\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return 2
+	}
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	defer f.Close()
+	events, err := parser.ReadTrace(f)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", fs.Arg(0), err)
+		return 2
+	}
+	data, err := ioutil.ReadFile(fs.Arg(1))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	r := parser.NewReader(string(data))
+	at := func(pos int) string {
+		if pos < 0 || pos > r.Len() {
+			return fmt.Sprintf("offset %d, past the end of the input", pos)
+		}
+		line, column := r.LineCol(pos)
+		return fmt.Sprintf("%d:%d", line, column)
+	}
+	text := func(start, end int) string {
+		if start < 0 || end > r.Len() || start > end {
+			return "?"
+		}
+		return excerpt(r.Substring(start, end))
+	}
+	level := 0
+	for _, e := range events {
+		if e.Kind == parser.EventExit && level > 0 {
+			level--
+		}
+		if *depth == 0 || level < *depth {
+			var desc string
+			switch e.Kind {
+			case parser.EventEnter:
+				desc = fmt.Sprintf("enter %s at %s", e.Name, at(e.Start))
+			case parser.EventExit:
+				if e.Accept {
+					desc = fmt.Sprintf("exit %s at %s, matched %s", e.Name, at(e.End), text(e.Start, e.End))
+				} else {
+					desc = fmt.Sprintf("exit %s at %s, failed", e.Name, at(e.End))
+				}
+			case parser.EventMismatch:
+				found := "end of input"
+				if e.Start >= 0 && e.Start < r.Len() {
+					_, size := utf8.DecodeRuneInString(r.Substring(e.Start, r.Len()))
+					found = text(e.Start, e.Start+size)
+				}
+				desc = fmt.Sprintf("mismatch %s at %s, found %s", e.Name, at(e.Start), found)
+			case parser.EventBacktrack:
+				desc = fmt.Sprintf("backtrack %s from %s to %s, giving up %s", e.Name, at(e.End), at(e.Start), text(e.Start, e.End))
+			default:
+				desc = e.String()
+			}
+			fmt.Fprintf(w, "%s%s\n", strings.Repeat("  ", level), desc)
+		}
+		if e.Kind == parser.EventEnter {
+			level++
+		}
+	}
+	return 0
+}
+
+// excerpt quotes "s", shortening it to excerptLength runes
+func excerpt(s string) string {
+	if rs := []rune(s); len(rs) > excerptLength {
+		return strconv.Quote(string(rs[:excerptLength])) + "..."
+	}
+	return strconv.Quote(s)
+}
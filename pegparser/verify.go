@@ -0,0 +1,149 @@
+/*
+Copyright (c) 2012-2013 Fredrik Ehnbom
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice, this
+   list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE LIABLE FOR
+ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+(INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+(INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/quarnster/parser"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// result is the outcome of verifying one input
+type result struct {
+	Input string `json:"input"`
+	Pass  bool   `json:"pass"`
+	// Where parsing failed, if it did
+	Line   int    `json:"line,omitempty"`
+	Column int    `json:"column,omitempty"`
+	Offset *int   `json:"offset,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+func (r result) String() string {
+	if r.Pass {
+		return "PASS " + r.Input
+	} else if r.Offset == nil {
+		return fmt.Sprintf("FAIL %s: %s", r.Input, r.Error)
+	}
+	return fmt.Sprintf("FAIL %s:%d:%d (offset %d): %s", r.Input, r.Line, r.Column, *r.Offset, r.Error)
+}
+
+// verifyInput parses the input in the file "fn" with "in", comparing
+// the tree with the one in the file of the same name with an .out
+// extension if there is one
+func verifyInput(in *parser.Interpreter, fn string) result {
+	r := result{Input: fn}
+	data, err := ioutil.ReadFile(fn)
+	if err != nil {
+		r.Error = err.Error()
+		return r
+	}
+	fail := func(offset int, msg string) result {
+		in.LastError = offset
+		e := in.Error()
+		r.Line, r.Column, r.Offset, r.Error = e.Line(), e.Column(), &offset, msg+e.Description()
+		return r
+	}
+	if !in.Parse(string(data)) {
+		return fail(in.LastError, "")
+	}
+	if end := in.ParserData.Pos(); end != in.ParserData.Len() {
+		if in.LastError > end {
+			end = in.LastError
+		}
+		return fail(end, "parsing didn't finish: ")
+	}
+	out := strings.TrimSuffix(fn, filepath.Ext(fn)) + ".out"
+	if exp, err := ioutil.ReadFile(out); err == nil && string(exp) != in.RootNode().String() {
+		r.Error = "the tree differs from " + out
+		return r
+	}
+	r.Pass = true
+	return r
+}
+
+// verify interprets the grammar over the test inputs, writing a line
+// per input to "w", and returns the exit code
+func verify(args []string, w io.Writer) int {
+	var (
+		fs       = flag.NewFlagSet("verify", flag.ContinueOnError)
+		pegfile  = fs.String("peg", "", "Pegfile of the grammar to verify")
+		testfile = fs.String("testfile", "testdata/*.in", "Glob, relative to the pegfile, of the inputs to parse. Those with a file of the same name but with an .out extension must parse into the tree in it")
+		ignore   = fs.String("ignore", "", "List of definitions to ignore (not generate nodes for)")
+		typename = fs.String("name", "", "Name of the root node. By default it'll be based on the name of the .peg-file. Overridden by a @type header")
+		jsonOut  = fs.Bool("json", false, "Write the results as JSON Lines")
+	)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: pegparser verify -peg file.peg [flags]\n\nParses the test inputs with the grammar without generating a parser, printing\nwhether each passes and where the failing ones failed. Exits with 1 if any fail.\n\n"+interpreted+"\nFlags:")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *pegfile == "" {
+		fs.Usage()
+		return 2
+	}
+	in, err := interpreter(*pegfile, *typename, *ignore)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	files, err := filepath.Glob(filepath.Join(filepath.Dir(*pegfile), *testfile))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	} else if len(files) == 0 {
+		fmt.Fprintf(os.Stderr, "No test inputs match %s\n", *testfile)
+		return 2
+	}
+
+	enc := json.NewEncoder(w)
+	failed := 0
+	for _, fn := range files {
+		r := verifyInput(in, fn)
+		if !r.Pass {
+			failed++
+		}
+		if *jsonOut {
+			enc.Encode(r)
+		} else {
+			fmt.Fprintln(w, r)
+		}
+	}
+	if !*jsonOut {
+		fmt.Fprintf(w, "%d passed, %d failed\n", len(files)-failed, failed)
+	}
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
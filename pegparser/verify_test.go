@@ -0,0 +1,90 @@
+/*
+Copyright (c) 2012-2013 Fredrik Ehnbom
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice, this
+   list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE LIABLE FOR
+ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+(INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+(INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "verify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, data := range map[string]string{
+		"list.peg":          "List <- Item (',' Item)* !.\nItem <- [a-z]+\n",
+		"testdata/ok.in":    "a,bc",
+		"testdata/ok.out":   "0-4: \"LIST\"\n\t0-4: \"List\"\n\t\t0-1: \"Item\" - Data: \"a\"\n\t\t2-4: \"Item\" - Data: \"bc\"\n",
+		"testdata/bad.in":   "a,,b",
+		"testdata/first.in": ",a",
+		"testdata/tree.in":  "a",
+		"testdata/tree.out": "0-1: \"LIST\"\n",
+	} {
+		fn := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(fn), 0755)
+		if err := ioutil.WriteFile(fn, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if ret := verify([]string{"-peg", filepath.Join(dir, "list.peg")}, &buf); ret != 1 {
+		t.Errorf("Expected exit code 1, not %d", ret)
+	}
+	for _, exp := range []string{
+		"FAIL " + filepath.Join(dir, "testdata/bad.in") + ":1:3 (offset 2): Unexpected ,",
+		"PASS " + filepath.Join(dir, "testdata/ok.in"),
+		"FAIL " + filepath.Join(dir, "testdata/tree.in") + ": the tree differs from " + filepath.Join(dir, "testdata/tree.out"),
+		"FAIL " + filepath.Join(dir, "testdata/first.in") + ":1:1 (offset 0): Unexpected ,",
+		"1 passed, 3 failed",
+	} {
+		if !strings.Contains(buf.String(), exp) {
+			t.Errorf("Expected %q in:\n%s", exp, buf.String())
+		}
+	}
+
+	buf.Reset()
+	if ret := verify([]string{"-json", "-peg", filepath.Join(dir, "list.peg"), "-testfile", "testdata/ok.in"}, &buf); ret != 0 {
+		t.Errorf("Expected exit code 0, not %d", ret)
+	}
+	if exp := `{"input":"` + filepath.Join(dir, "testdata/ok.in") + `","pass":true}` + "\n"; buf.String() != exp {
+		t.Errorf("Expected %q, not %q", exp, buf.String())
+	}
+
+	// Failing at the very start still has an offset
+	buf.Reset()
+	if ret := verify([]string{"-json", "-peg", filepath.Join(dir, "list.peg"), "-testfile", "testdata/first.in"}, &buf); ret != 1 {
+		t.Errorf("Expected exit code 1, not %d", ret)
+	}
+	if exp := `{"input":"` + filepath.Join(dir, "testdata/first.in") + `","pass":false,"line":1,"column":1,"offset":0,"error":"Unexpected ,"}` + "\n"; buf.String() != exp {
+		t.Errorf("Expected %q, not %q", exp, buf.String())
+	}
+}
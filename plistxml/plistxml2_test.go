@@ -0,0 +1,50 @@
+package plistxml
+
+import (
+	"testing"
+)
+
+const (
+	plistHeader = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">`
+	plistFooter = `</plist>
+`
+)
+
+func TestTagPairs(t *testing.T) {
+	valid := map[string]string{
+		`<dict><key>a</key><string>b</string><key>c</key><array><string>d</string></array></dict>`: `0-260: "PLISTXML"
+	163-251: "Dictionary"
+		174-175: "Key" - Data: "a"
+		189-190: "String" - Data: "b"
+		204-205: "Key" - Data: "c"
+		211-244: "Array"
+			226-227: "String" - Data: "d"
+	260-260: "EndOfFile" - Data: ""
+`,
+	}
+	for k, v := range valid {
+		var p PLISTXML
+		if !p.Parse(plistHeader + k + plistFooter) {
+			t.Errorf("Didn't parse correctly: %s\n%s", k, p.Error())
+		} else if root := p.RootNode(); root.Children[len(root.Children)-1].Name != "EndOfFile" {
+			t.Errorf("Parsing didn't finish: %s\n%s", k, p.Error())
+		} else if root.String() != v {
+			t.Errorf("Test %s failed\nExpected: %s\nReceived, %s", k, v, root)
+		}
+	}
+
+	invalid := []string{
+		`<string>a</key>`,
+		`<array></dict>`,
+		`<dict><key>a</string><string>b</string></dict>`,
+		`<array><string>a</string></array></array>`,
+	}
+	for _, k := range invalid {
+		var p PLISTXML
+		if p.Parse(plistHeader+k+plistFooter) && p.RootNode().Children[len(p.RootNode().Children)-1].Name == "EndOfFile" {
+			t.Errorf("Succeeded, but shouldn't have: %s", k)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+/*
+Copyright (c) 2012-2013 Fredrik Ehnbom
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice, this
+   list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE LIABLE FOR
+ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+(INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+(INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+package parser
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// The conversions between byte offsets, rune offsets and lines and
+// columns that the Readers share. See Reader for what they mean.
+
+// clamp returns "offset" within the data
+func clamp(data string, offset int) int {
+	if offset < 0 {
+		return 0
+	} else if offset > len(data) {
+		return len(data)
+	}
+	return offset
+}
+
+func runeOffset(data string, offset int) int {
+	return utf8.RuneCountInString(data[:clamp(data, offset)])
+}
+
+func byteOffset(data string, runes int) int {
+	offset := 0
+	for ; runes > 0 && offset < len(data); runes-- {
+		_, size := utf8.DecodeRuneInString(data[offset:])
+		offset += size
+	}
+	return offset
+}
+
+// width returns how many columns "r" takes up, counting UTF-16 code
+// units rather than runes if asked to
+func width(r rune, utf16 bool) int {
+	if utf16 && r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
+
+func lineCol(data string, offset int, utf16 bool) (line, column int) {
+	data = data[:clamp(data, offset)]
+	line = strings.Count(data, "\n") + 1
+	column = 1
+	for _, r := range data[strings.LastIndexByte(data, '\n')+1:] {
+		column += width(r, utf16)
+	}
+	return
+}
+
+func offset(data string, line, column int, utf16 bool) int {
+	offset := 0
+	for ; line > 1; line-- {
+		i := strings.IndexByte(data[offset:], '\n')
+		if i == -1 {
+			return len(data)
+		}
+		offset += i + 1
+	}
+	for column--; column > 0 && offset < len(data) && data[offset] != '\n'; {
+		r, size := utf8.DecodeRuneInString(data[offset:])
+		if column -= width(r, utf16); column < 0 {
+			// Within a surrogate pair
+			break
+		}
+		offset += size
+	}
+	return offset
+}
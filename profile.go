@@ -0,0 +1,275 @@
+/*
+Copyright (c) 2012-2013 Fredrik Ehnbom
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice, this
+   list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE LIABLE FOR
+ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+(INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+(INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+package parser
+
+import (
+	"compress/gzip"
+	"io"
+	"time"
+)
+
+type (
+	// Profiler records where a parser spends its time, and how often it
+	// enters a definition again at a position it already entered it at,
+	// which is the work backtracking wastes. It's written as a pprof
+	// profile in which the definitions are the functions, so "go tool
+	// pprof" can show it. Parsers generated with profiling enabled
+	// record to their Profile, calling Begin for each parse. A Profiler
+	// records one parse at a time.
+	Profiler struct {
+		// The file of the grammar the functions are in
+		Filename  string
+		Functions []ProfileFunction
+
+		nodes []profileNode
+		stack []profileFrame
+		seen  map[profileKey]bool
+		start time.Time
+		last  time.Time
+	}
+
+	// ProfileFunction is a definition of the profiled grammar
+	ProfileFunction struct {
+		Name string
+		// Line in the grammar the definition starts at
+		Line int
+	}
+
+	// profileNode is a call stack of definitions, the definitions of
+	// its parents calling its function
+	profileNode struct {
+		parent, function int
+		children         map[int]int
+		// The values of the node's sample
+		calls, reentries, time, wasted int64
+	}
+
+	// profileFrame is a definition being parsed
+	profileFrame struct {
+		node int
+		// Whether it, or a definition calling it, was entered at a
+		// position it had already been entered at
+		wasted bool
+	}
+
+	profileKey struct {
+		function, pos int
+	}
+)
+
+// NewProfiler returns a Profiler for the definitions "functions" of
+// the grammar in the file "filename"
+func NewProfiler(filename string, functions []ProfileFunction) *Profiler {
+	return &Profiler{Filename: filename, Functions: functions}
+}
+
+// Begin starts recording the parse of new data, so the positions of
+// the last one don't count as entered again
+func (p *Profiler) Begin() {
+	p.stack = p.stack[:0]
+	p.seen = make(map[profileKey]bool)
+}
+
+// charge charges the time since the last event to the definition
+// being parsed
+func (p *Profiler) charge(now time.Time) {
+	if p.start.IsZero() {
+		p.start = now
+	}
+	if len(p.stack) > 0 {
+		d := int64(now.Sub(p.last))
+		f := p.stack[len(p.stack)-1]
+		p.nodes[f.node].time += d
+		if f.wasted {
+			p.nodes[f.node].wasted += d
+		}
+	}
+	p.last = now
+}
+
+// Enter records entering the definition at index "function" of
+// Functions at "pos", and returns the frame to pass to Exit
+func (p *Profiler) Enter(function, pos int) int {
+	p.charge(time.Now())
+	if len(p.nodes) == 0 {
+		p.nodes = append(p.nodes, profileNode{function: -1})
+	}
+	if p.seen == nil {
+		p.seen = make(map[profileKey]bool)
+	}
+	parent, wasted := 0, false
+	if len(p.stack) > 0 {
+		f := p.stack[len(p.stack)-1]
+		parent, wasted = f.node, f.wasted
+	}
+	if p.nodes[parent].children == nil {
+		p.nodes[parent].children = make(map[int]int)
+	}
+	n, ok := p.nodes[parent].children[function]
+	if !ok {
+		n = len(p.nodes)
+		p.nodes[parent].children[function] = n
+		p.nodes = append(p.nodes, profileNode{parent: parent, function: function})
+	}
+	p.nodes[n].calls++
+	if key := (profileKey{function, pos}); p.seen[key] {
+		p.nodes[n].reentries++
+		wasted = true
+	} else {
+		p.seen[key] = true
+	}
+	p.stack = append(p.stack, profileFrame{n, wasted})
+	return len(p.stack) - 1
+}
+
+// Exit records exiting the definition Enter returned "frame" for. The
+// definitions it called but didn't exit, because of a panic, are
+// exited with it.
+func (p *Profiler) Exit(frame int) {
+	p.charge(time.Now())
+	if frame < len(p.stack) {
+		p.stack = p.stack[:frame]
+	}
+}
+
+// Reset forgets everything recorded so far
+func (p *Profiler) Reset() {
+	p.nodes, p.stack, p.seen = nil, nil, nil
+	p.start, p.last = time.Time{}, time.Time{}
+}
+
+// WriteProfile writes what has been recorded as a gzipped pprof
+// profile.proto. Each sample is a call stack of definitions, with
+// the number of calls, the number of calls at a position the
+// definition had already been entered at, the time spent in the
+// definition itself and how much of it was spent in such calls.
+func (p *Profiler) WriteProfile(w io.Writer) error {
+	var (
+		pb    protobuf
+		index = map[string]int64{"": 0}
+		table = []string{""}
+	)
+	str := func(s string) int64 {
+		if i, ok := index[s]; ok {
+			return i
+		}
+		index[s] = int64(len(table))
+		table = append(table, s)
+		return int64(len(table) - 1)
+	}
+	for _, t := range [][2]string{{"calls", "count"}, {"reentries", "count"}, {"time", "nanoseconds"}, {"wasted", "nanoseconds"}} {
+		var vt protobuf
+		vt.int(1, str(t[0]))
+		vt.int(2, str(t[1]))
+		pb.message(1, vt)
+	}
+	for i, n := range p.nodes {
+		if i == 0 {
+			continue
+		}
+		var (
+			s   protobuf
+			ids []int64
+		)
+		for ; n.function >= 0; n = p.nodes[n.parent] {
+			ids = append(ids, int64(n.function)+1)
+		}
+		n = p.nodes[i]
+		s.packed(1, ids...)
+		s.packed(2, n.calls, n.reentries, n.time, n.wasted)
+		pb.message(2, s)
+	}
+	// Each definition has a location and function of its own, with the
+	// same id
+	for i, f := range p.Functions {
+		var loc, line, fn protobuf
+		line.int(1, int64(i)+1)
+		line.int(2, int64(f.Line))
+		loc.int(1, int64(i)+1)
+		loc.message(4, line)
+		pb.message(4, loc)
+		fn.int(1, int64(i)+1)
+		fn.int(2, str(f.Name))
+		fn.int(3, str(f.Name))
+		fn.int(4, str(p.Filename))
+		fn.int(5, int64(f.Line))
+		pb.message(5, fn)
+	}
+	def := str("time")
+	for _, s := range table {
+		pb.bytes(6, []byte(s))
+	}
+	if !p.start.IsZero() {
+		pb.int(9, p.start.UnixNano())
+		pb.int(10, int64(p.last.Sub(p.start)))
+	}
+	pb.int(14, def)
+
+	gz := gzip.NewWriter(w)
+	if _, err := gz.Write(pb); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// protobuf is an encoded protocol buffer message
+type protobuf []byte
+
+func (pb *protobuf) varint(v uint64) {
+	for v >= 0x80 {
+		*pb = append(*pb, byte(v)|0x80)
+		v >>= 7
+	}
+	*pb = append(*pb, byte(v))
+}
+
+// int encodes the varint field "field", leaving it out when zero
+func (pb *protobuf) int(field int, v int64) {
+	if v == 0 {
+		return
+	}
+	pb.varint(uint64(field) << 3)
+	pb.varint(uint64(v))
+}
+
+// bytes encodes the length delimited field "field"
+func (pb *protobuf) bytes(field int, data []byte) {
+	pb.varint(uint64(field)<<3 | 2)
+	pb.varint(uint64(len(data)))
+	*pb = append(*pb, data...)
+}
+
+func (pb *protobuf) message(field int, m protobuf) {
+	pb.bytes(field, m)
+}
+
+// packed encodes the repeated varint field "field"
+func (pb *protobuf) packed(field int, values ...int64) {
+	var data protobuf
+	for _, v := range values {
+		data.varint(uint64(v))
+	}
+	pb.bytes(field, data)
+}
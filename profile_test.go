@@ -0,0 +1,79 @@
+/*
+Copyright (c) 2012-2013 Fredrik Ehnbom
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice, this
+   list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE LIABLE FOR
+ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+(INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+(INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+package parser
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+func TestProfiler(t *testing.T) {
+	p := NewProfiler("list.peg", []ProfileFunction{{"List", 1}, {"Item", 2}})
+	p.Begin()
+	list := p.Enter(0, 0)
+	item := p.Enter(1, 0)
+	// Left without exiting, as when a cut panics
+	p.Enter(1, 1)
+	p.Exit(item)
+	// Entered again at the same position
+	p.Exit(p.Enter(1, 0))
+	p.Exit(list)
+
+	dir, err := ioutil.TempDir("", "profile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fn := filepath.Join(dir, "profile.pb.gz")
+	f, err := os.Create(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.WriteProfile(f); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	out, err := exec.Command("go", "tool", "pprof", "-raw", fn).CombinedOutput()
+	if err != nil {
+		t.Skip("Unable to run go tool pprof:", err, string(out))
+	}
+	for _, exp := range []string{
+		`calls/count reentries/count time/nanoseconds\[dflt\] wasted/nanoseconds`,
+		`\n +1 +0 +\d+ +0: 1 \n`,
+		`\n +2 +1 +\d+ +\d+: 2 1 \n`,
+		`\n +1 +0 +\d+ +0: 2 2 1 \n`,
+		`1: 0x0 M=1 List list.peg:1`,
+		`2: 0x0 M=1 Item list.peg:2`,
+	} {
+		if !regexp.MustCompile(exp).Match(out) {
+			t.Errorf("Expected %q in the profile:\n%s", exp, out)
+		}
+	}
+}
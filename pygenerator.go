@@ -32,10 +32,15 @@ import (
 )
 
 type PyGenerator struct {
-	s                     GeneratorSettings
-	output                string
-	CustomActions         []CustomAction
-	havefunctions         bool
+	s             GeneratorSettings
+	output        string
+	CustomActions []CustomAction
+	havefunctions bool
+	realParseAt   int
+	startName     string
+	// Whether the definition being generated has a cut inside a
+	// choice, repetition or predicate
+	cut                   bool
 	currentFunctions      string
 	currentFunctionsCount int
 	currentName           string
@@ -84,11 +89,16 @@ func (g *PyGenerator) MakeParserFunction(node *Node) error {
 	exp := node.Children[len(node.Children)-1]
 	defName := helper(g, id)
 	g.currentName = defName
+	g.cut = hasScopedCut(exp, false)
 	data := helper(g, exp)
 
 	if !g.havefunctions {
 		g.havefunctions = true
-		g.output += "\tdef realParse(p):\n\t\treturn p.p_" + defName + "()\n\n"
+		g.realParseAt = len(g.output)
+		g.startName = g.s.Start
+		if g.startName == "" {
+			g.startName = defName
+		}
 	}
 
 	indenter := CodeFormatter{}
@@ -113,6 +123,9 @@ func (g *PyGenerator) MakeParserFunction(node *Node) error {
 		if data[len(data)-1] != '\n' {
 			end = "\n" + end
 		}
+		if g.cut {
+			indenter.Add("cut = False\n")
+		}
 		indenter.Add("accept = False\n" + data + end)
 	} else {
 		indenter.Add("return " + data + "\n")
@@ -227,26 +240,49 @@ if accept:
 
 func (g *PyGenerator) AssertNot(a string) string {
 	return `s = p.ParserData.Pos
-` + g.Call(a) + `
+` + g.Call(a) + g.uncut() + `
 p.ParserData.Pos = s
 accept = not accept`
 }
 
 func (g *PyGenerator) AssertAnd(a string) string {
 	return `s = p.ParserData.Pos
-` + g.Call(a) + `
+` + g.Call(a) + g.uncut() + `
 p.ParserData.Pos = s`
 }
 
+func (g *PyGenerator) Capture(name, a string) string {
+	panic(&UnsupportedError{Feature: "captures"})
+}
+
+func (g *PyGenerator) BackReference(name string) string {
+	panic(&UnsupportedError{Feature: "back-references"})
+}
+
+func (g *PyGenerator) SemanticAnd(code string) string {
+	panic(&UnsupportedError{Feature: "semantic predicates"})
+}
+
+func (g *PyGenerator) SemanticNot(code string) string {
+	panic(&UnsupportedError{Feature: "semantic predicates"})
+}
+
+func (g *PyGenerator) Precedence(operand string, levels []PrecedenceLevel) string {
+	panic(&UnsupportedError{Feature: "operator precedence"})
+}
+
 func (g *PyGenerator) ZeroOrMore(a string) string {
 	var cf CodeFormatter
+	if g.cut {
+		cf.Add("save = p.ParserData.Pos\n")
+	}
 	cf.Add("accept = True")
 	cf.Add("\nwhile accept:\n")
 	cf.Inc()
 	cf.Add(g.Call(a))
 	cf.Dec()
 	cf.Add("\n")
-	cf.Add("accept = True\n")
+	cf.Add(g.endRepetition())
 	return cf.String()
 }
 
@@ -254,7 +290,7 @@ func (g *PyGenerator) OneOrMore(a string) string {
 	var cf CodeFormatter
 	cf.Add(`save = p.ParserData.Pos
 ` + g.Call(a) + `
-if not accept:
+if not accept:` + strings.Replace(g.uncut(), "\n", "\n\t", -1) + `
 	p.ParserData.Pos = save
 else:
 	while accept:
@@ -263,24 +299,59 @@ else:
 	cf.Inc()
 	cf.Add(g.Call(a) + "\n")
 	cf.Dec()
-	cf.Add(`
-accept = True
-`)
+	cf.Add("\n" + g.endRepetition())
 	return cf.String()
 }
 
 func (g *PyGenerator) Maybe(a string) string {
+	if g.cut {
+		return g.Call(a) + "\naccept = not cut\ncut = False"
+	}
 	return g.Call(a) + "\naccept = True"
 }
 
+// uncut returns the code resetting the cut variable after an
+// expression of a predicate
+func (g *PyGenerator) uncut() string {
+	if g.cut {
+		return "\ncut = False"
+	}
+	return ""
+}
+
+// endRepetition returns the code ending a repetition starting at
+// "save", failing it if it stopped matching after a cut
+func (g *PyGenerator) endRepetition() string {
+	if g.cut {
+		return `if cut:
+	cut = False
+	p.ParserData.Pos = save
+else:
+	accept = True
+`
+	}
+	return "accept = True\n"
+}
+
 type pyNeedAllGroup struct {
 	cf    CodeFormatter
-	g     Generator
+	g     *PyGenerator
 	stack list.List
 	label string
+	cut   bool
 }
 
 func (b *pyNeedAllGroup) Add(value, name string) {
+	if b.cut && b.g.cut {
+		b.cf.Add(b.g.Call(value) + `
+if not accept:
+	cut = True
+else:
+`)
+		b.cf.Inc()
+		b.stack.PushBack(name)
+		return
+	}
 	b.cf.Add(b.g.Call(value) + `
 if accept:
 `)
@@ -288,16 +359,29 @@ if accept:
 	b.stack.PushBack(name)
 }
 
+func (b *pyNeedAllGroup) Cut() {
+	b.cut = true
+}
+
 type pyNeedOneGroup struct {
 	cf CodeFormatter
-	g  Generator
+	g  *PyGenerator
 }
 
 func (b *pyNeedOneGroup) Add(value, name string) {
+	if b.g.cut {
+		b.cf.Add(b.g.Call(value) + "\nif not accept and not cut:\n")
+		b.cf.Inc()
+		return
+	}
 	b.cf.Add(b.g.Call(value) + "\nif not accept:\n")
 	b.cf.Inc()
 }
 
+func (b *pyNeedOneGroup) Cut() {
+	panic("Shouldn't reach this")
+}
+
 func (g *PyGenerator) BeginGroup(requireAll bool) Group {
 	if requireAll {
 		r := pyNeedAllGroup{g: g}
@@ -337,7 +421,7 @@ func (g *PyGenerator) EndGroup(gr Group) string {
 		for len(t.cf.Level()) > 1 {
 			t.cf.Dec()
 		}
-		t.cf.Add("if not accept:\n\tp.ParserData.Pos = save\n\n")
+		t.cf.Add("if not accept:" + strings.Replace(g.uncut(), "\n", "\n\t", -1) + "\n\tp.ParserData.Pos = save\n\n")
 		return t.cf.String()
 	}
 	panic(gr)
@@ -359,6 +443,9 @@ func (g *PyGenerator) Call(value string) string {
 
 func (g *PyGenerator) Begin(s GeneratorSettings) error {
 	g.s = s
+	if len(s.Tokens) > 0 {
+		panic(&UnsupportedError{Feature: "lexical sections"})
+	}
 
 	g.output = g.s.Header + `
 class Range:
@@ -464,7 +551,16 @@ class ` + g.s.Name + `:
 	return nil
 }
 
+// realParse returns the method that kicks off parsing at the start
+// definition.
+func (g *PyGenerator) realParse() string {
+	return "\tdef realParse(p):\n\t\treturn p.p_" + g.startName + "()\n\n"
+}
+
 func (g *PyGenerator) Finish() error {
+	if g.havefunctions {
+		g.output = g.output[:g.realParseAt] + g.realParse() + g.output[g.realParseAt:]
+	}
 	ret := g.output + `
 import time
 
@@ -0,0 +1,377 @@
+/*
+Copyright (c) 2012-2013 Fredrik Ehnbom
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice, this
+   list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE LIABLE FOR
+ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+(INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+(INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"strings"
+)
+
+const (
+	// Horizontal space taken by a character of box text
+	rrCharWidth = 8
+	// Size of the arcs connecting branches, and the gap between items
+	rrArc = 10
+	// Margin around a whole diagram
+	rrMargin = 20
+	rrStyle  = `<style>
+path { fill: none; stroke: #333; stroke-width: 1.5; }
+rect { fill: #ffc; stroke: #333; stroke-width: 1.5; }
+rect.terminal { fill: #dfd; }
+rect.group { fill: none; stroke-dasharray: 4 3; }
+circle { fill: #fcc; stroke: #333; stroke-width: 1.5; }
+text { font-family: monospace; font-size: 13px; text-anchor: middle; }
+text.label { text-anchor: start; font-size: 11px; fill: #666; }
+a text { fill: #00c; }
+</style>
+`
+)
+
+type (
+	// rrItem is a part of a railroad diagram. The diagram line enters
+	// it at the left and leaves at the right, "up" and "down" being
+	// the space it takes above and below the line.
+	rrItem interface {
+		size() (width, up, down int)
+		// Draw the item with the line entering at x, y
+		render(buf *bytes.Buffer, x, y int, link func(string) string)
+	}
+	// rrBox is a terminal, or a nonterminal when "ref" is set
+	rrBox struct {
+		text     string
+		terminal bool
+		ref      string
+	}
+	// rrCut is the marker of a cut operator
+	rrCut struct{}
+	// rrSkip is an empty stretch of line
+	rrSkip     struct{}
+	rrSequence struct {
+		items []rrItem
+	}
+	// rrChoice has the first alternative on the line and the
+	// others branching off below it
+	rrChoice struct {
+		items []rrItem
+	}
+	// rrLoop is one or more of "item", looping back below it
+	rrLoop struct {
+		item rrItem
+	}
+	// rrGroup frames "item" with a label, as for predicates and
+	// captures
+	rrGroup struct {
+		item  rrItem
+		label string
+	}
+)
+
+func (b *rrBox) size() (int, int, int) {
+	return len([]rune(b.text))*rrCharWidth + 2*rrArc, 12, 12
+}
+
+func (b *rrBox) render(buf *bytes.Buffer, x, y int, link func(string) string) {
+	w, _, _ := b.size()
+	class, rx := "", 0
+	if b.terminal {
+		class, rx = ` class="terminal"`, 10
+	}
+	text := html.EscapeString(b.text)
+	fmt.Fprintf(buf, "<rect%s x=\"%d\" y=\"%d\" width=\"%d\" height=\"24\" rx=\"%d\"/>\n", class, x, y-12, w, rx)
+	if b.ref != "" {
+		fmt.Fprintf(buf, "<a href=\"%s\"><text x=\"%d\" y=\"%d\">%s</text></a>\n", html.EscapeString(link(b.ref)), x+w/2, y+4, text)
+	} else {
+		fmt.Fprintf(buf, "<text x=\"%d\" y=\"%d\">%s</text>\n", x+w/2, y+4, text)
+	}
+}
+
+func (c *rrCut) size() (int, int, int) {
+	return 20, 10, 10
+}
+
+func (c *rrCut) render(buf *bytes.Buffer, x, y int, link func(string) string) {
+	fmt.Fprintf(buf, "<circle cx=\"%d\" cy=\"%d\" r=\"10\"/>\n<text x=\"%d\" y=\"%d\">^</text>\n", x+10, y, x+10, y+4)
+}
+
+func (s *rrSkip) size() (int, int, int) {
+	return 0, 0, 0
+}
+
+func (s *rrSkip) render(buf *bytes.Buffer, x, y int, link func(string) string) {
+}
+
+func (s *rrSequence) size() (w, up, down int) {
+	for i, item := range s.items {
+		iw, iu, id := item.size()
+		if i > 0 {
+			w += rrArc
+		}
+		w += iw
+		up, down = maxInt(up, iu), maxInt(down, id)
+	}
+	return
+}
+
+func (s *rrSequence) render(buf *bytes.Buffer, x, y int, link func(string) string) {
+	for i, item := range s.items {
+		if i > 0 {
+			rrLine(buf, x, y, rrArc)
+			x += rrArc
+		}
+		item.render(buf, x, y, link)
+		w, _, _ := item.size()
+		x += w
+	}
+}
+
+// offsets returns how far below the line each alternative is drawn
+func (c *rrChoice) offsets() []int {
+	var (
+		ret     = []int{0}
+		_, _, d = c.items[0].size()
+	)
+	bottom := d
+	for _, item := range c.items[1:] {
+		_, iu, id := item.size()
+		off := maxInt(bottom+rrArc+iu, ret[len(ret)-1]+2*rrArc)
+		ret = append(ret, off)
+		bottom = off + id
+	}
+	return ret
+}
+
+func (c *rrChoice) size() (w, up, down int) {
+	for _, item := range c.items {
+		iw, _, _ := item.size()
+		w = maxInt(w, iw)
+	}
+	_, up, down = c.items[0].size()
+	offs := c.offsets()
+	_, _, d := c.items[len(c.items)-1].size()
+	return w + 4*rrArc, up, maxInt(down, offs[len(offs)-1]+d)
+}
+
+func (c *rrChoice) render(buf *bytes.Buffer, x, y int, link func(string) string) {
+	w, _, _ := c.size()
+	for i, off := range c.offsets() {
+		item := c.items[i]
+		iw, _, _ := item.size()
+		if off == 0 {
+			rrLine(buf, x, y, 2*rrArc)
+		} else {
+			fmt.Fprintf(buf, "<path d=\"M%d %da%d %d 0 0 1 %d %dv%da%d %d 0 0 0 %d %d\"/>\n",
+				x, y, rrArc, rrArc, rrArc, rrArc, off-2*rrArc, rrArc, rrArc, rrArc, rrArc)
+		}
+		item.render(buf, x+2*rrArc, y+off, link)
+		rrLine(buf, x+2*rrArc+iw, y+off, w-4*rrArc-iw)
+		if off == 0 {
+			rrLine(buf, x+w-2*rrArc, y, 2*rrArc)
+		} else {
+			fmt.Fprintf(buf, "<path d=\"M%d %da%d %d 0 0 0 %d %dv%da%d %d 0 0 1 %d %d\"/>\n",
+				x+w-2*rrArc, y+off, rrArc, rrArc, rrArc, -rrArc, -(off - 2*rrArc), rrArc, rrArc, rrArc, -rrArc)
+		}
+	}
+}
+
+func (l *rrLoop) size() (int, int, int) {
+	w, up, down := l.item.size()
+	return w + 4*rrArc, up, maxInt(down+rrArc, 2*rrArc)
+}
+
+func (l *rrLoop) render(buf *bytes.Buffer, x, y int, link func(string) string) {
+	w, _, down := l.size()
+	iw, _, _ := l.item.size()
+	rrLine(buf, x, y, 2*rrArc)
+	l.item.render(buf, x+2*rrArc, y, link)
+	rrLine(buf, x+2*rrArc+iw, y, 2*rrArc)
+	// The way back, from the right end of the item to its left end
+	fmt.Fprintf(buf, "<path d=\"M%d %da%d %d 0 0 1 %d %dv%da%d %d 0 0 1 %d %dh%da%d %d 0 0 1 %d %dv%da%d %d 0 0 1 %d %d\"/>\n",
+		x+w-2*rrArc, y, rrArc, rrArc, rrArc, rrArc, down-2*rrArc, rrArc, rrArc, -rrArc, rrArc,
+		-iw, rrArc, rrArc, -rrArc, -rrArc, -(down - 2*rrArc), rrArc, rrArc, rrArc, -rrArc)
+}
+
+func (g *rrGroup) size() (int, int, int) {
+	w, up, down := g.item.size()
+	return w + 2*rrArc, up + 2*rrArc, down + rrArc
+}
+
+func (g *rrGroup) render(buf *bytes.Buffer, x, y int, link func(string) string) {
+	w, up, down := g.size()
+	iw, _, _ := g.item.size()
+	fmt.Fprintf(buf, "<rect class=\"group\" x=\"%d\" y=\"%d\" width=\"%d\" height=\"%d\" rx=\"5\"/>\n", x+rrArc/2, y-up+rrArc/2, w-rrArc, up+down-rrArc)
+	fmt.Fprintf(buf, "<text class=\"label\" x=\"%d\" y=\"%d\">%s</text>\n", x+rrArc, y-up+rrArc+6, html.EscapeString(g.label))
+	rrLine(buf, x, y, rrArc)
+	g.item.render(buf, x+rrArc, y, link)
+	rrLine(buf, x+rrArc+iw, y, rrArc)
+}
+
+// rrLine draws a horizontal line of length "w" starting at x, y
+func rrLine(buf *bytes.Buffer, x, y, w int) {
+	if w > 0 {
+		fmt.Fprintf(buf, "<path d=\"M%d %dh%d\"/>\n", x, y, w)
+	}
+}
+
+// maxInt returns the larger of "a" and "b"
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// railroad turns the peg tree "node" into railroad diagram items
+func railroad(node *Node) rrItem {
+	switch node.Name {
+	case "Expression":
+		if len(node.Children) == 1 {
+			return railroad(node.Children[0])
+		}
+		c := &rrChoice{}
+		for _, child := range node.Children {
+			c.items = append(c.items, railroad(child))
+		}
+		return c
+	case "Sequence":
+		if len(node.Children) == 1 {
+			return railroad(node.Children[0])
+		}
+		s := &rrSequence{}
+		for _, child := range node.Children {
+			s.items = append(s.items, railroad(child))
+		}
+		return s
+	case "Prefix":
+		if isCut(node) {
+			return &rrCut{}
+		}
+		item := railroad(node.Children[len(node.Children)-1])
+		for i := len(node.Children) - 2; i >= 0; i-- {
+			switch front := node.Children[i]; front.Name {
+			case "Label":
+				item = &rrGroup{item, front.Children[0].Data() + ":"}
+			case "NOT":
+				item = &rrGroup{item, "not followed by"}
+			case "AND":
+				item = &rrGroup{item, "followed by"}
+			}
+		}
+		return item
+	case "Predicate":
+		code := strings.TrimSpace(node.Children[len(node.Children)-1].Data())
+		if node.Children[0].Name == "NOT" {
+			return &rrBox{text: "!{ " + code + " }"}
+		}
+		return &rrBox{text: "&{ " + code + " }"}
+	case "Suffix":
+		item := railroad(node.Children[0])
+		if len(node.Children) == 1 {
+			return item
+		}
+		switch node.Children[len(node.Children)-1].Name {
+		case "PLUS":
+			return &rrLoop{item}
+		case "STAR":
+			return &rrChoice{[]rrItem{&rrLoop{item}, &rrSkip{}}}
+		case "QUESTION":
+			return &rrChoice{[]rrItem{item, &rrSkip{}}}
+		}
+	case "Primary":
+		if front := node.Children[0]; front.Name == "Identifier" {
+			return &rrBox{text: front.Data(), ref: front.Data()}
+		} else {
+			return railroad(front)
+		}
+	case "Precedence":
+		operand := &rrBox{text: node.Children[0].Data(), ref: node.Children[0].Data()}
+		ops := &rrChoice{}
+		for _, level := range node.Children[1:] {
+			for _, op := range level.Children[1:] {
+				ops.items = append(ops.items, &rrBox{text: op.Data(), terminal: true})
+			}
+		}
+		return &rrSequence{[]rrItem{operand, &rrChoice{[]rrItem{&rrLoop{&rrSequence{[]rrItem{ops, operand}}}, &rrSkip{}}}}}
+	case "Literal", "Class":
+		return &rrBox{text: node.Data(), terminal: true}
+	case "DOT":
+		return &rrBox{text: "any character", terminal: true}
+	case "BackReference":
+		return &rrBox{text: "=" + node.Children[0].Data(), terminal: true}
+	}
+	panic("Shouldn't reach this: " + node.Name)
+}
+
+// railroadSVG draws the diagram of the definition "name" as a standalone
+// SVG document
+func railroadSVG(name string, item rrItem, link func(string) string) string {
+	w, up, down := item.size()
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\">\n<title>%s</title>\n%s",
+		w+2*rrMargin+2*rrArc, up+down+2*rrMargin, html.EscapeString(name), rrStyle)
+	x, y := rrMargin, rrMargin+up
+	fmt.Fprintf(&buf, "<path d=\"M%d %dv20M%d %dv20\"/>\n", x, y-10, x+4, y-10)
+	rrLine(&buf, x, y, rrArc)
+	item.render(&buf, x+rrArc, y, link)
+	rrLine(&buf, x+rrArc+w, y, rrArc)
+	x += 2*rrArc + w
+	fmt.Fprintf(&buf, "<path d=\"M%d %dv20M%d %dv20\"/>\n", x, y-10, x-4, y-10)
+	buf.WriteString("</svg>\n")
+	return buf.String()
+}
+
+// GenerateRailroad writes a railroad diagram for each definition in
+// "rootNode" to <Definition>.svg, and an index.html page showing all
+// of them with the nonterminals linking to their definitions.
+func GenerateRailroad(rootNode *Node, s GeneratorSettings) error {
+	var defs []*Node
+	for _, node := range rootNode.Children {
+		switch node.Name {
+		case "Definition":
+			defs = append(defs, node)
+		case "Lexical":
+			for _, child := range node.Children {
+				if child.Name == "Trivia" {
+					child = child.Children[0]
+				}
+				defs = append(defs, child)
+			}
+		}
+	}
+	index := bytes.NewBufferString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>" + html.EscapeString(s.Name) +
+		"</title>\n</head>\n<body>\n<h1>" + html.EscapeString(s.Name) + "</h1>\n")
+	for _, def := range defs {
+		name := def.Children[0].Data()
+		item := railroad(def.Children[len(def.Children)-1])
+		if err := s.WriteFile(name+".svg", railroadSVG(name, item, func(ref string) string { return ref + ".svg" })); err != nil {
+			return err
+		}
+		fmt.Fprintf(index, "<h2 id=\"%s\">%s</h2>\n", html.EscapeString(name), html.EscapeString(name))
+		index.WriteString(railroadSVG(name, item, func(ref string) string { return "#" + ref }))
+	}
+	index.WriteString("</body>\n</html>\n")
+	return s.WriteFile("index.html", index.String())
+}
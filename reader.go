@@ -7,6 +7,8 @@ import (
 type BasicReader struct {
 	pos  int
 	data string
+	// Number of bytes the last Read consumed
+	size int
 }
 
 const nilrune = '\u0000'
@@ -29,16 +31,27 @@ func (p *BasicReader) Substring(start, end int) string {
 }
 
 func (p *BasicReader) LineCol(offset int) (line, column int) {
-	line = 1
-	column = 1
-	for _, r := range p.data[:offset] {
-		column++
-		if r == '\n' {
-			line++
-			column = 1
-		}
-	}
-	return
+	return lineCol(p.data, offset, false)
+}
+
+func (p *BasicReader) LineColUTF16(offset int) (line, column int) {
+	return lineCol(p.data, offset, true)
+}
+
+func (p *BasicReader) Offset(line, column int) int {
+	return offset(p.data, line, column, false)
+}
+
+func (p *BasicReader) OffsetUTF16(line, column int) int {
+	return offset(p.data, line, column, true)
+}
+
+func (p *BasicReader) RuneOffset(offset int) int {
+	return runeOffset(p.data, offset)
+}
+
+func (p *BasicReader) ByteOffset(runeOffset int) int {
+	return byteOffset(p.data, runeOffset)
 }
 
 func (p *BasicReader) Len() int {
@@ -54,15 +67,25 @@ func (p *BasicReader) eof() bool {
 func (p *BasicReader) Read() rune {
 	if p.eof() {
 		p.pos++
+		p.size = 1
 		return nilrune
 	}
 	r, s := utf8.DecodeRuneInString(p.data[p.pos:])
 	p.pos += s
+	p.size = s
 
 	return r
 }
 
 func (p *BasicReader) UnRead() {
+	if p.size > 0 {
+		// Step back over exactly what the last Read consumed, as
+		// looking for the start of the rune goes too far back when
+		// the data isn't valid UTF-8
+		p.pos -= p.size
+		p.size = 0
+		return
+	}
 	p.pos--
 	for !p.eof() && p.pos > 0 && !utf8.RuneStart(p.data[p.pos]) {
 		p.pos--
@@ -71,8 +94,112 @@ func (p *BasicReader) UnRead() {
 
 func (p *BasicReader) Seek(n int) {
 	p.pos = n
+	p.size = 0
 }
 
 func NewReader(data string) Reader {
-	return &BasicReader{0, data}
+	return &BasicReader{data: data}
+}
+
+// BytesReader is a Reader over a []byte, which it reads without
+// copying. The strings Substring returns are copies, but the slices
+// Bytes returns share their memory with the data, so it must not
+// change while it's being parsed, nor while those slices are in use.
+type BytesReader struct {
+	pos  int
+	data []byte
+	// Number of bytes the last Read consumed
+	size int
+}
+
+func (p *BytesReader) Substring(start, end int) string {
+	return string(p.Bytes(start, end))
+}
+
+// Bytes returns the data between "start" and "end" without copying it
+func (p *BytesReader) Bytes(start, end int) []byte {
+	l := len(p.data)
+	if start < 0 {
+		start = 0
+	}
+	if end > l {
+		end = l
+	}
+	if start >= end {
+		return nil
+	}
+	return p.data[start:end:end]
+}
+
+func (p *BytesReader) LineCol(offset int) (line, column int) {
+	return lineCol(string(p.data), offset, false)
+}
+
+func (p *BytesReader) LineColUTF16(offset int) (line, column int) {
+	return lineCol(string(p.data), offset, true)
+}
+
+func (p *BytesReader) Offset(line, column int) int {
+	return offset(string(p.data), line, column, false)
+}
+
+func (p *BytesReader) OffsetUTF16(line, column int) int {
+	return offset(string(p.data), line, column, true)
+}
+
+func (p *BytesReader) RuneOffset(offset int) int {
+	return runeOffset(string(p.data), offset)
+}
+
+func (p *BytesReader) ByteOffset(runeOffset int) int {
+	return byteOffset(string(p.data), runeOffset)
+}
+
+func (p *BytesReader) Len() int {
+	return len(p.data)
+}
+
+func (p *BytesReader) Pos() int {
+	return p.pos
+}
+
+func (p *BytesReader) eof() bool {
+	return p.pos >= len(p.data)
+}
+
+func (p *BytesReader) Read() rune {
+	if p.eof() {
+		p.pos++
+		p.size = 1
+		return nilrune
+	}
+	r, s := rune(p.data[p.pos]), 1
+	if r >= utf8.RuneSelf {
+		r, s = utf8.DecodeRune(p.data[p.pos:])
+	}
+	p.pos += s
+	p.size = s
+	return r
+}
+
+func (p *BytesReader) UnRead() {
+	if p.size > 0 {
+		p.pos -= p.size
+		p.size = 0
+		return
+	}
+	p.pos--
+	for !p.eof() && p.pos > 0 && !utf8.RuneStart(p.data[p.pos]) {
+		p.pos--
+	}
+}
+
+func (p *BytesReader) Seek(n int) {
+	p.pos = n
+	p.size = 0
+}
+
+// NewBytesReader returns a Reader over "data", which isn't copied
+func NewBytesReader(data []byte) Reader {
+	return &BytesReader{data: data}
 }
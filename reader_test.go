@@ -0,0 +1,162 @@
+/*
+Copyright (c) 2012-2013 Fredrik Ehnbom
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice, this
+   list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE LIABLE FOR
+ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+(INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+(INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+package parser
+
+import (
+	"testing"
+)
+
+func TestReaderUnRead(t *testing.T) {
+	for _, r := range []Reader{NewReader("A0\x80å"), NewBytesReader([]byte("A0\x80å"))} {
+		for _, exp := range []int{1, 2, 3, 5, 6} {
+			r.Read()
+			pos := r.Pos()
+			if pos != exp {
+				t.Errorf("%T: Expected to be at %d after reading, not %d", r, exp, pos)
+			}
+			r.UnRead()
+			r.Read()
+			if r.Pos() != pos {
+				t.Errorf("%T: Expected to be back at %d after unreading and reading again, not %d", r, pos, r.Pos())
+			}
+		}
+	}
+}
+
+func TestBytesReader(t *testing.T) {
+	const data = "a\nå\x80b\n"
+	s, b := NewReader(data), NewBytesReader([]byte(data))
+	if s.Len() != b.Len() {
+		t.Fatalf("Expected the length %d, not %d", s.Len(), b.Len())
+	}
+	for {
+		pos := s.Pos()
+		if c1, c2 := s.Read(), b.Read(); c1 != c2 || s.Pos() != b.Pos() {
+			t.Errorf("Reading at %d gave %q at %d rather than %q at %d", pos, c2, b.Pos(), c1, s.Pos())
+		}
+		if pos > s.Len() {
+			break
+		}
+	}
+	for start := -1; start <= len(data)+1; start++ {
+		for end := start; end <= len(data)+1; end++ {
+			if s1, s2 := s.Substring(start, end), b.Substring(start, end); s1 != s2 {
+				t.Errorf("Substring(%d, %d) is %q rather than %q", start, end, s2, s1)
+			}
+			if b1 := b.(ByteReader).Bytes(start, end); string(b1) != s.Substring(start, end) {
+				t.Errorf("Bytes(%d, %d) is %q rather than %q", start, end, b1, s.Substring(start, end))
+			}
+		}
+	}
+	for i := 0; i <= len(data); i++ {
+		l1, c1 := s.LineCol(i)
+		if l2, c2 := b.LineCol(i); l1 != l2 || c1 != c2 {
+			t.Errorf("LineCol(%d) is %d:%d rather than %d:%d", i, l2, c2, l1, c1)
+		}
+	}
+	if allocs := testing.AllocsPerRun(10, func() {
+		b.Seek(0)
+		for b.Pos() < b.Len() {
+			b.Read()
+		}
+		b.(ByteReader).Bytes(0, b.Len())
+	}); allocs != 0 {
+		t.Errorf("Expected reading a []byte not to allocate, but it did %v times", allocs)
+	}
+
+	// The strings stay the same when the data is reused, unlike the
+	// slices Bytes returns
+	buf := []byte("abc")
+	r := NewBytesReader(buf).(ByteReader)
+	str, bytes := r.Substring(0, 3), r.Bytes(0, 3)
+	copy(buf, "xyz")
+	if str != "abc" {
+		t.Errorf("Expected the string to be a copy, but it changed to %q", str)
+	}
+	if string(bytes) != "xyz" {
+		t.Errorf("Expected the bytes to be the data itself, but they are %q", bytes)
+	}
+}
+
+func TestReaderPositions(t *testing.T) {
+	const data = "a\r\nå\U0001D11Eb\n\x80c"
+	for _, r := range []Reader{NewReader(data), NewBytesReader([]byte(data))} {
+		tests := []struct {
+			offset, line, col, col16, runes int
+		}{
+			{0, 1, 1, 1, 0},
+			{3, 2, 1, 1, 3},
+			{5, 2, 2, 2, 4},
+			{9, 2, 3, 4, 5},
+			{11, 3, 1, 1, 7},
+			{12, 3, 2, 2, 8},
+			{13, 3, 3, 3, 9},
+			{100, 3, 3, 3, 9},
+		}
+		for _, test := range tests {
+			if line, col := r.LineCol(test.offset); line != test.line || col != test.col {
+				t.Errorf("%T: LineCol(%d) is %d:%d rather than %d:%d", r, test.offset, line, col, test.line, test.col)
+			}
+			if line, col := r.LineColUTF16(test.offset); line != test.line || col != test.col16 {
+				t.Errorf("%T: LineColUTF16(%d) is %d:%d rather than %d:%d", r, test.offset, line, col, test.line, test.col16)
+			}
+			if runes := r.RuneOffset(test.offset); runes != test.runes {
+				t.Errorf("%T: RuneOffset(%d) is %d rather than %d", r, test.offset, runes, test.runes)
+			}
+		}
+		// Every rune converts back to where it starts
+		for o := 0; o <= r.Len(); {
+			if o2 := r.Offset(r.LineCol(o)); o2 != o {
+				t.Errorf("%T: Offset(LineCol(%d)) is %d", r, o, o2)
+			}
+			if o2 := r.OffsetUTF16(r.LineColUTF16(o)); o2 != o {
+				t.Errorf("%T: OffsetUTF16(LineColUTF16(%d)) is %d", r, o, o2)
+			}
+			if o2 := r.ByteOffset(r.RuneOffset(o)); o2 != o {
+				t.Errorf("%T: ByteOffset(RuneOffset(%d)) is %d", r, o, o2)
+			}
+			r.Seek(o)
+			r.Read()
+			o = r.Pos()
+		}
+		for _, test := range []struct {
+			line, col, offset, offset16 int
+		}{
+			// Past the end of the line
+			{1, 10, 2, 2},
+			// Within the surrogate pair
+			{2, 3, 9, 5},
+			{4, 1, 13, 13},
+			{0, 0, 0, 0},
+		} {
+			if o := r.Offset(test.line, test.col); o != test.offset {
+				t.Errorf("%T: Offset(%d, %d) is %d rather than %d", r, test.line, test.col, o, test.offset)
+			}
+			if o := r.OffsetUTF16(test.line, test.col); o != test.offset16 {
+				t.Errorf("%T: OffsetUTF16(%d, %d) is %d rather than %d", r, test.line, test.col, o, test.offset16)
+			}
+		}
+	}
+}
@@ -0,0 +1,186 @@
+/*
+Copyright (c) 2012-2013 Fredrik Ehnbom
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice, this
+   list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE LIABLE FOR
+ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+(INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+(INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+package parser
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+type (
+	// Kind of an Event
+	EventKind int
+
+	// Event is something that happened as a parser worked through the
+	// data. Offsets are byte offsets into the data.
+	Event struct {
+		Kind EventKind `json:"kind"`
+		// The definition entered, exited or backtracking, or the
+		// terminal as written in the grammar that didn't match
+		Name string `json:"name"`
+		// Where the definition was entered, the terminal was tried or
+		// the definition backtracked to
+		Start int `json:"start"`
+		// Where the definition was exited or backtracked from
+		End int `json:"end,omitempty"`
+		// Whether the exited definition matched
+		Accept bool `json:"accept,omitempty"`
+	}
+
+	// Tracer receives the events of a parser as it works through the
+	// data. The parsers GoGenerator generates with a DebugLevel above
+	// DebugLevelNone trace to theirs, as does the Interpreter when it
+	// has one. Each parser has a Tracer of its own, so parsers parsing
+	// in parallel don't share any state.
+	Tracer interface {
+		Trace(e Event)
+	}
+
+	// TextTracer writes the events as an indented text trace, one
+	// event per line
+	TextTracer struct {
+		// Where the trace is written, os.Stderr if nil
+		W     io.Writer
+		depth int
+	}
+
+	// JSONTracer writes the events as JSON Lines, which ReadTrace
+	// reads back
+	JSONTracer struct {
+		enc *json.Encoder
+		err error
+	}
+)
+
+const (
+	// A definition was entered at Start
+	EventEnter EventKind = iota
+	// A definition entered at Start was exited at End
+	EventExit
+	// The terminal Name didn't match at Start
+	EventMismatch
+	// A sequence of the definition Name matched up to End before
+	// failing, so the parser went back to Start
+	EventBacktrack
+)
+
+var eventKinds = []string{"enter", "exit", "mismatch", "backtrack"}
+
+func (k EventKind) String() string {
+	if k < 0 || int(k) >= len(eventKinds) {
+		return fmt.Sprintf("EventKind(%d)", int(k))
+	}
+	return eventKinds[k]
+}
+
+func (k EventKind) MarshalText() ([]byte, error) {
+	if k < 0 || int(k) >= len(eventKinds) {
+		return nil, fmt.Errorf("unknown event kind %d", int(k))
+	}
+	return []byte(eventKinds[k]), nil
+}
+
+func (k *EventKind) UnmarshalText(data []byte) error {
+	for i, s := range eventKinds {
+		if s == string(data) {
+			*k = EventKind(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown event kind %q", data)
+}
+
+// String returns the event the way a TextTracer writes it, without
+// indentation
+func (e Event) String() string {
+	switch e.Kind {
+	case EventEnter:
+		return fmt.Sprintf("enter %s at %d", e.Name, e.Start)
+	case EventExit:
+		result := "failed"
+		if e.Accept {
+			result = "matched"
+		}
+		return fmt.Sprintf("exit %s %d-%d, %s", e.Name, e.Start, e.End, result)
+	case EventMismatch:
+		return fmt.Sprintf("mismatch %s at %d", e.Name, e.Start)
+	case EventBacktrack:
+		return fmt.Sprintf("backtrack %s from %d to %d", e.Name, e.End, e.Start)
+	}
+	return fmt.Sprintf("%s %s %d-%d", e.Kind, e.Name, e.Start, e.End)
+}
+
+func (t *TextTracer) Trace(e Event) {
+	if e.Kind == EventExit && t.depth > 0 {
+		t.depth--
+	}
+	w := t.W
+	if w == nil {
+		w = os.Stderr
+	}
+	fmt.Fprintf(w, "%s%s\n", strings.Repeat("  ", t.depth), e)
+	if e.Kind == EventEnter {
+		t.depth++
+	}
+}
+
+// NewJSONTracer returns a Tracer writing the events to "w" as JSON
+// Lines
+func NewJSONTracer(w io.Writer) *JSONTracer {
+	return &JSONTracer{enc: json.NewEncoder(w)}
+}
+
+func (t *JSONTracer) Trace(e Event) {
+	if t.err == nil {
+		t.err = t.enc.Encode(e)
+	}
+}
+
+// Err returns the first error writing the trace, if any
+func (t *JSONTracer) Err() error {
+	return t.err
+}
+
+// ReadTrace reads back the events a JSONTracer wrote
+func ReadTrace(r io.Reader) ([]Event, error) {
+	var events []Event
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1<<20)
+	for line := 1; s.Scan(); line++ {
+		if len(strings.TrimSpace(s.Text())) == 0 {
+			continue
+		}
+		var e Event
+		if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+			return events, fmt.Errorf("line %d: %s", line, err)
+		}
+		events = append(events, e)
+	}
+	return events, s.Err()
+}
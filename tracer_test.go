@@ -0,0 +1,75 @@
+/*
+Copyright (c) 2012-2013 Fredrik Ehnbom
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice, this
+   list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT OWNER OR CONTRIBUTORS BE LIABLE FOR
+ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+(INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+(INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+package parser
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestTracers(t *testing.T) {
+	events := []Event{
+		{Kind: EventEnter, Name: "List", Start: 0},
+		{Kind: EventEnter, Name: "Item", Start: 0},
+		{Kind: EventMismatch, Name: "[a-z]", Start: 1},
+		{Kind: EventExit, Name: "Item", Start: 0, End: 1, Accept: true},
+		{Kind: EventBacktrack, Name: "List", Start: 0, End: 2},
+		{Kind: EventExit, Name: "List", Start: 0},
+	}
+	var buf bytes.Buffer
+	jt := NewJSONTracer(&buf)
+	for _, e := range events {
+		jt.Trace(e)
+	}
+	if err := jt.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ReadTrace(&buf); err != nil {
+		t.Error(err)
+	} else if !reflect.DeepEqual(got, events) {
+		t.Errorf("Read back %v instead of %v", got, events)
+	}
+
+	buf.Reset()
+	tt := TextTracer{W: &buf}
+	for _, e := range events {
+		tt.Trace(e)
+	}
+	const exp = `enter List at 0
+  enter Item at 0
+    mismatch [a-z] at 1
+  exit Item 0-1, matched
+  backtrack List from 2 to 0
+exit List 0-0, failed
+`
+	if buf.String() != exp {
+		t.Errorf("Expected:\n%s\nGot:\n%s", exp, buf.String())
+	}
+
+	if _, err := ReadTrace(bytes.NewBufferString(`{"kind":"enter"}` + "\n" + `{"kind":"leave"}`)); err == nil {
+		t.Error("Expected an error reading an unknown kind of event")
+	}
+}
@@ -0,0 +1,54 @@
+package xml
+
+import (
+	"testing"
+)
+
+func TestTagMatching(t *testing.T) {
+	valid := map[string]string{
+		`<?xml version="1.0"?><a></a>`: `0-28: "XML"
+	0-21: "XmlStartTag" - Data: "<?xml version="1.0"?>"
+	21-28: "TagPair"
+		22-23: "Identifier" - Data: "a"
+		24-24: "XmlData" - Data: ""
+	28-28: "EndOfFile" - Data: ""
+`,
+		`<?xml version="1.0"?><a x="1"><b>text</b></a>`: `0-45: "XML"
+	0-21: "XmlStartTag" - Data: "<?xml version="1.0"?>"
+	21-45: "TagPair"
+		22-23: "Identifier" - Data: "a"
+		24-29: "Attribute"
+			24-25: "Identifier" - Data: "x"
+			26-29: "QuotedValue"
+				27-28: "Value" - Data: "1"
+		30-41: "XmlData"
+			30-41: "TagPair"
+				31-32: "Identifier" - Data: "b"
+				33-37: "XmlData"
+					33-37: "Text" - Data: "text"
+	45-45: "EndOfFile" - Data: ""
+`,
+	}
+	for k, v := range valid {
+		var p XML
+		if !p.Parse(k) {
+			t.Errorf("Didn't parse correctly: %s\n%s", k, p.Error())
+		} else if p.RootNode().String() != v {
+			t.Errorf("Test %s failed\nExpected: %s\nReceived, %s", k, v, p.RootNode())
+		}
+	}
+
+	invalid := []string{
+		`<?xml version="1.0"?><a></b>`,
+		`<?xml version="1.0"?><ab></a>`,
+		`<?xml version="1.0"?><a></ab>`,
+		`<?xml version="1.0"?><a><b></a></b>`,
+		`<?xml version="1.0"?><a><b></b></c>`,
+	}
+	for _, k := range invalid {
+		var p XML
+		if p.Parse(k) {
+			t.Errorf("Succeeded, but shouldn't have: %s", k)
+		}
+	}
+}